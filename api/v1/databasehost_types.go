@@ -17,6 +17,8 @@ limitations under the License.
 package v1
 
 import (
+	"slices"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,6 +29,63 @@ const (
 	Postgres DatabaseType = "postgres"
 )
 
+const (
+	// AnnotationPaused stops the operator from touching the host and all databases and users on it
+	AnnotationPaused = "k8s.tuunit.com/paused"
+	// AnnotationCascade deletes all databases and users on the host when the host is deleted.
+	// Without it the deletion of the host waits until they are deleted.
+	AnnotationCascade = "k8s.tuunit.com/cascade"
+)
+
+const (
+	// PasswordSecretKey is the key of the superuser password in the secret referenced by PasswordSecretRef
+	PasswordSecretKey = "password"
+)
+
+const (
+	// ConditionTypePaused indicates that the reconciliation of the host is paused
+	ConditionTypePaused = "Paused"
+	// ConditionTypeDeletionBlocked indicates that the host is deleted but still has dependents
+	ConditionTypeDeletionBlocked = "DeletionBlocked"
+	// ConditionTypeLocaleUnsupported indicates that the default charset or collation of a MySQL host
+	// is not available on its server
+	ConditionTypeLocaleUnsupported = "LocaleUnsupported"
+)
+
+// DefaultPort returns the port the database engine listens on by default
+func (t DatabaseType) DefaultPort() int32 {
+	switch t {
+	case MySQL:
+		return 3306
+	case Postgres:
+		return 5432
+	}
+	return 0
+}
+
+// DefaultCharset returns the character set used for new databases
+// when neither the database nor its host specify one
+func (t DatabaseType) DefaultCharset() string {
+	switch t {
+	case MySQL:
+		return "utf8mb4"
+	case Postgres:
+		return "UTF8"
+	}
+	return ""
+}
+
+// DefaultCollation returns the collation used for new databases
+// when neither the database nor its host specify one. PostgreSQL has none,
+// as the locales differ between servers, its databases inherit the locale of their template.
+func (t DatabaseType) DefaultCollation() string {
+	switch t {
+	case MySQL:
+		return "utf8mb4_unicode_ci"
+	}
+	return ""
+}
+
 // DatabaseHostSpec defines the desired state of DatabaseHost
 type DatabaseHostSpec struct {
 	// Host is the hostname or IP address of the database host
@@ -45,18 +104,152 @@ type DatabaseHostSpec struct {
 	// +optional
 	Password string `json:"password,omitempty"`
 	// PasswordSecretRef is a reference to a secret in the same namespace
-	// that contains the password for the superuser
+	// that contains the password for the superuser under the key "password".
+	// It takes precedence over Password
 	// +optional
 	PasswordSecretRef string `json:"passwordSecretRef,omitempty"`
 	// Port is the port number for the database
+	// Defaults to the standard port of the database type
 	// +optional
 	Port int32 `json:"port"`
+	// Charset is the default character set for databases on this host
+	// Defaults to the standard character set of the database type
+	// +optional
+	Charset string `json:"charset,omitempty"`
+	// Collation is the default collation for databases on this host
+	// Defaults to the standard collation of the database type, PostgreSQL databases
+	// without a collation inherit the locale the server was initialized with
+	// +optional
+	Collation string `json:"collation,omitempty"`
+	// MaintenanceWindows restrict destructive or heavy operations like drops, renames and
+	// password rotations to the given windows. Without windows they are executed right away.
+	// +optional
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+}
+
+// MaintenanceWindow is a recurring period in which destructive or heavy operations are executed
+type MaintenanceWindow struct {
+	// Schedule is a cron expression for the start of the window like "0 2 * * SUN".
+	// It is evaluated in the time zone of the operator unless prefixed with CRON_TZ=<zone>.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Schedule string `json:"schedule"`
+	// Duration is how long the window stays open after its start like "2h"
+	// +kubebuilder:validation:Required
+	Duration metav1.Duration `json:"duration"`
+}
+
+// EffectivePort returns the configured port or the default port of the database type
+func (s *DatabaseHostSpec) EffectivePort() int32 {
+	if s.Port != 0 {
+		return s.Port
+	}
+	return s.Type.DefaultPort()
+}
+
+// EffectiveCharset returns the configured charset or the default charset of the database type
+func (s *DatabaseHostSpec) EffectiveCharset() string {
+	if s.Charset != "" {
+		return s.Charset
+	}
+	return s.Type.DefaultCharset()
+}
+
+// EffectiveCollation returns the configured collation or the default collation of the database type
+func (s *DatabaseHostSpec) EffectiveCollation() string {
+	if s.Collation != "" {
+		return s.Collation
+	}
+	return s.Type.DefaultCollation()
 }
 
 // DatabaseHostStatus defines the observed state of DatabaseHost
 type DatabaseHostStatus struct {
 	LastConnectionTime metav1.Time `json:"lastConnectionTime,omitempty"`
 	ConnectionStatus   string      `json:"connectionStatus,omitempty"`
+	// NextMaintenanceWindow is the start of the next maintenance window, unset while a window is open
+	// +optional
+	NextMaintenanceWindow *metav1.Time `json:"nextMaintenanceWindow,omitempty"`
+	// Dependents are the databases and users which are still on the host while it is deleted
+	// +optional
+	Dependents []DependentReference `json:"dependents,omitempty"`
+	// Server describes the server running on the host, discovered after connecting to it
+	// +optional
+	Server *ServerInfo `json:"server,omitempty"`
+	// Conditions represent the latest available observations of the host's state
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// DependentReference identifies a Database or DatabaseUser on a host
+type DependentReference struct {
+	// Kind is the kind of the dependent
+	Kind string `json:"kind"`
+	// Name is the name of the dependent in the namespace of the host
+	Name string `json:"name"`
+}
+
+// ServerFlavor is the distribution or managed service a database engine is provided by
+type ServerFlavor string
+
+const (
+	FlavorPostgreSQL ServerFlavor = "PostgreSQL"
+	FlavorMySQL      ServerFlavor = "MySQL"
+	FlavorMariaDB    ServerFlavor = "MariaDB"
+	FlavorPercona    ServerFlavor = "Percona"
+	FlavorAurora     ServerFlavor = "Aurora"
+	FlavorCloudSQL   ServerFlavor = "CloudSQL"
+)
+
+const (
+	// CollationProviderLibc provides collations from the C library of the server
+	CollationProviderLibc = "libc"
+	// CollationProviderICU provides collations from the ICU library
+	CollationProviderICU = "icu"
+	// CollationProviderBuiltin provides the collations built into PostgreSQL 17 and later
+	CollationProviderBuiltin = "builtin"
+)
+
+// ServerInfo describes the version and the capabilities of the server running on a host
+type ServerInfo struct {
+	// Version is the version string reported by the server
+	Version string `json:"version"`
+	// VersionNumber is the version as a number like 160002 for 16.2 or 80036 for 8.0.36
+	VersionNumber int64 `json:"versionNumber"`
+	// Flavor is the distribution or managed service of the engine
+	Flavor ServerFlavor `json:"flavor"`
+	// Extensions are the extensions available for installation on PostgreSQL hosts
+	// +optional
+	Extensions []string `json:"extensions,omitempty"`
+	// CollationProviders are the providers of the collations available on PostgreSQL hosts
+	// +optional
+	CollationProviders []string `json:"collationProviders,omitempty"`
+	// DiscoveredAt is the time the server was last inspected
+	// +optional
+	DiscoveredAt metav1.Time `json:"discoveredAt,omitempty"`
+}
+
+// MajorVersion returns the major version of the server like 16 or 8
+func (s *ServerInfo) MajorVersion() int64 {
+	return s.VersionNumber / 10000
+}
+
+// AtLeast reports whether the major version of the server is at least the given one
+func (s *ServerInfo) AtLeast(major int64) bool {
+	return s.MajorVersion() >= major
+}
+
+// HasExtension reports whether the extension is available on the server
+func (s *ServerInfo) HasExtension(name string) bool {
+	return slices.Contains(s.Extensions, name)
+}
+
+// SupportsICULocales reports whether databases on the server can use an ICU locale,
+// which PostgreSQL supports from version 15 on if it was built with ICU
+func (s *ServerInfo) SupportsICULocales() bool {
+	return s.AtLeast(15) && slices.Contains(s.CollationProviders, CollationProviderICU)
 }
 
 //+kubebuilder:object:root=true
@@ -71,6 +264,16 @@ type DatabaseHost struct {
 	Status DatabaseHostStatus `json:"status,omitempty"`
 }
 
+// Paused reports whether the reconciliation of the host and everything on it is paused
+func (h *DatabaseHost) Paused() bool {
+	return h.Annotations[AnnotationPaused] == "true"
+}
+
+// Cascade reports whether deleting the host deletes its databases and users as well
+func (h *DatabaseHost) Cascade() bool {
+	return h.Annotations[AnnotationCascade] == "true"
+}
+
 //+kubebuilder:object:root=true
 
 // DatabaseHostList contains a list of DatabaseHost
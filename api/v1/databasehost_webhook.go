@@ -0,0 +1,48 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var databasehostlog = logf.Log.WithName("databasehost-resource")
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks
+func (r *DatabaseHost) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-k8s-tuunit-com-v1-databasehost,mutating=true,failurePolicy=fail,sideEffects=None,groups=k8s.tuunit.com,resources=databasehosts,verbs=create;update,versions=v1,name=mdatabasehost.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &DatabaseHost{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type.
+// It persists the engine specific defaults so the stored spec shows what is applied.
+// The collation of PostgreSQL hosts stays empty unless it is configured.
+func (r *DatabaseHost) Default() {
+	databasehostlog.Info("default", "name", r.Name)
+
+	r.Spec.Port = r.Spec.EffectivePort()
+	r.Spec.Charset = r.Spec.EffectiveCharset()
+	r.Spec.Collation = r.Spec.EffectiveCollation()
+}
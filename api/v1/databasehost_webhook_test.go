@@ -0,0 +1,64 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("DatabaseHost Webhook", func() {
+
+	Context("When creating DatabaseHost under Defaulting Webhook", func() {
+		It("Should fill in the defaults of the postgres engine", func() {
+			databaseHost := &DatabaseHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "postgres-defaults", Namespace: "default"},
+				Spec: DatabaseHostSpec{
+					Host:      "postgres.example.com",
+					Type:      Postgres,
+					Superuser: "postgres",
+				},
+			}
+			Expect(k8sClient.Create(ctx, databaseHost)).To(Succeed())
+
+			Expect(databaseHost.Spec.Port).To(Equal(int32(5432)))
+			Expect(databaseHost.Spec.Charset).To(Equal("UTF8"))
+			Expect(databaseHost.Spec.Collation).To(BeEmpty())
+		})
+
+		It("Should keep explicitly configured values", func() {
+			databaseHost := &DatabaseHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "mysql-explicit", Namespace: "default"},
+				Spec: DatabaseHostSpec{
+					Host:      "mysql.example.com",
+					Type:      MySQL,
+					Superuser: "root",
+					Port:      3307,
+					Collation: "utf8mb4_bin",
+				},
+			}
+			Expect(k8sClient.Create(ctx, databaseHost)).To(Succeed())
+
+			Expect(databaseHost.Spec.Port).To(Equal(int32(3307)))
+			Expect(databaseHost.Spec.Charset).To(Equal("utf8mb4"))
+			Expect(databaseHost.Spec.Collation).To(Equal("utf8mb4_bin"))
+		})
+	})
+
+})
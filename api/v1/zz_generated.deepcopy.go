@@ -21,6 +21,7 @@ limitations under the License.
 package v1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -29,7 +30,7 @@ func (in *DatabaseHost) DeepCopyInto(out *DatabaseHost) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -86,6 +87,11 @@ func (in *DatabaseHostList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseHostSpec) DeepCopyInto(out *DatabaseHostSpec) {
 	*out = *in
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = make([]MaintenanceWindow, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseHostSpec.
@@ -102,6 +108,27 @@ func (in *DatabaseHostSpec) DeepCopy() *DatabaseHostSpec {
 func (in *DatabaseHostStatus) DeepCopyInto(out *DatabaseHostStatus) {
 	*out = *in
 	in.LastConnectionTime.DeepCopyInto(&out.LastConnectionTime)
+	if in.NextMaintenanceWindow != nil {
+		in, out := &in.NextMaintenanceWindow, &out.NextMaintenanceWindow
+		*out = (*in).DeepCopy()
+	}
+	if in.Dependents != nil {
+		in, out := &in.Dependents, &out.Dependents
+		*out = make([]DependentReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Server != nil {
+		in, out := &in.Server, &out.Server
+		*out = new(ServerInfo)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseHostStatus.
@@ -113,3 +140,60 @@ func (in *DatabaseHostStatus) DeepCopy() *DatabaseHostStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DependentReference) DeepCopyInto(out *DependentReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DependentReference.
+func (in *DependentReference) DeepCopy() *DependentReference {
+	if in == nil {
+		return nil
+	}
+	out := new(DependentReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServerInfo) DeepCopyInto(out *ServerInfo) {
+	*out = *in
+	if in.Extensions != nil {
+		in, out := &in.Extensions, &out.Extensions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CollationProviders != nil {
+		in, out := &in.CollationProviders, &out.CollationProviders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.DiscoveredAt.DeepCopyInto(&out.DiscoveredAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServerInfo.
+func (in *ServerInfo) DeepCopy() *ServerInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(ServerInfo)
+	in.DeepCopyInto(out)
+	return out
+}
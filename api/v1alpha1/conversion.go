@@ -0,0 +1,77 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// conversionDataAnnotation holds the hub representation of a converted object,
+// so fields which only exist in newer versions survive a round trip through v1alpha1
+const conversionDataAnnotation = "k8s.tuunit.com/conversion-data"
+
+// AnnotationHostRef names the DatabaseHost of a v1alpha1 DatabaseUser, which has no field for it.
+// It only applies while the hub has no host reference of its own.
+const AnnotationHostRef = "k8s.tuunit.com/host-ref"
+
+// marshalData stores src in the conversion data annotation of dst
+func marshalData(src interface{}, dst metav1.Object) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+
+	annotations := dst.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[conversionDataAnnotation] = string(data)
+	dst.SetAnnotations(annotations)
+
+	return nil
+}
+
+// unmarshalData restores dst from the conversion data annotation of src
+// and reports whether the annotation was present
+func unmarshalData(src metav1.Object, dst interface{}) (bool, error) {
+	data, ok := src.GetAnnotations()[conversionDataAnnotation]
+	if !ok {
+		return false, nil
+	}
+
+	if err := json.Unmarshal([]byte(data), dst); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// removeData drops the conversion data annotation from obj
+func removeData(obj metav1.Object) {
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[conversionDataAnnotation]; !ok {
+		return
+	}
+
+	delete(annotations, conversionDataAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+var _ conversion.Convertible = &Database{}
+
+// ConvertTo converts this Database to the Hub version (v1beta1).
+func (src *Database) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.Database)
+
+	restored := &v1beta1.Database{}
+	ok, err := unmarshalData(src, restored)
+	if err != nil {
+		return err
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	removeData(dst)
+	if ok {
+		dst.Spec = restored.Spec
+		dst.Status = restored.Status
+	}
+
+	dst.Spec.Name = src.Spec.Name
+	dst.Spec.Owner = src.Spec.Owner
+	dst.Spec.Charset = src.Spec.Charset
+	dst.Spec.Collation = src.Spec.Collation
+	dst.Spec.HostRef.Name = src.Spec.DatabaseHostRef
+
+	dst.Status.CreationTime = src.Status.CreationTime
+	if !ok && src.Status.CreationStatus != "" {
+		meta.SetStatusCondition(&dst.Status.Conditions, metav1.Condition{
+			Type:    v1beta1.ConditionTypeReady,
+			Status:  metav1.ConditionUnknown,
+			Reason:  "Converted",
+			Message: src.Status.CreationStatus,
+		})
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *Database) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.Database)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	dst.Spec.Name = src.Spec.Name
+	dst.Spec.Owner = src.Spec.Owner
+	dst.Spec.Charset = src.Spec.Charset
+	dst.Spec.Collation = src.Spec.Collation
+	dst.Spec.DatabaseHostRef = src.Spec.HostRef.Name
+
+	dst.Status.CreationTime = src.Status.CreationTime
+	if ready := meta.FindStatusCondition(src.Status.Conditions, v1beta1.ConditionTypeReady); ready != nil {
+		dst.Status.CreationStatus = ready.Message
+	}
+
+	return marshalData(&v1beta1.Database{Spec: src.Spec, Status: src.Status}, dst)
+}
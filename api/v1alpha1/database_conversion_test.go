@@ -0,0 +1,91 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+var _ = Describe("Database Conversion", func() {
+	It("should convert a v1alpha1 Database to the hub", func() {
+		src := &Database{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec: DatabaseSpec{
+				Name:            "app",
+				Owner:           "app",
+				Charset:         "UTF8",
+				Collation:       "C",
+				DatabaseHostRef: "postgres",
+			},
+			Status: DatabaseStatus{CreationStatus: "Database 'app' successfully created."},
+		}
+
+		dst := &v1beta1.Database{}
+		Expect(src.ConvertTo(dst)).To(Succeed())
+
+		Expect(dst.Name).To(Equal("app"))
+		Expect(dst.Spec.Name).To(Equal("app"))
+		Expect(dst.Spec.Owner).To(Equal("app"))
+		Expect(dst.Spec.Charset).To(Equal("UTF8"))
+		Expect(dst.Spec.Collation).To(Equal("C"))
+		Expect(dst.Spec.HostRef.Name).To(Equal("postgres"))
+
+		ready := meta.FindStatusCondition(dst.Status.Conditions, v1beta1.ConditionTypeReady)
+		Expect(ready).NotTo(BeNil())
+		Expect(ready.Message).To(Equal("Database 'app' successfully created."))
+	})
+
+	It("should preserve hub only fields on a round trip", func() {
+		hub := &v1beta1.Database{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec: v1beta1.DatabaseSpec{
+				Name:    "app",
+				HostRef: v1beta1.DatabaseHostReference{Name: "postgres"},
+			},
+			Status: v1beta1.DatabaseStatus{
+				ObservedGeneration: 3,
+				Conditions: []metav1.Condition{{
+					Type:    v1beta1.ConditionTypeReady,
+					Status:  metav1.ConditionTrue,
+					Reason:  "Created",
+					Message: "Database 'app' successfully created.",
+				}},
+			},
+		}
+
+		spoke := &Database{}
+		Expect(spoke.ConvertFrom(hub)).To(Succeed())
+		Expect(spoke.Spec.DatabaseHostRef).To(Equal("postgres"))
+		Expect(spoke.Status.CreationStatus).To(Equal("Database 'app' successfully created."))
+		Expect(spoke.Annotations).To(HaveKey(conversionDataAnnotation))
+
+		spoke.Spec.Owner = "changed"
+
+		restored := &v1beta1.Database{}
+		Expect(spoke.ConvertTo(restored)).To(Succeed())
+		Expect(restored.Annotations).NotTo(HaveKey(conversionDataAnnotation))
+		Expect(restored.Spec.Owner).To(Equal("changed"))
+		Expect(restored.Status.ObservedGeneration).To(Equal(int64(3)))
+		Expect(restored.Status.Conditions).To(Equal(hub.Status.Conditions))
+	})
+})
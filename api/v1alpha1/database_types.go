@@ -50,6 +50,7 @@ type DatabaseStatus struct {
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:deprecatedversion:warning="k8s.tuunit.com/v1alpha1 Database is deprecated; use k8s.tuunit.com/v1beta1 Database"
 
 // Database is the Schema for the databases API
 type Database struct {
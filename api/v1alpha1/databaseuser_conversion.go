@@ -0,0 +1,110 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+var _ conversion.Convertible = &DatabaseUser{}
+
+// ConvertTo converts this DatabaseUser to the Hub version (v1beta1).
+func (src *DatabaseUser) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.DatabaseUser)
+
+	restored := &v1beta1.DatabaseUser{}
+	ok, err := unmarshalData(src, restored)
+	if err != nil {
+		return err
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	removeData(dst)
+	if ok {
+		dst.Spec = restored.Spec
+		dst.Status = restored.Status
+	}
+
+	dst.Spec.Username = src.Spec.Username
+	dst.Spec.Password = src.Spec.Password
+
+	// users created through v1alpha1 never had a host, it has to be named by the annotation
+	if dst.Spec.HostRef.Name == "" {
+		dst.Spec.HostRef.Name = src.Annotations[AnnotationHostRef]
+	}
+
+	if src.Spec.PasswordSecretRef != nil {
+		if dst.Spec.PasswordSecretRef == nil {
+			dst.Spec.PasswordSecretRef = &corev1.SecretKeySelector{}
+		}
+		dst.Spec.PasswordSecretRef.Name = src.Spec.PasswordSecretRef.Name
+		dst.Spec.PasswordSecretRef.Key = src.Spec.PasswordSecretRef.Key
+	} else {
+		dst.Spec.PasswordSecretRef = nil
+	}
+
+	restoredPrivileges := dst.Spec.Privileges
+	dst.Spec.Privileges = nil
+	for i, privilege := range src.Spec.Privileges {
+		converted := v1beta1.Privilege{
+			ObjectType: privilege.ObjectType,
+			ObjectName: privilege.ObjectName,
+			Privileges: privilege.Privileges,
+		}
+		// the database of an object only exists in the hub
+		if i < len(restoredPrivileges) &&
+			restoredPrivileges[i].ObjectType == privilege.ObjectType &&
+			restoredPrivileges[i].ObjectName == privilege.ObjectName {
+			converted.Database = restoredPrivileges[i].Database
+		}
+		dst.Spec.Privileges = append(dst.Spec.Privileges, converted)
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *DatabaseUser) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.DatabaseUser)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	dst.Spec.Username = src.Spec.Username
+	dst.Spec.Password = src.Spec.Password
+
+	dst.Spec.PasswordSecretRef = nil
+	if src.Spec.PasswordSecretRef != nil {
+		dst.Spec.PasswordSecretRef = &SecretKeySelector{
+			Name: src.Spec.PasswordSecretRef.Name,
+			Key:  src.Spec.PasswordSecretRef.Key,
+		}
+	}
+
+	dst.Spec.Privileges = nil
+	for _, privilege := range src.Spec.Privileges {
+		dst.Spec.Privileges = append(dst.Spec.Privileges, Privilege{
+			ObjectType: privilege.ObjectType,
+			ObjectName: privilege.ObjectName,
+			Privileges: privilege.Privileges,
+		})
+	}
+
+	return marshalData(&v1beta1.DatabaseUser{Spec: src.Spec, Status: src.Status}, dst)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	"github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+var _ = Describe("DatabaseUser Conversion", func() {
+	It("should convert a v1alpha1 DatabaseUser to the hub", func() {
+		src := &DatabaseUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec: DatabaseUserSpec{
+				Username:          "app",
+				PasswordSecretRef: &SecretKeySelector{Name: "app-credentials", Key: "password"},
+				Privileges: []Privilege{{
+					ObjectType: "database",
+					ObjectName: "app",
+					Privileges: []string{"ALL"},
+				}},
+			},
+		}
+
+		dst := &v1beta1.DatabaseUser{}
+		Expect(src.ConvertTo(dst)).To(Succeed())
+
+		Expect(dst.Spec.Username).To(Equal("app"))
+		Expect(dst.Spec.PasswordSecretRef.Name).To(Equal("app-credentials"))
+		Expect(dst.Spec.PasswordSecretRef.Key).To(Equal("password"))
+		Expect(dst.Spec.Privileges).To(ConsistOf(v1beta1.Privilege{
+			ObjectType: "database",
+			ObjectName: "app",
+			Privileges: []string{"ALL"},
+		}))
+	})
+
+	It("should preserve hub only fields on a round trip", func() {
+		hub := &v1beta1.DatabaseUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec: v1beta1.DatabaseUserSpec{
+				Username: "app",
+				HostRef:  v1beta1.DatabaseHostReference{Name: "postgres"},
+				PasswordSecretRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "app-credentials"},
+					Key:                  "password",
+					Optional:             ptr.To(true),
+				},
+				Privileges: []v1beta1.Privilege{{
+					ObjectType: "schema",
+					ObjectName: "public",
+					Database:   "app",
+					Privileges: []string{"USAGE"},
+				}},
+			},
+		}
+
+		spoke := &DatabaseUser{}
+		Expect(spoke.ConvertFrom(hub)).To(Succeed())
+		Expect(spoke.Spec.PasswordSecretRef).To(Equal(&SecretKeySelector{Name: "app-credentials", Key: "password"}))
+
+		restored := &v1beta1.DatabaseUser{}
+		Expect(spoke.ConvertTo(restored)).To(Succeed())
+		Expect(restored.Spec).To(Equal(hub.Spec))
+	})
+
+	It("should take the host of an alpha object from the host-ref annotation", func() {
+		src := &DatabaseUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec:       DatabaseUserSpec{Username: "app", Password: "s3cr3t"},
+		}
+
+		dst := &v1beta1.DatabaseUser{}
+		Expect(src.ConvertTo(dst)).To(Succeed())
+		Expect(dst.Spec.HostRef.Name).To(BeEmpty())
+
+		src.Annotations = map[string]string{AnnotationHostRef: "postgres"}
+		Expect(src.ConvertTo(dst)).To(Succeed())
+		Expect(dst.Spec.HostRef.Name).To(Equal("postgres"))
+
+		spoke := &DatabaseUser{}
+		Expect(spoke.ConvertFrom(dst)).To(Succeed())
+		restored := &v1beta1.DatabaseUser{}
+		Expect(spoke.ConvertTo(restored)).To(Succeed())
+		Expect(restored.Spec).To(Equal(dst.Spec))
+	})
+})
@@ -77,8 +77,11 @@ type DatabaseUserStatus struct {
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:deprecatedversion:warning="k8s.tuunit.com/v1alpha1 DatabaseUser is deprecated; use k8s.tuunit.com/v1beta1 DatabaseUser"
 
-// DatabaseUser is the Schema for the databaseusers API
+// DatabaseUser is the Schema for the databaseusers API.
+// It has no reference to its DatabaseHost, which v1beta1 requires. Set the annotation
+// k8s.tuunit.com/host-ref to the name of the host before the user is read as v1beta1.
 type DatabaseUser struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
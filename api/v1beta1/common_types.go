@@ -0,0 +1,56 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+const (
+	// ConditionTypeReady indicates whether the object has been provisioned on its DatabaseHost
+	ConditionTypeReady = "Ready"
+	// ConditionTypePlanned indicates that the object was reconciled in dry-run mode and
+	// the statements which would have been executed are listed in its status
+	ConditionTypePlanned = "Planned"
+	// ConditionTypePaused indicates that the reconciliation of the object is paused
+	ConditionTypePaused = "Paused"
+	// ConditionTypeMaintenancePending indicates that operations listed in the status of the object
+	// wait for the next maintenance window of its host, the object stays usable meanwhile
+	ConditionTypeMaintenancePending = "MaintenancePending"
+)
+
+const (
+	// AnnotationAllowRename permits changing the name of a provisioned database.
+	// The database is renamed on its host after all sessions to it are terminated.
+	AnnotationAllowRename = "k8s.tuunit.com/allow-rename"
+	// AnnotationDryRun makes the operator only plan the statements for the object.
+	// The planned statements are published in its status and events without being executed.
+	AnnotationDryRun = "k8s.tuunit.com/dry-run"
+	// AnnotationPaused stops the operator from touching the object on its host
+	AnnotationPaused = "k8s.tuunit.com/paused"
+	// AnnotationTTL deletes a Database the given duration like "24h" after it was created
+	AnnotationTTL = "k8s.tuunit.com/ttl"
+	// AnnotationExpiresAt deletes a Database at the given RFC 3339 time
+	AnnotationExpiresAt = "k8s.tuunit.com/expires-at"
+)
+
+// LabelEphemeral marks a namespace whose Databases are capped to the maximum ephemeral TTL of the operator
+const LabelEphemeral = "k8s.tuunit.com/ephemeral"
+
+// DatabaseHostReference is a reference to a DatabaseHost object in the same namespace
+type DatabaseHostReference struct {
+	// Name is the name of the DatabaseHost
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+}
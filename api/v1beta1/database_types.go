@@ -0,0 +1,313 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DeletionPolicy determines what happens to a database or a user on its host when its object is deleted
+// +kubebuilder:validation:Enum=Retain;Delete
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyRetain keeps the database or the user on the host
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyDelete drops the database or the user from the host
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+)
+
+// LocaleProvider is the library providing the collation of a database
+// +kubebuilder:validation:Enum=libc;icu
+type LocaleProvider string
+
+const (
+	// LocaleProviderLibc takes the collation from the C library of the host, its names look like en_US.UTF-8
+	LocaleProviderLibc LocaleProvider = "libc"
+	// LocaleProviderICU takes the collation from the ICU library, its names are language tags like en-US
+	LocaleProviderICU LocaleProvider = "icu"
+)
+
+// DatabaseSpec defines the desired state of Database
+// +kubebuilder:validation:XValidation:rule="!has(self.localeProvider) || self.localeProvider != 'icu' || has(self.collation)",message="collation is required with the icu locale provider"
+type DatabaseSpec struct {
+	// Name is the name of the database to create
+	// Changing the name requires the k8s.tuunit.com/allow-rename annotation
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+	// Owner is the name of the user that will own the database
+	// +optional
+	Owner string `json:"owner,omitempty"`
+	// Charset is the character set for the database
+	// +optional
+	Charset string `json:"charset,omitempty"`
+	// Collation is the collation for the database, a locale of the locale provider
+	// +optional
+	Collation string `json:"collation,omitempty"`
+	// LocaleProvider is the library providing the collation on PostgreSQL 15 and later.
+	// Defaults to the provider of the template database, which usually is libc.
+	// +optional
+	LocaleProvider LocaleProvider `json:"localeProvider,omitempty"`
+
+	// DeletionPolicy determines whether the database is dropped when the Database is deleted
+	// +kubebuilder:default=Retain
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// HostRef is a reference to the DatabaseHost the database is created on
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="hostRef is immutable"
+	HostRef DatabaseHostReference `json:"hostRef"`
+
+	// Source clones the initial data of the database from a template, another Database or a backup.
+	// It only applies when the database is created on its host.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="source is immutable"
+	// +optional
+	Source *DatabaseSource `json:"source,omitempty"`
+
+	// TTL deletes the Database the given duration like "24h" after it was created.
+	// The database is only dropped from its host when the deletion policy is Delete.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// ExpiresAt deletes the Database at the given time, the earlier of ttl and expiresAt wins
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// InitScripts are executed in order inside the database as its owner once it is created
+	// and its data is cloned. Each script runs once unless its runPolicy is OnChange.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	InitScripts []InitScript `json:"initScripts,omitempty"`
+}
+
+// InitScriptRunPolicy determines when an init script is executed
+// +kubebuilder:validation:Enum=Once;OnChange
+type InitScriptRunPolicy string
+
+const (
+	// InitScriptRunOnce executes the script once, later changes of its content are ignored
+	InitScriptRunOnce InitScriptRunPolicy = "Once"
+	// InitScriptRunOnChange executes the script again whenever its content changes
+	InitScriptRunOnChange InitScriptRunPolicy = "OnChange"
+)
+
+// InitScript is a SQL script in a key of a ConfigMap or Secret, exactly one of them has to be set
+// +kubebuilder:validation:XValidation:rule="has(self.configMapKeyRef) != has(self.secretKeyRef)",message="exactly one of configMapKeyRef or secretKeyRef is required"
+type InitScript struct {
+	// Name identifies the script in the status of the database
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+	// ConfigMapKeyRef selects the key of a ConfigMap in the same namespace that contains the script
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	// SecretKeyRef selects the key of a secret in the same namespace that contains the script.
+	// Scripts from secrets are redacted in the audit log and in planned statements.
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+	// RunPolicy determines whether the script runs once or again whenever its content changes
+	// +kubebuilder:default=Once
+	// +optional
+	RunPolicy InitScriptRunPolicy `json:"runPolicy,omitempty"`
+}
+
+// InitScriptStatus records the last execution of an init script
+type InitScriptStatus struct {
+	// Name is the name of the script
+	Name string `json:"name"`
+	// Checksum is the SHA-256 checksum of the content the script was last executed with
+	Checksum string `json:"checksum"`
+	// AppliedAt is the time the script was last executed at
+	AppliedAt metav1.Time `json:"appliedAt"`
+}
+
+// DatabaseSource is where the initial data of a database is cloned from, exactly one source has to be set
+// +kubebuilder:validation:XValidation:rule="(has(self.template) ? 1 : 0) + (has(self.fromDatabase) ? 1 : 0) + (has(self.fromBackup) ? 1 : 0) == 1",message="exactly one of template, fromDatabase or fromBackup is required"
+type DatabaseSource struct {
+	// Template creates the database as a copy of another Database on the same PostgreSQL host
+	// with CREATE DATABASE ... TEMPLATE. The sessions on the template are terminated for the copy.
+	// The copy takes the charset, collation and locale provider of the template, they cannot be set.
+	// +optional
+	Template *DatabaseReference `json:"template,omitempty"`
+	// FromDatabase dumps another Database, which may be on another host of the same type,
+	// and restores the dump into the database
+	// +optional
+	FromDatabase *DatabaseReference `json:"fromDatabase,omitempty"`
+	// FromBackup restores the dump of a succeeded DatabaseBackup into the database
+	// +optional
+	FromBackup *DatabaseBackupReference `json:"fromBackup,omitempty"`
+}
+
+// CloneStatus records where the data of a database was cloned from
+type CloneStatus struct {
+	// Source is the kind and name of the source like "template/staging" or "backup/staging-1718000000"
+	Source string `json:"source"`
+	// PointInTime is the time the data of the source was captured at
+	// +optional
+	PointInTime *metav1.Time `json:"pointInTime,omitempty"`
+	// CompletionTime is the time the clone finished, it is unset while the clone is running
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// DatabaseStats are the size and the activity of a database on its host
+type DatabaseStats struct {
+	// SizeBytes is the size of the database on disk in bytes
+	SizeBytes int64 `json:"sizeBytes"`
+	// Size is the size of the database in a human readable form like "12.3Mi"
+	Size string `json:"size"`
+	// Connections is the number of sessions connected to the database
+	Connections int64 `json:"connections"`
+	// Commits is the number of committed transactions since the statistics of the host were reset.
+	// It is only collected on PostgreSQL hosts.
+	// +optional
+	Commits *int64 `json:"commits,omitempty"`
+	// Deadlocks is the number of deadlocks since the statistics of the host were reset.
+	// It is only collected on PostgreSQL hosts.
+	// +optional
+	Deadlocks *int64 `json:"deadlocks,omitempty"`
+	// CollectedAt is the time the stats were collected at
+	CollectedAt metav1.Time `json:"collectedAt"`
+}
+
+// DatabaseStatus defines the observed state of Database
+type DatabaseStatus struct {
+	// ObservedGeneration is the most recent generation observed by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Name is the name of the database as currently provisioned on the host
+	// +optional
+	Name string `json:"name,omitempty"`
+	// PreviousName is the name the database had before its last rename
+	// +optional
+	PreviousName string `json:"previousName,omitempty"`
+	// CreationTime is the time the database was created on the host
+	// +optional
+	CreationTime metav1.Time `json:"creationTime,omitempty"`
+	// Clone records where the data of the database was cloned from
+	// +optional
+	Clone *CloneStatus `json:"clone,omitempty"`
+	// ExpiresAt is the time the Database will be deleted at
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// InitScripts are the init scripts which have been executed
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	InitScripts []InitScriptStatus `json:"initScripts,omitempty"`
+	// Stats are the size and the activity of the database, they are collected periodically
+	// +optional
+	Stats *DatabaseStats `json:"stats,omitempty"`
+	// PlannedStatements are the statements the last dry run would have executed, with secrets redacted
+	// +optional
+	PlannedStatements []string `json:"plannedStatements,omitempty"`
+	// PendingOperations are the operations which wait for the next maintenance window of the host
+	// +optional
+	PendingOperations []string `json:"pendingOperations,omitempty"`
+	// Conditions represent the latest available observations of the database's state
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Database",type=string,JSONPath=`.spec.name`
+//+kubebuilder:printcolumn:name="Host",type=string,JSONPath=`.spec.hostRef.name`
+//+kubebuilder:printcolumn:name="Size",type=string,JSONPath=`.status.stats.size`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Expires",type=date,JSONPath=`.status.expiresAt`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Database is the Schema for the databases API
+type Database struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseSpec   `json:"spec,omitempty"`
+	Status DatabaseStatus `json:"status,omitempty"`
+}
+
+// RenameAllowed reports whether the database may be renamed on its host
+func (d *Database) RenameAllowed() bool {
+	return d.Annotations[AnnotationAllowRename] == "true"
+}
+
+// DryRun reports whether the statements for the database should only be planned
+func (d *Database) DryRun() bool {
+	return d.Annotations[AnnotationDryRun] == "true"
+}
+
+// Paused reports whether the reconciliation of the database is paused
+func (d *Database) Paused() bool {
+	return d.Annotations[AnnotationPaused] == "true"
+}
+
+// Expiry returns the time the Database expires at from its spec and the ttl and expires-at annotations.
+// The earliest of them wins, the zero time means the Database does not expire.
+func (d *Database) Expiry() (time.Time, error) {
+	var expiry time.Time
+	earliest := func(t time.Time) {
+		if expiry.IsZero() || t.Before(expiry) {
+			expiry = t
+		}
+	}
+
+	if d.Spec.TTL != nil {
+		earliest(d.CreationTimestamp.Add(d.Spec.TTL.Duration))
+	}
+	if d.Spec.ExpiresAt != nil {
+		earliest(d.Spec.ExpiresAt.Time)
+	}
+	if value, ok := d.Annotations[AnnotationTTL]; ok {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid %s annotation: %w", AnnotationTTL, err)
+		}
+		earliest(d.CreationTimestamp.Add(ttl))
+	}
+	if value, ok := d.Annotations[AnnotationExpiresAt]; ok {
+		expiresAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid %s annotation: %w", AnnotationExpiresAt, err)
+		}
+		earliest(expiresAt)
+	}
+
+	return expiry, nil
+}
+
+//+kubebuilder:object:root=true
+
+// DatabaseList contains a list of Database
+type DatabaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Database `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Database{}, &DatabaseList{})
+}
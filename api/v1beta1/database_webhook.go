@@ -0,0 +1,192 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	v1 "github.com/tuunit/external-database-operator/api/v1"
+)
+
+// log is for logging in this package.
+var databaselog = logf.Log.WithName("database-resource")
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks
+func (r *Database) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(&databaseDefaulter{Reader: mgr.GetAPIReader()}).
+		WithValidator(&databaseValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-k8s-tuunit-com-v1beta1-database,mutating=true,failurePolicy=fail,sideEffects=None,groups=k8s.tuunit.com,resources=databases,verbs=create;update,versions=v1beta1,name=mdatabase.kb.io,admissionReviewVersions=v1
+
+// databaseDefaulter fills the defaults of a Database from its DatabaseHost
+type databaseDefaulter struct {
+	client.Reader
+}
+
+var _ webhook.CustomDefaulter = &databaseDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type.
+// The owner defaults to the superuser of the host, charset and collation default
+// to the ones configured on the host or to the defaults of its database type
+// unless the database is cloned from a source.
+func (d *databaseDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	database, ok := obj.(*Database)
+	if !ok {
+		return fmt.Errorf("expected a Database but got a %T", obj)
+	}
+	databaselog.Info("default", "name", database.Name)
+
+	if database.Spec.HostRef.Name == "" {
+		return nil
+	}
+
+	databaseHost := &v1.DatabaseHost{}
+	if err := d.Get(ctx, client.ObjectKey{Namespace: database.Namespace, Name: database.Spec.HostRef.Name}, databaseHost); err != nil {
+		if apierrors.IsNotFound(err) {
+			// the host may be created after the database, the reconciler falls back to the same defaults
+			return nil
+		}
+		return err
+	}
+
+	if database.Spec.Owner == "" {
+		database.Spec.Owner = databaseHost.Spec.Superuser
+	}
+	// a cloned database takes the charset and collation of its source
+	if database.Spec.Source != nil {
+		return nil
+	}
+	if database.Spec.Charset == "" {
+		database.Spec.Charset = databaseHost.Spec.EffectiveCharset()
+	}
+	// the collation of the host is a libc locale, ICU locales have to be given explicitly
+	if database.Spec.Collation == "" && database.Spec.LocaleProvider != LocaleProviderICU {
+		database.Spec.Collation = databaseHost.Spec.EffectiveCollation()
+	}
+
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-k8s-tuunit-com-v1beta1-database,mutating=false,failurePolicy=fail,sideEffects=None,groups=k8s.tuunit.com,resources=databases,verbs=create;update,versions=v1beta1,name=vdatabase.kb.io,admissionReviewVersions=v1
+
+// databaseValidator guards changes of a Database which cannot be reconciled safely
+type databaseValidator struct{}
+
+var _ webhook.CustomValidator = &databaseValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type.
+// A copy of a template takes the charset, collation and locale provider of the template.
+func (v *databaseValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	database, ok := obj.(*Database)
+	if !ok {
+		return nil, fmt.Errorf("expected a Database but got a %T", obj)
+	}
+	databaselog.Info("validate create", "name", database.Name)
+
+	if err := validateTemplateLocale(database); err != nil {
+		return nil, err
+	}
+
+	return validateExpiry(database)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type.
+// Renaming a database is only allowed when explicitly requested through the allow-rename annotation.
+func (v *databaseValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldDatabase, ok := oldObj.(*Database)
+	if !ok {
+		return nil, fmt.Errorf("expected a Database but got a %T", oldObj)
+	}
+	database, ok := newObj.(*Database)
+	if !ok {
+		return nil, fmt.Errorf("expected a Database but got a %T", newObj)
+	}
+	databaselog.Info("validate update", "name", database.Name)
+
+	if oldDatabase.Spec.Name != database.Spec.Name && !database.RenameAllowed() {
+		return nil, apierrors.NewInvalid(GroupVersion.WithKind("Database").GroupKind(), database.Name, field.ErrorList{
+			field.Forbidden(field.NewPath("spec", "name"),
+				fmt.Sprintf("renaming a database requires the annotation %s: \"true\"", AnnotationAllowRename)),
+		})
+	}
+
+	return validateExpiry(database)
+}
+
+// validateTemplateLocale rejects a charset, collation or locale provider on a copy of a template,
+// PostgreSQL fails to copy a template with another locale than its own
+func validateTemplateLocale(database *Database) error {
+	if database.Spec.Source == nil || database.Spec.Source.Template == nil {
+		return nil
+	}
+
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+	message := "cannot be set together with source.template, the copy takes it from the template"
+	if database.Spec.Charset != "" {
+		errs = append(errs, field.Forbidden(spec.Child("charset"), message))
+	}
+	if database.Spec.Collation != "" {
+		errs = append(errs, field.Forbidden(spec.Child("collation"), message))
+	}
+	if database.Spec.LocaleProvider != "" {
+		errs = append(errs, field.Forbidden(spec.Child("localeProvider"), message))
+	}
+	if len(errs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("Database").GroupKind(), database.Name, errs)
+	}
+
+	return nil
+}
+
+// validateExpiry rejects malformed ttl and expires-at annotations and warns when an expiring
+// Database retains its database on the host, which is then left behind after the deletion
+func validateExpiry(database *Database) (admission.Warnings, error) {
+	expiry, err := database.Expiry()
+	if err != nil {
+		return nil, apierrors.NewInvalid(GroupVersion.WithKind("Database").GroupKind(), database.Name, field.ErrorList{
+			field.Invalid(field.NewPath("metadata", "annotations"), database.Annotations, err.Error()),
+		})
+	}
+
+	if !expiry.IsZero() && database.Spec.DeletionPolicy != DeletionPolicyDelete {
+		return admission.Warnings{
+			"the Database expires but its deletionPolicy is not Delete, the database is kept on the host",
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *databaseValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+)
+
+var _ = Describe("Database Webhook", func() {
+
+	Context("When creating Database under Defaulting Webhook", func() {
+		It("Should fill in the defaults from the DatabaseHost", func() {
+			databaseHost := &k8sv1.DatabaseHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "defaults-host", Namespace: "default"},
+				Spec: k8sv1.DatabaseHostSpec{
+					Host:      "postgres.example.com",
+					Type:      k8sv1.Postgres,
+					Superuser: "postgres",
+					Collation: "C.UTF-8",
+				},
+			}
+			Expect(k8sClient.Create(ctx, databaseHost)).To(Succeed())
+
+			database := &Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "defaults", Namespace: "default"},
+				Spec: DatabaseSpec{
+					Name:    "defaults",
+					HostRef: DatabaseHostReference{Name: databaseHost.Name},
+				},
+			}
+			Expect(k8sClient.Create(ctx, database)).To(Succeed())
+
+			Expect(database.Spec.Owner).To(Equal("postgres"))
+			Expect(database.Spec.Charset).To(Equal("UTF8"))
+			Expect(database.Spec.Collation).To(Equal("C.UTF-8"))
+		})
+
+		It("Should require the collation with the icu locale provider", func() {
+			databaseHost := &k8sv1.DatabaseHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "icu-host", Namespace: "default"},
+				Spec: k8sv1.DatabaseHostSpec{
+					Host:      "postgres.example.com",
+					Type:      k8sv1.Postgres,
+					Superuser: "postgres",
+				},
+			}
+			Expect(k8sClient.Create(ctx, databaseHost)).To(Succeed())
+
+			database := &Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "icu", Namespace: "default"},
+				Spec: DatabaseSpec{
+					Name:           "icu",
+					LocaleProvider: LocaleProviderICU,
+					HostRef:        DatabaseHostReference{Name: databaseHost.Name},
+				},
+			}
+			Expect(k8sClient.Create(ctx, database)).To(MatchError(ContainSubstring("collation is required")))
+
+			database.Spec.Collation = "de-DE"
+			Expect(k8sClient.Create(ctx, database)).To(Succeed())
+			Expect(database.Spec.Collation).To(Equal("de-DE"))
+		})
+
+		It("Should not default the charset and collation of a cloned database", func() {
+			databaseHost := &k8sv1.DatabaseHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "clone-host", Namespace: "default"},
+				Spec: k8sv1.DatabaseHostSpec{
+					Host:      "postgres.example.com",
+					Type:      k8sv1.Postgres,
+					Superuser: "postgres",
+					Collation: "C.UTF-8",
+				},
+			}
+			Expect(k8sClient.Create(ctx, databaseHost)).To(Succeed())
+
+			database := &Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "clone", Namespace: "default"},
+				Spec: DatabaseSpec{
+					Name:    "clone",
+					HostRef: DatabaseHostReference{Name: databaseHost.Name},
+					Source:  &DatabaseSource{Template: &DatabaseReference{Name: "staging"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, database)).To(Succeed())
+
+			Expect(database.Spec.Owner).To(Equal("postgres"))
+			Expect(database.Spec.Charset).To(BeEmpty())
+			Expect(database.Spec.Collation).To(BeEmpty())
+		})
+
+		It("Should deny a charset, collation or locale provider on a copy of a template", func() {
+			database := &Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "template-locale", Namespace: "default"},
+				Spec: DatabaseSpec{
+					Name:           "copy",
+					Collation:      "de-DE",
+					LocaleProvider: LocaleProviderICU,
+					HostRef:        DatabaseHostReference{Name: "missing"},
+					Source:         &DatabaseSource{Template: &DatabaseReference{Name: "staging"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, database)).To(MatchError(ContainSubstring("cannot be set together with source.template")))
+
+			database.Spec.Collation = ""
+			database.Spec.LocaleProvider = ""
+			Expect(k8sClient.Create(ctx, database)).To(Succeed())
+		})
+
+		It("Should leave the spec untouched when the DatabaseHost does not exist", func() {
+			database := &Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "default"},
+				Spec: DatabaseSpec{
+					Name:    "orphan",
+					HostRef: DatabaseHostReference{Name: "missing"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, database)).To(Succeed())
+
+			Expect(database.Spec.Owner).To(BeEmpty())
+			Expect(database.Spec.Charset).To(BeEmpty())
+			Expect(database.Spec.Collation).To(BeEmpty())
+		})
+	})
+
+	Context("When updating Database under Validating Webhook", func() {
+		It("Should deny renaming without the allow-rename annotation", func() {
+			database := &Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "rename-denied", Namespace: "default"},
+				Spec: DatabaseSpec{
+					Name:    "before",
+					HostRef: DatabaseHostReference{Name: "missing"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, database)).To(Succeed())
+
+			database.Spec.Name = "after"
+			Expect(k8sClient.Update(ctx, database)).NotTo(Succeed())
+		})
+
+		It("Should admit renaming with the allow-rename annotation", func() {
+			database := &Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "rename-allowed", Namespace: "default"},
+				Spec: DatabaseSpec{
+					Name:    "before",
+					HostRef: DatabaseHostReference{Name: "missing"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, database)).To(Succeed())
+
+			database.Annotations = map[string]string{AnnotationAllowRename: "true"}
+			database.Spec.Name = "after"
+			Expect(k8sClient.Update(ctx, database)).To(Succeed())
+		})
+
+		It("Should deny changing the host reference", func() {
+			database := &Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "host-immutable", Namespace: "default"},
+				Spec: DatabaseSpec{
+					Name:    "immutable",
+					HostRef: DatabaseHostReference{Name: "missing"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, database)).To(Succeed())
+
+			database.Spec.HostRef.Name = "other"
+			Expect(k8sClient.Update(ctx, database)).NotTo(Succeed())
+		})
+
+		It("Should deny a malformed ttl annotation", func() {
+			database := &Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "ttl-invalid", Namespace: "default"},
+				Spec: DatabaseSpec{
+					Name:    "ttl",
+					HostRef: DatabaseHostReference{Name: "missing"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, database)).To(Succeed())
+
+			database.Annotations = map[string]string{AnnotationTTL: "one day"}
+			Expect(k8sClient.Update(ctx, database)).NotTo(Succeed())
+		})
+	})
+
+})
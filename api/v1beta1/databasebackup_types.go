@@ -0,0 +1,180 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/tuunit/external-database-operator/api/v1"
+)
+
+// BackupPhase is the lifecycle phase of a DatabaseBackup
+// +kubebuilder:validation:Enum=Pending;Running;Succeeded;Failed
+type BackupPhase string
+
+const (
+	// BackupPhasePending means the Job of the backup was not started yet
+	BackupPhasePending BackupPhase = "Pending"
+	// BackupPhaseRunning means the Job of the backup is dumping the database
+	BackupPhaseRunning BackupPhase = "Running"
+	// BackupPhaseSucceeded means the dump is stored
+	BackupPhaseSucceeded BackupPhase = "Succeeded"
+	// BackupPhaseFailed means the Job of the backup failed
+	BackupPhaseFailed BackupPhase = "Failed"
+)
+
+// DatabaseReference is a reference to a Database object in the same namespace
+type DatabaseReference struct {
+	// Name is the name of the Database
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+}
+
+// BackupStorage is where the compressed dumps are stored, exactly one location has to be set
+// +kubebuilder:validation:XValidation:rule="has(self.persistentVolumeClaim) != has(self.s3)",message="exactly one of persistentVolumeClaim or s3 is required"
+type BackupStorage struct {
+	// PersistentVolumeClaim stores the dumps on an existing claim in the same namespace
+	// +optional
+	PersistentVolumeClaim *PersistentVolumeClaimStorage `json:"persistentVolumeClaim,omitempty"`
+	// S3 stores the dumps in a bucket of an S3-compatible object store
+	// +optional
+	S3 *S3Storage `json:"s3,omitempty"`
+}
+
+// PersistentVolumeClaimStorage stores dumps on a PersistentVolumeClaim
+type PersistentVolumeClaimStorage struct {
+	// ClaimName is the name of the PersistentVolumeClaim
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	ClaimName string `json:"claimName"`
+	// Path is the directory on the volume the dumps are stored in
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// S3Storage stores dumps in a bucket of an S3-compatible object store like MinIO
+type S3Storage struct {
+	// Endpoint is the URL of the object store like https://s3.eu-central-1.amazonaws.com
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Endpoint string `json:"endpoint"`
+	// Bucket is the name of the bucket
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Bucket string `json:"bucket"`
+	// Prefix is prepended to the keys of the dumps
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// CredentialsSecretRef is a reference to a secret in the same namespace with the keys
+	// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	CredentialsSecretRef string `json:"credentialsSecretRef"`
+}
+
+// DatabaseBackupSpec defines the desired state of DatabaseBackup
+type DatabaseBackupSpec struct {
+	// DatabaseRef is a reference to the Database to back up
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="databaseRef is immutable"
+	DatabaseRef DatabaseReference `json:"databaseRef"`
+	// Storage is where the dump is stored
+	// +kubebuilder:validation:Required
+	Storage BackupStorage `json:"storage"`
+	// Image is the image providing the dump tool of the database engine,
+	// defaults to the official image of the engine
+	// +optional
+	Image string `json:"image,omitempty"`
+	// UploadImage is the image providing the MinIO client for uploads to S3
+	// +optional
+	UploadImage string `json:"uploadImage,omitempty"`
+	// DeletionPolicy determines whether the dump is removed from the storage when the DatabaseBackup is deleted
+	// +kubebuilder:default=Retain
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// DatabaseBackupStatus defines the observed state of DatabaseBackup
+type DatabaseBackupStatus struct {
+	// Phase is the lifecycle phase of the backup
+	// +optional
+	Phase BackupPhase `json:"phase,omitempty"`
+	// JobName is the name of the Job dumping the database
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+	// StartTime is the time the Job was created
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time the dump was stored
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Location is the path on the volume or the URL in the object store of the dump
+	// +optional
+	Location string `json:"location,omitempty"`
+	// Size is the size of the compressed dump in bytes
+	// +optional
+	Size int64 `json:"size,omitempty"`
+	// Checksum is the SHA-256 checksum of the compressed dump
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
+	// DatabaseType is the type of the host the dump was taken from, which selects the image
+	// removing the dump even after the database or its host are gone
+	// +optional
+	DatabaseType v1.DatabaseType `json:"databaseType,omitempty"`
+	// Conditions represent the latest available observations of the backup's state
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Database",type=string,JSONPath=`.spec.databaseRef.name`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Size",type=integer,JSONPath=`.status.size`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DatabaseBackup is the Schema for the databasebackups API.
+// Only databases on PostgreSQL hosts can be backed up for now, backups of
+// databases on MySQL hosts fail right away.
+type DatabaseBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseBackupSpec   `json:"spec,omitempty"`
+	Status DatabaseBackupStatus `json:"status,omitempty"`
+}
+
+// Finished reports whether the backup succeeded or failed for good
+func (b *DatabaseBackup) Finished() bool {
+	return b.Status.Phase == BackupPhaseSucceeded || b.Status.Phase == BackupPhaseFailed
+}
+
+//+kubebuilder:object:root=true
+
+// DatabaseBackupList contains a list of DatabaseBackup
+type DatabaseBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseBackup{}, &DatabaseBackupList{})
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LabelBackupSchedule is set on the DatabaseBackups created by a DatabaseBackupSchedule to its name
+const LabelBackupSchedule = "k8s.tuunit.com/backup-schedule"
+
+// BackupRetention decides which backups of a schedule are kept.
+// Backups are deleted with their DatabaseBackup objects, so their dumps are only
+// removed from the storage if the template sets the deletion policy to Delete.
+type BackupRetention struct {
+	// KeepLast is the number of the most recent successful backups to keep
+	// +kubebuilder:default=7
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	KeepLast int32 `json:"keepLast,omitempty"`
+	// MaxAge deletes successful backups older than the duration like "720h",
+	// the most recent successful backup is always kept
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+	// KeepFailed is the number of the most recent failed backups to keep for troubleshooting
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	KeepFailed int32 `json:"keepFailed,omitempty"`
+}
+
+// DatabaseBackupScheduleSpec defines the desired state of DatabaseBackupSchedule
+type DatabaseBackupScheduleSpec struct {
+	// Schedule is a cron expression like "0 3 * * *" for the creation of the backups.
+	// It is evaluated in the time zone of the operator unless prefixed with CRON_TZ=<zone>.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Schedule string `json:"schedule"`
+	// Suspend stops the creation of further backups
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+	// Template is the spec of the DatabaseBackups created by the schedule
+	// +kubebuilder:validation:Required
+	Template DatabaseBackupSpec `json:"template"`
+	// Retention decides which backups of the schedule are kept
+	// +optional
+	Retention BackupRetention `json:"retention,omitempty"`
+}
+
+// DatabaseBackupScheduleStatus defines the observed state of DatabaseBackupSchedule
+type DatabaseBackupScheduleStatus struct {
+	// LastScheduleTime is the time the latest backup was scheduled at
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// NextScheduleTime is the time the next backup is scheduled at
+	// +optional
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+	// LastSuccessfulBackup is the name of the most recent successful DatabaseBackup
+	// +optional
+	LastSuccessfulBackup string `json:"lastSuccessfulBackup,omitempty"`
+	// Conditions represent the latest available observations of the schedule's state
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Database",type=string,JSONPath=`.spec.template.databaseRef.name`
+//+kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+//+kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+//+kubebuilder:printcolumn:name="Last Schedule",type=date,JSONPath=`.status.lastScheduleTime`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DatabaseBackupSchedule is the Schema for the databasebackupschedules API.
+// Like DatabaseBackup, it only supports databases on PostgreSQL hosts for now.
+type DatabaseBackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseBackupScheduleSpec   `json:"spec,omitempty"`
+	Status DatabaseBackupScheduleStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DatabaseBackupScheduleList contains a list of DatabaseBackupSchedule
+type DatabaseBackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseBackupSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseBackupSchedule{}, &DatabaseBackupScheduleList{})
+}
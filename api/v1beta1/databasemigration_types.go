@@ -0,0 +1,168 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MigrationPhase is the lifecycle phase of a DatabaseMigration
+// +kubebuilder:validation:Enum=Pending;Running;Succeeded;Failed
+type MigrationPhase string
+
+const (
+	// MigrationPhasePending means the target database or the migrations are not ready yet
+	MigrationPhasePending MigrationPhase = "Pending"
+	// MigrationPhaseRunning means migrations are being applied
+	MigrationPhaseRunning MigrationPhase = "Running"
+	// MigrationPhaseSucceeded means the database is at the target version
+	MigrationPhaseSucceeded MigrationPhase = "Succeeded"
+	// MigrationPhaseFailed means a migration failed or the applied ones do not match the source anymore
+	MigrationPhaseFailed MigrationPhase = "Failed"
+)
+
+// DefaultMigrationTable is the tracking table of the applied migrations if none is set
+const DefaultMigrationTable = "schema_migrations"
+
+// MigrationSource is where the migrations are read from, exactly one source has to be set.
+// Each migration is named like "0001_create_users.up.sql", the number is its version.
+// Down migrations and other files are ignored. Each migration runs in one transaction
+// together with its record in the tracking table, so it must not control transactions itself.
+// +kubebuilder:validation:XValidation:rule="has(self.configMap) != has(self.oci)",message="exactly one of configMap or oci is required"
+type MigrationSource struct {
+	// ConfigMap holds one migration per key
+	// +optional
+	ConfigMap *corev1.LocalObjectReference `json:"configMap,omitempty"`
+	// OCI is an artifact in an OCI registry holding one migration per layer, named by the
+	// org.opencontainers.image.title annotation of the layer like the files pushed by oras
+	// +optional
+	OCI *OCIArtifactSource `json:"oci,omitempty"`
+}
+
+// OCIArtifactSource is an artifact in an OCI registry
+type OCIArtifactSource struct {
+	// Reference is the reference of the artifact like "ghcr.io/acme/app-migrations:v3".
+	// Artifacts referenced by a tag are pulled again periodically, so migrations pushed to
+	// the tag later are applied. Artifacts referenced by a digest are pulled once.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Reference string `json:"reference"`
+	// PullSecret is a secret of type kubernetes.io/dockerconfigjson in the same namespace
+	// holding the credentials of the registry, the artifact is pulled anonymously without it
+	// +optional
+	PullSecret *corev1.LocalObjectReference `json:"pullSecret,omitempty"`
+	// PlainHTTP pulls the artifact over HTTP instead of HTTPS, for registries inside the cluster
+	// +optional
+	PlainHTTP bool `json:"plainHTTP,omitempty"`
+}
+
+// DatabaseMigrationSpec defines the desired state of DatabaseMigration
+type DatabaseMigrationSpec struct {
+	// DatabaseRef is a reference to the Database the migrations are applied to
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="databaseRef is immutable"
+	DatabaseRef DatabaseReference `json:"databaseRef"`
+	// Source is where the migrations are read from
+	// +kubebuilder:validation:Required
+	Source MigrationSource `json:"source"`
+	// TargetVersion is the version the database is migrated to, defaults to the latest migration.
+	// Down migrations are not supported, a target below the applied version is refused.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TargetVersion *int64 `json:"targetVersion,omitempty"`
+	// Table is the tracking table of the applied migrations, optionally qualified by its schema
+	// +kubebuilder:default=schema_migrations
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="table is immutable"
+	// +optional
+	Table string `json:"table,omitempty"`
+}
+
+// AppliedMigration is a migration recorded in the tracking table
+type AppliedMigration struct {
+	// Version is the version of the migration
+	Version int64 `json:"version"`
+	// Name is the name of the migration without its version and extension
+	Name string `json:"name"`
+	// Checksum is the SHA-256 checksum of the migration when it was applied
+	Checksum string `json:"checksum"`
+	// AppliedAt is the time the migration was applied at
+	// +optional
+	AppliedAt *metav1.Time `json:"appliedAt,omitempty"`
+}
+
+// DatabaseMigrationStatus defines the observed state of DatabaseMigration
+type DatabaseMigrationStatus struct {
+	// Phase is the lifecycle phase of the migration
+	// +optional
+	Phase MigrationPhase `json:"phase,omitempty"`
+	// CurrentVersion is the version of the latest applied migration
+	// +optional
+	CurrentVersion int64 `json:"currentVersion,omitempty"`
+	// AppliedVersions are the migrations recorded in the tracking table
+	// +optional
+	AppliedVersions []AppliedMigration `json:"appliedVersions,omitempty"`
+	// PendingVersions are the versions up to the target which have not been applied yet
+	// +optional
+	PendingVersions []int64 `json:"pendingVersions,omitempty"`
+	// ArtifactDigest is the digest of the OCI artifact the migrations were last read from
+	// +optional
+	ArtifactDigest string `json:"artifactDigest,omitempty"`
+	// Conditions represent the latest available observations of the migration's progress
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Database",type=string,JSONPath=`.spec.databaseRef.name`
+//+kubebuilder:printcolumn:name="Version",type=integer,JSONPath=`.status.currentVersion`
+//+kubebuilder:printcolumn:name="Target",type=integer,JSONPath=`.spec.targetVersion`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DatabaseMigration is the Schema for the databasemigrations API
+type DatabaseMigration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseMigrationSpec   `json:"spec,omitempty"`
+	Status DatabaseMigrationStatus `json:"status,omitempty"`
+}
+
+// TrackingTable returns the tracking table of the applied migrations
+func (m *DatabaseMigration) TrackingTable() string {
+	if m.Spec.Table == "" {
+		return DefaultMigrationTable
+	}
+	return m.Spec.Table
+}
+
+//+kubebuilder:object:root=true
+
+// DatabaseMigrationList contains a list of DatabaseMigration
+type DatabaseMigrationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseMigration `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseMigration{}, &DatabaseMigrationList{})
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RestorePhase is the lifecycle phase of a DatabaseRestore
+// +kubebuilder:validation:Enum=Pending;Running;Succeeded;Failed
+type RestorePhase string
+
+const (
+	// RestorePhasePending means the backup or the target database are not ready yet
+	RestorePhasePending RestorePhase = "Pending"
+	// RestorePhaseRunning means the Job of the restore is loading the dump
+	RestorePhaseRunning RestorePhase = "Running"
+	// RestorePhaseSucceeded means the dump was loaded into the target database
+	RestorePhaseSucceeded RestorePhase = "Succeeded"
+	// RestorePhaseFailed means the restore was refused or its Job failed
+	RestorePhaseFailed RestorePhase = "Failed"
+)
+
+const (
+	// ConditionTypeBackupAvailable indicates whether the referenced backup succeeded and its dump can be read
+	ConditionTypeBackupAvailable = "BackupAvailable"
+	// ConditionTypeTargetReady indicates whether the target database is provisioned and may be restored into
+	ConditionTypeTargetReady = "TargetReady"
+)
+
+// DatabaseBackupReference is a reference to a DatabaseBackup object in the same namespace
+type DatabaseBackupReference struct {
+	// Name is the name of the DatabaseBackup
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+}
+
+// DatabaseRestoreSpec defines the desired state of DatabaseRestore
+type DatabaseRestoreSpec struct {
+	// BackupRef is a reference to the succeeded DatabaseBackup whose dump is restored
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="backupRef is immutable"
+	BackupRef DatabaseBackupReference `json:"backupRef"`
+	// DatabaseRef is a reference to the Database the dump is restored into. It may be another
+	// Database than the one which was backed up, the restore waits until it is provisioned.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="databaseRef is immutable"
+	DatabaseRef DatabaseReference `json:"databaseRef"`
+	// RemapOwner makes the owner of the target Database the owner of all restored objects
+	// instead of the roles owning them in the backed up database
+	// +optional
+	RemapOwner bool `json:"remapOwner,omitempty"`
+	// Force restores into a database which already contains objects, replacing the objects of the dump
+	// +optional
+	Force bool `json:"force,omitempty"`
+	// Image is the image providing the restore tool of the database engine,
+	// defaults to the official image of the engine
+	// +optional
+	Image string `json:"image,omitempty"`
+	// DownloadImage is the image providing the MinIO client for downloads from S3
+	// +optional
+	DownloadImage string `json:"downloadImage,omitempty"`
+}
+
+// DatabaseRestoreStatus defines the observed state of DatabaseRestore
+type DatabaseRestoreStatus struct {
+	// Phase is the lifecycle phase of the restore
+	// +optional
+	Phase RestorePhase `json:"phase,omitempty"`
+	// JobName is the name of the Job restoring the dump
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+	// StartTime is the time the Job was created
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time the restore succeeded or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Conditions represent the latest available observations of the restore's progress
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Backup",type=string,JSONPath=`.spec.backupRef.name`
+//+kubebuilder:printcolumn:name="Database",type=string,JSONPath=`.spec.databaseRef.name`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DatabaseRestore is the Schema for the databaserestores API
+type DatabaseRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseRestoreSpec   `json:"spec,omitempty"`
+	Status DatabaseRestoreStatus `json:"status,omitempty"`
+}
+
+// Finished reports whether the restore succeeded or failed for good
+func (r *DatabaseRestore) Finished() bool {
+	return r.Status.Phase == RestorePhaseSucceeded || r.Status.Phase == RestorePhaseFailed
+}
+
+//+kubebuilder:object:root=true
+
+// DatabaseRestoreList contains a list of DatabaseRestore
+type DatabaseRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseRestore{}, &DatabaseRestoreList{})
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ACL for PostgreSQL
+// https://www.postgresql.org/docs/15/ddl-priv.html
+// ACL for MySQL
+// https://dev.mysql.com/doc/refman/8.3/en/grant.html
+type Privilege struct {
+	// The type of object for which to grant privileges
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	ObjectType string `json:"objectType"`
+	// The name of the object for which to grant privileges
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	ObjectName string `json:"objectName"`
+	// The database containing the object, required for objects other than databases
+	// +optional
+	Database string `json:"database,omitempty"`
+	// The list of privileges to grant
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:Required
+	Privileges []string `json:"privileges"`
+}
+
+// DatabaseUserSpec defines the desired state of DatabaseUser
+type DatabaseUserSpec struct {
+	// Username is the name of the user to create
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Username string `json:"username"`
+	// HostRef is a reference to the DatabaseHost the user is created on
+	// +kubebuilder:validation:Required
+	HostRef DatabaseHostReference `json:"hostRef"`
+	// Password is the password for the user
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	Password string `json:"password,omitempty"`
+	// PasswordSecretRef selects the key of a secret in the same namespace that contains the password
+	// +optional
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+	// DeletionPolicy determines whether the user is dropped when the DatabaseUser is deleted.
+	// Before the user is dropped, the objects it owns are handed over to the superuser of the host.
+	// +kubebuilder:default=Retain
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// Privileges is a list of privileges to grant to the user
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:Required
+	Privileges []Privilege `json:"privileges"`
+}
+
+// DatabaseUserStatus defines the observed state of DatabaseUser
+type DatabaseUserStatus struct {
+	// ObservedGeneration is the most recent generation observed by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// PasswordDigest is a salted HMAC-SHA256 digest of the applied password, so rotations are
+	// detected by the content of the password without revealing it
+	// +optional
+	PasswordDigest string `json:"passwordDigest,omitempty"`
+	// Privileges is the list of privileges granted to the user
+	// +optional
+	Privileges []Privilege `json:"privileges,omitempty"`
+	// PlannedStatements are the statements the last dry run would have executed, with secrets redacted
+	// +optional
+	PlannedStatements []string `json:"plannedStatements,omitempty"`
+	// PendingOperations are the operations which wait for the next maintenance window of the host
+	// +optional
+	PendingOperations []string `json:"pendingOperations,omitempty"`
+	// Conditions represent the latest available observations of the user's state
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Username",type=string,JSONPath=`.spec.username`
+//+kubebuilder:printcolumn:name="Host",type=string,JSONPath=`.spec.hostRef.name`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DatabaseUser is the Schema for the databaseusers API
+type DatabaseUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseUserSpec   `json:"spec,omitempty"`
+	Status DatabaseUserStatus `json:"status,omitempty"`
+}
+
+// DryRun reports whether the statements for the user should only be planned
+func (u *DatabaseUser) DryRun() bool {
+	return u.Annotations[AnnotationDryRun] == "true"
+}
+
+// Paused reports whether the reconciliation of the user is paused
+func (u *DatabaseUser) Paused() bool {
+	return u.Annotations[AnnotationPaused] == "true"
+}
+
+//+kubebuilder:object:root=true
+
+// DatabaseUserList contains a list of DatabaseUser
+type DatabaseUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseUser{}, &DatabaseUserList{})
+}
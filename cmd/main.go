@@ -17,26 +17,41 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
 	k8sv1alpha1 "github.com/tuunit/external-database-operator/api/v1alpha1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/audit"
+	"github.com/tuunit/external-database-operator/internal/config"
 	"github.com/tuunit/external-database-operator/internal/controller"
+	internalmetrics "github.com/tuunit/external-database-operator/internal/metrics"
+	"github.com/tuunit/external-database-operator/internal/provider"
+	"github.com/tuunit/external-database-operator/internal/sharding"
+	"github.com/tuunit/external-database-operator/internal/tracing"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -50,6 +65,7 @@ func init() {
 
 	utilruntime.Must(k8sv1.AddToScheme(scheme))
 	utilruntime.Must(k8sv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(k8sv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -59,6 +75,11 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var dryRun bool
+	var watchNamespaces string
+	var labelSelector string
+	var configFile string
+	var maxEphemeralTTL time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
@@ -68,14 +89,52 @@ func main() {
 		"If set the metrics endpoint is served securely")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"If set, statements are only planned and published in the status and events of the objects instead of being executed")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma separated list of namespaces the operator watches, all namespaces if empty. "+
+			"Restricting the namespaces allows running the operator with namespaced RBAC only")
+	flag.StringVar(&labelSelector, "label-selector", "",
+		"Label selector for the DatabaseHosts, Databases and DatabaseUsers the operator reconciles, "+
+			"objects not matching it are ignored entirely")
+	flag.StringVar(&configFile, "config", "",
+		"Path to a config file tuning the controllers, its settings take precedence over the flags")
+	flag.DurationVar(&maxEphemeralTTL, "max-ephemeral-ttl", 0,
+		"Maximum lifetime of Databases in namespaces labeled k8s.tuunit.com/ephemeral=true, "+
+			"longer or missing TTLs are capped to it. Needs get on namespaces cluster-wide. Zero disables the cap")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
+	var tracingOpts tracing.Options
+	tracingOpts.BindFlags(flag.CommandLine)
+	var auditOpts audit.Options
+	auditOpts.BindFlags(flag.CommandLine)
+	var poolOpts provider.PoolOptions
+	poolOpts.BindFlags(flag.CommandLine)
+	var shardOpts sharding.Options
+	shardOpts.BindFlags(flag.CommandLine)
+	var controllerConfig config.Config
+	controllerConfig.BindFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if configFile != "" {
+		if err := controllerConfig.Load(configFile); err != nil {
+			setupLog.Error(err, "unable to load config file")
+			os.Exit(1)
+		}
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracingOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancelation and
@@ -96,8 +155,16 @@ func main() {
 		TLSOpts: tlsOpts,
 	})
 
+	cacheOpts, err := cacheOptions(watchNamespaces, labelSelector)
+	if err != nil {
+		setupLog.Error(err, "unable to set up the cache")
+		os.Exit(1)
+	}
+	cacheOpts.SyncPeriod = &controllerConfig.ResyncPeriod.Duration
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
+		Cache:  cacheOpts,
 		Metrics: metricsserver.Options{
 			BindAddress:   metricsAddr,
 			SecureServing: secureMetrics,
@@ -124,29 +191,137 @@ func main() {
 		os.Exit(1)
 	}
 
+	auditSink, closeAudit, err := audit.NewSink(auditOpts, ctrl.Log.WithName("audit"), mgr.GetAPIReader(), mgr.GetClient())
+	if err != nil {
+		setupLog.Error(err, "unable to set up audit log")
+		os.Exit(1)
+	}
+
+	pools := provider.NewPools(poolOpts)
+	slots := controller.NewHostSlots(controllerConfig.MaxConcurrentReconcilesPerHost)
+
+	shards, err := sharding.New(shardOpts, mgr.GetAPIReader(), mgr.GetClient(), mgr.GetClient())
+	if err != nil {
+		setupLog.Error(err, "unable to set up sharding")
+		os.Exit(1)
+	}
+	if shards != nil {
+		// every replica reconciles its own shards, electing a single leader would defeat that
+		if enableLeaderElection {
+			setupLog.Error(nil, "sharding and leader election cannot be enabled together")
+			os.Exit(1)
+		}
+		if err := mgr.Add(shards); err != nil {
+			setupLog.Error(err, "unable to set up sharding")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controller.DatabaseHostReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   tracing.Client(mgr.GetClient()),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("databasehost-controller"),
+		Audit:    auditSink,
+		Pools:    pools,
+		Shards:   shards,
+		Options:  controllerConfig.For(config.DatabaseHost).Options(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DatabaseHost")
 		os.Exit(1)
 	}
 	if err = (&controller.DatabaseReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   tracing.Client(mgr.GetClient()),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("database-controller"),
+		Audit:    auditSink,
+		Pools:    pools,
+		Shards:   shards,
+		Options:  controllerConfig.For(config.Database).Options(),
+		Slots:    slots,
+		DryRun:   dryRun,
+
+		MaxEphemeralTTL: maxEphemeralTTL,
+		APIReader:       mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Database")
 		os.Exit(1)
 	}
 	if err = (&controller.DatabaseUserReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   tracing.Client(mgr.GetClient()),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("databaseuser-controller"),
+		Audit:    auditSink,
+		Pools:    pools,
+		Shards:   shards,
+		Options:  controllerConfig.For(config.DatabaseUser).Options(),
+		Slots:    slots,
+		DryRun:   dryRun,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DatabaseUser")
 		os.Exit(1)
 	}
+	if err = (&controller.DatabaseBackupReconciler{
+		Client:    tracing.Client(mgr.GetClient()),
+		Scheme:    mgr.GetScheme(),
+		Recorder:  mgr.GetEventRecorderFor("databasebackup-controller"),
+		APIReader: mgr.GetAPIReader(),
+		Shards:    shards,
+		Options:   controllerConfig.For(config.DatabaseBackup).Options(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DatabaseBackup")
+		os.Exit(1)
+	}
+	if err = (&controller.DatabaseBackupScheduleReconciler{
+		Client:   tracing.Client(mgr.GetClient()),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("databasebackupschedule-controller"),
+		Options:  controllerConfig.For(config.DatabaseBackupSchedule).Options(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DatabaseBackupSchedule")
+		os.Exit(1)
+	}
+	if err = (&controller.DatabaseRestoreReconciler{
+		Client:   tracing.Client(mgr.GetClient()),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("databaserestore-controller"),
+		Audit:    auditSink,
+		Pools:    pools,
+		Shards:   shards,
+		Options:  controllerConfig.For(config.DatabaseRestore).Options(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DatabaseRestore")
+		os.Exit(1)
+	}
+	if err = (&controller.DatabaseMigrationReconciler{
+		Client:   tracing.Client(mgr.GetClient()),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("databasemigration-controller"),
+		Audit:    auditSink,
+		Pools:    pools,
+		Shards:   shards,
+		Options:  controllerConfig.For(config.DatabaseMigration).Options(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DatabaseMigration")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&k8sv1.DatabaseHost{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DatabaseHost")
+			os.Exit(1)
+		}
+		if err = (&k8sv1beta1.Database{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Database")
+			os.Exit(1)
+		}
+		if err = (&k8sv1beta1.DatabaseUser{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DatabaseUser")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
+	metrics.Registry.MustRegister(internalmetrics.NewManagedCollector(mgr.GetClient()))
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -157,8 +332,51 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctx)
+
+	// flush the spans which have not been exported yet
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "unable to shut down tracing")
+	}
+	if err := closeAudit(); err != nil {
+		setupLog.Error(err, "unable to close audit log")
+	}
+	if err := pools.Close(); err != nil {
+		setupLog.Error(err, "unable to close database connections")
+	}
+
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// cacheOptions restricts the cache of the manager to the namespaces and
+// the objects of the operator to the ones matching the label selector
+func cacheOptions(namespaces, selector string) (cache.Options, error) {
+	options := cache.Options{}
+
+	for _, namespace := range strings.Split(namespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace == "" {
+			continue
+		}
+		if options.DefaultNamespaces == nil {
+			options.DefaultNamespaces = map[string]cache.Config{}
+		}
+		options.DefaultNamespaces[namespace] = cache.Config{}
+	}
+
+	if selector != "" {
+		labelSelector, err := labels.Parse(selector)
+		if err != nil {
+			return options, fmt.Errorf("Failed to parse label selector '%s': %w", selector, err)
+		}
+		options.ByObject = map[client.Object]cache.ByObject{
+			&k8sv1.DatabaseHost{}:      {Label: labelSelector},
+			&k8sv1beta1.Database{}:     {Label: labelSelector},
+			&k8sv1beta1.DatabaseUser{}: {Label: labelSelector},
+		}
+	}
+
+	return options, nil
+}
@@ -0,0 +1,31 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package namespaced holds the RBAC markers of the namespaced deployment in config/namespaced.
+// controller-gen turns them into a Role instead of the ClusterRole generated from the markers
+// of the controllers. They grant the same namespace-scoped permissions as those markers and
+// leave out the cluster-scoped ones, which the tests of this package verify.
+package namespaced
+
+//+kubebuilder:rbac:groups=batch,namespace=system,resources=jobs,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=coordination.k8s.io,namespace=system,resources=leases,verbs=get;list;create;update;delete
+//+kubebuilder:rbac:groups=core,namespace=system,resources=configmaps,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups=core,namespace=system,resources=secrets,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=core,namespace=system,resources=pods,verbs=get;list
+//+kubebuilder:rbac:groups=core,namespace=system,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=k8s.tuunit.com,namespace=system,resources=databasehosts;databases;databaseusers;databasebackups;databasebackupschedules;databaserestores;databasemigrations,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=k8s.tuunit.com,namespace=system,resources=databasehosts/status;databases/status;databaseusers/status;databasebackups/status;databasebackupschedules/status;databaserestores/status;databasemigrations/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=k8s.tuunit.com,namespace=system,resources=databasehosts/finalizers;databases/finalizers;databaseusers/finalizers;databasebackups/finalizers;databasebackupschedules/finalizers;databaserestores/finalizers;databasemigrations/finalizers,verbs=update
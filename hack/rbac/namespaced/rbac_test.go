@@ -0,0 +1,75 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespaced
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// permissions reads the generated role and returns its rules as distinct group/resource/verb triples
+func permissions(path string, kind string) []string {
+	data, err := os.ReadFile(filepath.Join("..", "..", "..", path))
+	Expect(err).NotTo(HaveOccurred())
+
+	var permissions []string
+	seen := map[string]bool{}
+	for _, document := range strings.Split(string(data), "\n---\n") {
+		role := &rbacv1.ClusterRole{}
+		Expect(yaml.Unmarshal([]byte(document), role)).To(Succeed())
+		if role.Kind != kind {
+			continue
+		}
+
+		for _, rule := range role.Rules {
+			for _, group := range rule.APIGroups {
+				for _, resource := range rule.Resources {
+					for _, verb := range rule.Verbs {
+						if permission := group + "/" + resource + "/" + verb; !seen[permission] {
+							seen[permission] = true
+							permissions = append(permissions, permission)
+						}
+					}
+				}
+			}
+		}
+	}
+	return permissions
+}
+
+var _ = Describe("Namespaced Role", func() {
+	clusterScoped := []string{"namespaces"}
+
+	It("should grant the namespace-scoped permissions of the ClusterRole", func() {
+		var expected []string
+		for _, permission := range permissions("config/rbac/role.yaml", "ClusterRole") {
+			if resource := strings.Split(permission, "/")[1]; !slices.Contains(clusterScoped, resource) {
+				expected = append(expected, permission)
+			}
+		}
+
+		Expect(expected).NotTo(BeEmpty())
+		Expect(permissions("config/namespaced/rbac/role.yaml", "Role")).To(ConsistOf(expected))
+	})
+})
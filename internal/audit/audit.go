@@ -0,0 +1,177 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records the statements the operator executes against database hosts.
+// The provider layer hands every executed statement to a Sink, with secrets like
+// passwords already redacted, together with the object whose reconciliation caused it.
+package audit
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+)
+
+// Redacted replaces secrets in recorded statements
+const Redacted = "'[REDACTED]'"
+
+const (
+	// OutcomeSuccess marks statements which succeeded
+	OutcomeSuccess = "success"
+	// OutcomeError marks statements which failed
+	OutcomeError = "error"
+)
+
+// Source identifies the object whose reconciliation executed a statement
+type Source struct {
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	Generation int64  `json:"generation"`
+	// Host is the name of the DatabaseHost the statement was executed against
+	Host string `json:"host"`
+
+	hostObject *k8sv1.DatabaseHost
+}
+
+// Record describes a single statement executed against a database host
+type Record struct {
+	Time   time.Time `json:"time"`
+	Source Source    `json:"source"`
+	// Address is the address of the database server
+	Address  string `json:"address"`
+	Engine   string `json:"engine"`
+	Database string `json:"database"`
+	// Kind is the kind of the statement like CREATE DATABASE or GRANT
+	Kind string `json:"kind"`
+	// Statement is the executed statement with all secrets redacted
+	Statement       string  `json:"statement"`
+	Outcome         string  `json:"outcome"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// Sink stores audit records
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+}
+
+// multiSink writes every record to all of its sinks
+type multiSink []Sink
+
+// Multi returns a sink writing every record to all of the given sinks
+func Multi(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+func (m multiSink) Write(ctx context.Context, record Record) error {
+	var errs []error
+	for _, sink := range m {
+		if err := sink.Write(ctx, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type sourceKey struct{}
+
+// WithSource returns a context which attributes the statements executed with it
+// to the object of the given kind and its host
+func WithSource(ctx context.Context, kind string, obj client.Object, host *k8sv1.DatabaseHost) context.Context {
+	return context.WithValue(ctx, sourceKey{}, Source{
+		Kind:       kind,
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		Generation: obj.GetGeneration(),
+		Host:       host.Name,
+		hostObject: host,
+	})
+}
+
+// SourceFrom returns the source attached to the context
+func SourceFrom(ctx context.Context) Source {
+	source, _ := ctx.Value(sourceKey{}).(Source)
+	return source
+}
+
+// Options configures the sinks of the audit log
+type Options struct {
+	// Log writes the records to the log of the operator
+	Log bool
+	// File is the path of the JSON lines file records are appended to, disabled if empty
+	File string
+	// FileMaxSize is the size in megabytes after which the file is rotated
+	FileMaxSize int
+	// FileMaxBackups is the number of rotated files which are kept
+	FileMaxBackups int
+	// ConfigMapRecords is the number of records kept in the audit ConfigMap of every host, disabled if zero
+	ConfigMapRecords int
+}
+
+// BindFlags binds the audit options to the flag set
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.Log, "audit-log", true,
+		"If set, executed statements are written to the log of the operator")
+	fs.StringVar(&o.File, "audit-file", "",
+		"The path of the JSON lines file executed statements are appended to. Disabled if not set.")
+	fs.IntVar(&o.FileMaxSize, "audit-file-max-size", 100,
+		"The size in megabytes after which the audit file is rotated")
+	fs.IntVar(&o.FileMaxBackups, "audit-file-max-backups", 5,
+		"The number of rotated audit files which are kept")
+	fs.IntVar(&o.ConfigMapRecords, "audit-configmap-records", 0,
+		"The number of executed statements kept in a ConfigMap per DatabaseHost. Disabled if 0.")
+}
+
+// NewSink returns a sink writing to all sinks enabled in the options and a function closing them.
+// The ConfigMap sink reads through reader and writes through writer.
+func NewSink(opts Options, logger logr.Logger, reader client.Reader, writer client.Writer) (Sink, func() error, error) {
+	sinks := []Sink{}
+	closers := []func() error{}
+
+	if opts.Log {
+		sinks = append(sinks, NewLogSink(logger))
+	}
+
+	if opts.File != "" {
+		file, err := NewFileSink(opts.File, int64(opts.FileMaxSize)*1024*1024, opts.FileMaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		sinks = append(sinks, file)
+		closers = append(closers, file.Close)
+	}
+
+	if opts.ConfigMapRecords > 0 {
+		sinks = append(sinks, NewConfigMapSink(reader, writer, opts.ConfigMapRecords))
+	}
+
+	closeSinks := func() error {
+		var errs []error
+		for _, closer := range closers {
+			errs = append(errs, closer())
+		}
+		return errors.Join(errs...)
+	}
+
+	return Multi(sinks...), closeSinks, nil
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+)
+
+// readLines returns the records stored as JSON lines in data
+func readLines(data string) []Record {
+	records := []Record{}
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		record := Record{}
+		Expect(json.Unmarshal([]byte(line), &record)).To(Succeed())
+		records = append(records, record)
+	}
+	return records
+}
+
+var _ = Describe("Audit", func() {
+	host := &k8sv1.DatabaseHost{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "postgres", UID: "1234"}}
+	obj := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-database", Generation: 3}}
+	ctx := WithSource(context.Background(), "Database", obj, host)
+
+	record := func(statement string) Record {
+		return Record{Source: SourceFrom(ctx), Kind: "CREATE DATABASE", Statement: statement, Outcome: OutcomeSuccess}
+	}
+
+	Context("When attaching a source to the context", func() {
+		It("should identify the object and its host", func() {
+			source := SourceFrom(ctx)
+			Expect(source.Kind).To(Equal("Database"))
+			Expect(source.Namespace).To(Equal("default"))
+			Expect(source.Name).To(Equal("test-database"))
+			Expect(source.Generation).To(Equal(int64(3)))
+			Expect(source.Host).To(Equal("postgres"))
+		})
+
+		It("should return an empty source without one", func() {
+			Expect(SourceFrom(context.Background())).To(Equal(Source{}))
+		})
+	})
+
+	Context("When writing to a file", func() {
+		var path string
+
+		BeforeEach(func() {
+			path = filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+		})
+
+		It("should append the records as JSON lines", func() {
+			sink, err := NewFileSink(path, 1024*1024, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sink.Write(ctx, record("CREATE DATABASE a"))).To(Succeed())
+			Expect(sink.Write(ctx, record("CREATE DATABASE b"))).To(Succeed())
+			Expect(sink.Close()).To(Succeed())
+
+			data, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			records := readLines(string(data))
+			Expect(records).To(HaveLen(2))
+			Expect(records[1].Statement).To(Equal("CREATE DATABASE b"))
+			Expect(records[1].Source.Name).To(Equal("test-database"))
+		})
+
+		It("should rotate the file once it exceeds its maximum size", func() {
+			line, err := json.Marshal(record("CREATE DATABASE a"))
+			Expect(err).NotTo(HaveOccurred())
+
+			// every file holds two records
+			sink, err := NewFileSink(path, int64(2*(len(line)+1)), 2)
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 7; i++ {
+				Expect(sink.Write(ctx, record("CREATE DATABASE a"))).To(Succeed())
+			}
+			Expect(sink.Close()).To(Succeed())
+
+			for _, name := range []string{path, path + ".1", path + ".2"} {
+				Expect(name).To(BeAnExistingFile())
+			}
+			Expect(path + ".3").NotTo(BeAnExistingFile())
+
+			data, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readLines(string(data))).To(HaveLen(1))
+		})
+	})
+
+	Context("When writing to a ConfigMap", func() {
+		var c client.Client
+
+		BeforeEach(func() {
+			c = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+		})
+
+		It("should keep the most recent records per host", func() {
+			sink := NewConfigMapSink(c, c, 2)
+			for _, statement := range []string{"a", "b", "c"} {
+				Expect(sink.Write(ctx, record(statement))).To(Succeed())
+			}
+
+			configMap := &corev1.ConfigMap{}
+			Expect(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: ConfigMapName("postgres")}, configMap)).To(Succeed())
+			Expect(configMap.OwnerReferences).To(HaveLen(1))
+			Expect(configMap.OwnerReferences[0].Name).To(Equal("postgres"))
+
+			records := readLines(configMap.Data[ConfigMapKey])
+			Expect(records).To(HaveLen(2))
+			Expect(records[0].Statement).To(Equal("b"))
+			Expect(records[1].Statement).To(Equal("c"))
+		})
+
+		It("should skip records without a host", func() {
+			sink := NewConfigMapSink(c, c, 2)
+			Expect(sink.Write(context.Background(), Record{Statement: "a"})).To(Succeed())
+
+			configMaps := &corev1.ConfigMapList{}
+			Expect(c.List(context.Background(), configMaps)).To(Succeed())
+			Expect(configMaps.Items).To(BeEmpty())
+		})
+	})
+})
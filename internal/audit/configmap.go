@@ -0,0 +1,133 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+)
+
+// ConfigMapKey is the key of the ConfigMap data holding the records as JSON lines
+const ConfigMapKey = "records.jsonl"
+
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;create;update
+
+// ConfigMapSink keeps the most recent audit records of every DatabaseHost in a
+// ConfigMap named after the host, which acts as a ring buffer next to the host
+type ConfigMapSink struct {
+	reader  client.Reader
+	writer  client.Writer
+	records int
+}
+
+// NewConfigMapSink returns a sink keeping the given number of records per host.
+// The reader should not be backed by the cache to not cache all ConfigMaps of the cluster.
+func NewConfigMapSink(reader client.Reader, writer client.Writer, records int) *ConfigMapSink {
+	return &ConfigMapSink{reader: reader, writer: writer, records: records}
+}
+
+// ConfigMapName returns the name of the audit ConfigMap of the host
+func ConfigMapName(host string) string {
+	return host + "-audit"
+}
+
+// Write implements Sink
+func (s *ConfigMapSink) Write(ctx context.Context, record Record) error {
+	source := record.Source
+	if source.Host == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal audit record: %w", err)
+	}
+
+	key := client.ObjectKey{Namespace: source.Namespace, Name: ConfigMapName(source.Host)}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap := &corev1.ConfigMap{}
+		if err := s.reader.Get(ctx, key, configMap); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+
+			configMap = s.newConfigMap(key, source)
+			configMap.Data[ConfigMapKey] = string(line) + "\n"
+			return s.writer.Create(ctx, configMap)
+		}
+
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[ConfigMapKey] = s.append(configMap.Data[ConfigMapKey], string(line))
+		return s.writer.Update(ctx, configMap)
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to write audit ConfigMap '%s': %w", key.Name, err)
+	}
+
+	return nil
+}
+
+// append adds the line to the records and drops the oldest records above the limit
+func (s *ConfigMapSink) append(records, line string) string {
+	lines := append(strings.Split(strings.TrimSuffix(records, "\n"), "\n"), line)
+	if lines[0] == "" {
+		lines = lines[1:]
+	}
+	if len(lines) > s.records {
+		lines = lines[len(lines)-s.records:]
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func (s *ConfigMapSink) newConfigMap(key client.ObjectKey, source Source) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: key.Namespace,
+			Name:      key.Name,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "external-database-operator",
+				"k8s.tuunit.com/database-host": source.Host,
+			},
+		},
+		Data: map[string]string{},
+	}
+
+	// the records are removed together with their host
+	if host := source.hostObject; host != nil && host.UID != "" {
+		configMap.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: k8sv1.GroupVersion.String(),
+			Kind:       "DatabaseHost",
+			Name:       host.Name,
+			UID:        host.UID,
+		}}
+	}
+
+	return configMap
+}
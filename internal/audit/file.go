@@ -0,0 +1,124 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileSink appends audit records as JSON lines to a file, which is rotated
+// once it exceeds its maximum size. Rotated files get the suffix .1, .2 and
+// so on, with .1 being the most recent one.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFileSink opens the file at path for appending
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write implements Sink
+func (s *FileSink) Write(_ context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("Failed to write audit file '%s': %w", s.path, err)
+	}
+
+	return nil
+}
+
+// Close closes the current file
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("Failed to open audit file '%s': %w", s.path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Failed to stat audit file '%s': %w", s.path, err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate shifts the rotated files by one, dropping the oldest, and starts a new file
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("Failed to close audit file '%s': %w", s.path, err)
+	}
+
+	if s.maxBackups > 0 {
+		for i := s.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(s.backup(i), s.backup(i+1)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("Failed to rotate audit file '%s': %w", s.backup(i), err)
+			}
+		}
+		if err := os.Rename(s.path, s.backup(1)); err != nil {
+			return fmt.Errorf("Failed to rotate audit file '%s': %w", s.path, err)
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return fmt.Errorf("Failed to remove audit file '%s': %w", s.path, err)
+	}
+
+	return s.open()
+}
+
+func (s *FileSink) backup(i int) string {
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+)
+
+// LogSink writes audit records as structured log entries
+type LogSink struct {
+	logr.Logger
+}
+
+// NewLogSink returns a sink writing to the logger
+func NewLogSink(logger logr.Logger) *LogSink {
+	return &LogSink{logger}
+}
+
+// Write implements Sink
+func (s *LogSink) Write(_ context.Context, record Record) error {
+	s.Info("statement executed",
+		"kind", record.Source.Kind,
+		"namespace", record.Source.Namespace,
+		"name", record.Source.Name,
+		"generation", record.Source.Generation,
+		"host", record.Source.Host,
+		"address", record.Address,
+		"engine", record.Engine,
+		"database", record.Database,
+		"statementKind", record.Kind,
+		"statement", record.Statement,
+		"outcome", record.Outcome,
+		"error", record.Error,
+		"durationSeconds", record.DurationSeconds,
+	)
+	return nil
+}
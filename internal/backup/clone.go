@@ -0,0 +1,74 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+// CloneContainer is the container streaming the dump of the source into the target database
+const CloneContainer = "clone"
+
+// CloneJob returns the Job streaming a dump of the source into the target without storing it.
+// Both have to be of the same engine, the owner of the cloned objects is remapped to owner unless it is empty.
+func CloneJob(database *k8sv1beta1.Database, source, target Target, owner string) (*batchv1.Job, error) {
+	if source.Host.Type != target.Host.Type {
+		return nil, fmt.Errorf("Cannot clone a %s database into a %s database", source.Host.Type, target.Host.Type)
+	}
+
+	dump, ok := dumpScripts[source.Host.Type]
+	if !ok {
+		return nil, fmt.Errorf("Database type '%s' not supported for clones", source.Host.Type)
+	}
+	load := loadScripts[target.Host.Type]
+
+	// the dump runs in a subshell connecting to the source instead of the target
+	password := passwordEnv(source.Host.Type)
+	script := fmt.Sprintf(`( DB_HOST="$SOURCE_HOST"; DB_PORT="$SOURCE_PORT"; DB_USER="$SOURCE_USER"; DB_NAME="$SOURCE_NAME"; %s="$SOURCE_PASSWORD"; %s ) | %s`, password, dump, load)
+
+	env := append(connectionEnv(target), targetEnv("SOURCE_", source)...)
+	env = append(env, corev1.EnvVar{Name: "SOURCE_PASSWORD", ValueFrom: passwordSource(source)})
+	if owner != "" {
+		env = append(env, corev1.EnvVar{Name: "DB_OWNER", Value: owner})
+	}
+
+	pod := corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+		Containers: []corev1.Container{{
+			Name:    CloneContainer,
+			Image:   Image(&k8sv1beta1.DatabaseBackup{}, target.Host.Type),
+			Command: scriptCommand(target.Host.Type, script),
+			Env:     env,
+		}},
+	}
+
+	return job(database.Namespace, database.Name+"-clone", pod), nil
+}
+
+// CloneFromBackupJob returns the Job loading the dump of the backup into the target of a clone
+func CloneFromBackupJob(database *k8sv1beta1.Database, backup *k8sv1beta1.DatabaseBackup, target Target, owner string) (*batchv1.Job, error) {
+	pod, err := restorePod(backup, target, owner, false, "", "")
+	if err != nil {
+		return nil, err
+	}
+	return job(database.Namespace, database.Name+"-clone", pod), nil
+}
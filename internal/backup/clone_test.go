@@ -0,0 +1,75 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+var _ = Describe("CloneJob", func() {
+	database := &k8sv1beta1.Database{ObjectMeta: metav1.ObjectMeta{Name: "preview-42", Namespace: "previews"}}
+
+	source := Target{
+		Host:              k8sv1.DatabaseHostSpec{Type: k8sv1.Postgres, Host: "staging.example.com", Superuser: "admin"},
+		Database:          "staging",
+		CredentialsSecret: "preview-42-clone-source-credentials",
+	}
+	target := Target{
+		Host:              k8sv1.DatabaseHostSpec{Type: k8sv1.Postgres, Host: "previews.example.com", Superuser: "admin", Port: 6432},
+		Database:          "preview_42",
+		CredentialsSecret: "preview-42-clone-credentials",
+	}
+
+	It("streams the dump of the source into the target", func() {
+		job, err := CloneJob(database, source, target, "preview")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Name).To(Equal("preview-42-clone"))
+
+		container := job.Spec.Template.Spec.Containers[0]
+		Expect(container.Command[2]).To(ContainSubstring(`PGPASSWORD="$SOURCE_PASSWORD"; pg_dump`))
+		Expect(container.Command[2]).To(ContainSubstring("| pg_restore"))
+
+		env := map[string]string{}
+		secrets := map[string]string{}
+		for _, e := range container.Env {
+			env[e.Name] = e.Value
+			if e.ValueFrom != nil {
+				secrets[e.Name] = e.ValueFrom.SecretKeyRef.Name
+			}
+		}
+		Expect(env).To(HaveKeyWithValue("SOURCE_HOST", "staging.example.com"))
+		Expect(env).To(HaveKeyWithValue("SOURCE_NAME", "staging"))
+		Expect(env).To(HaveKeyWithValue("DB_PORT", "6432"))
+		Expect(env).To(HaveKeyWithValue("DB_OWNER", "preview"))
+		Expect(secrets).To(HaveKeyWithValue("SOURCE_PASSWORD", source.CredentialsSecret))
+		Expect(secrets).To(HaveKeyWithValue("PGPASSWORD", target.CredentialsSecret))
+	})
+
+	It("rejects clones across engines", func() {
+		mysql := source
+		mysql.Host.Type = k8sv1.MySQL
+
+		_, err := CloneJob(database, mysql, target, "")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,306 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backup builds the Jobs dumping databases with the dump tool of their engine and
+// restoring those dumps. The dump is compressed and stored on a PersistentVolumeClaim or uploaded
+// to an S3-compatible object store. The container dumping the database reports the size and checksum
+// of the dump in its termination message, which the controller reads into the status of the DatabaseBackup.
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+const (
+	// DumpContainer is the container dumping the database, its termination message holds the Result
+	DumpContainer = "dump"
+	// UploadContainer is the container uploading the dump to the object store
+	UploadContainer = "upload"
+
+	// DefaultPostgresImage provides pg_dump
+	DefaultPostgresImage = "postgres:16-alpine"
+	// DefaultMySQLImage provides mysqldump
+	DefaultMySQLImage = "mysql:8.0-debian"
+	// DefaultUploadImage provides the MinIO client
+	DefaultUploadImage = "minio/mc:latest"
+
+	// PasswordKey is the key of the superuser password in the credentials secret of a Job
+	PasswordKey = "password"
+
+	volumeName = "backup"
+	mountPath  = "/backup"
+	// alias is the name of the object store in the MinIO client
+	alias = "target"
+)
+
+// Target is the database a Job dumps
+type Target struct {
+	// Host is the spec of the host, the password is read from the credentials secret instead
+	Host k8sv1.DatabaseHostSpec
+	// Database is the name of the database on the host
+	Database string
+	// CredentialsSecret is the name of the secret holding the password of the superuser under PasswordKey
+	CredentialsSecret string
+}
+
+// Result is reported by the dump container in its termination message
+type Result struct {
+	// Size is the size of the compressed dump in bytes
+	Size int64 `json:"size"`
+	// Checksum is the SHA-256 checksum of the compressed dump
+	Checksum string `json:"checksum"`
+}
+
+// ParseResult parses the termination message of the dump container
+func ParseResult(message string) (Result, error) {
+	var result Result
+	if err := json.Unmarshal([]byte(message), &result); err != nil {
+		return result, fmt.Errorf("Failed to parse backup result '%s': %w", message, err)
+	}
+	return result, nil
+}
+
+// Key returns the path of the dump relative to the configured directory or prefix
+func Key(backup *k8sv1beta1.DatabaseBackup) string {
+	return path.Join(backup.Namespace, backup.Spec.DatabaseRef.Name, backup.Name+".dump.gz")
+}
+
+// Location returns the path on the volume or the URL in the object store of the dump
+func Location(backup *k8sv1beta1.DatabaseBackup) string {
+	storage := backup.Spec.Storage
+	if storage.S3 != nil {
+		return "s3://" + path.Join(storage.S3.Bucket, storage.S3.Prefix, Key(backup))
+	}
+	return path.Join("/", storage.PersistentVolumeClaim.Path, Key(backup))
+}
+
+// Job returns the Job dumping the target for the backup
+func Job(backup *k8sv1beta1.DatabaseBackup, target Target) (*batchv1.Job, error) {
+	dump, err := dumpContainer(backup, target)
+	if err != nil {
+		return nil, err
+	}
+
+	pod := corev1.PodSpec{RestartPolicy: corev1.RestartPolicyNever}
+
+	storage := backup.Spec.Storage
+	if storage.S3 != nil {
+		// the dump is staged in an emptyDir and uploaded once it is complete
+		upload, err := mcContainer(backup, UploadContainer, "cp", "--quiet", dumpFile(backup), objectPath(backup))
+		if err != nil {
+			return nil, err
+		}
+		upload.VolumeMounts = []corev1.VolumeMount{{Name: volumeName, MountPath: mountPath, ReadOnly: true}}
+
+		pod.InitContainers = []corev1.Container{dump}
+		pod.Containers = []corev1.Container{upload}
+		pod.Volumes = []corev1.Volume{{Name: volumeName, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+	} else {
+		pod.Containers = []corev1.Container{dump}
+		pod.Volumes = []corev1.Volume{claimVolume(backup)}
+	}
+
+	return job(backup.Namespace, backup.Name+"-backup", pod), nil
+}
+
+// CleanupJob returns the Job removing the dump of the backup from the storage
+func CleanupJob(backup *k8sv1beta1.DatabaseBackup, image string) (*batchv1.Job, error) {
+	pod := corev1.PodSpec{RestartPolicy: corev1.RestartPolicyNever}
+
+	if backup.Spec.Storage.S3 != nil {
+		remove, err := mcContainer(backup, "cleanup", "rm", "--force", objectPath(backup))
+		if err != nil {
+			return nil, err
+		}
+		pod.Containers = []corev1.Container{remove}
+	} else {
+		pod.Containers = []corev1.Container{{
+			Name:         "cleanup",
+			Image:        image,
+			Command:      []string{"rm", "-f", dumpFile(backup)},
+			VolumeMounts: []corev1.VolumeMount{{Name: volumeName, MountPath: mountPath}},
+		}}
+		pod.Volumes = []corev1.Volume{claimVolume(backup)}
+	}
+
+	return job(backup.Namespace, backup.Name+"-cleanup", pod), nil
+}
+
+// Image returns the image providing the dump tool for the backup
+func Image(backup *k8sv1beta1.DatabaseBackup, engine k8sv1.DatabaseType) string {
+	if backup.Spec.Image != "" {
+		return backup.Spec.Image
+	}
+	if engine == k8sv1.MySQL {
+		return DefaultMySQLImage
+	}
+	return DefaultPostgresImage
+}
+
+func job(namespace, name string, pod corev1.PodSpec) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": "external-database-operator"},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](2),
+			Template:     corev1.PodTemplateSpec{Spec: pod},
+		},
+	}
+}
+
+// dumpScripts dump the database named by the environment into the compressed file and
+// report its size and checksum in the termination message. PostgreSQL databases are dumped
+// in the custom format, so pg_restore can remap the ownership of the objects on restore.
+var dumpScripts = map[k8sv1.DatabaseType]string{
+	k8sv1.Postgres: `pg_dump --host="$DB_HOST" --port="$DB_PORT" --username="$DB_USER" --no-password --format=custom --compress=0 "$DB_NAME"`,
+	k8sv1.MySQL:    `mysqldump --host="$DB_HOST" --port="$DB_PORT" --user="$DB_USER" --single-transaction --routines --triggers "$DB_NAME"`,
+}
+
+// shells run the scripts of the engines. The scripts rely on pipefail, which the busybox sh of the
+// Alpine based PostgreSQL image supports but the dash of the Debian based MySQL image does not.
+var shells = map[k8sv1.DatabaseType]string{
+	k8sv1.Postgres: "/bin/sh",
+	k8sv1.MySQL:    "/bin/bash",
+}
+
+// scriptCommand returns the command running the script in the shell of the engine,
+// which stops at the first failing command including the commands of a pipeline
+func scriptCommand(engine k8sv1.DatabaseType, script string) []string {
+	return []string{shells[engine], "-c", "set -eu -o pipefail\n" + script}
+}
+
+const reportScript = `printf '{"size":%s,"checksum":"sha256:%s"}' "$(stat -c %s "$BACKUP_FILE")" "$(sha256sum "$BACKUP_FILE" | cut -d ' ' -f 1)" > /dev/termination-log`
+
+func dumpContainer(backup *k8sv1beta1.DatabaseBackup, target Target) (corev1.Container, error) {
+	dump, ok := dumpScripts[target.Host.Type]
+	if !ok {
+		return corev1.Container{}, fmt.Errorf("Database type '%s' not supported for backups", target.Host.Type)
+	}
+
+	script := fmt.Sprintf(`mkdir -p "$(dirname "$BACKUP_FILE")"
+%s | gzip > "$BACKUP_FILE"
+%s`, dump, reportScript)
+
+	return corev1.Container{
+		Name:    DumpContainer,
+		Image:   Image(backup, target.Host.Type),
+		Command: scriptCommand(target.Host.Type, script),
+		Env: append(connectionEnv(target),
+			corev1.EnvVar{Name: "BACKUP_FILE", Value: dumpFile(backup)},
+		),
+		VolumeMounts:             []corev1.VolumeMount{{Name: volumeName, MountPath: mountPath}},
+		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+	}, nil
+}
+
+// connectionEnv returns the variables the database tools of the engine connect to the target with
+func connectionEnv(target Target) []corev1.EnvVar {
+	return append(targetEnv("DB_", target), corev1.EnvVar{Name: passwordEnv(target.Host.Type), ValueFrom: passwordSource(target)})
+}
+
+// targetEnv returns the variables naming the target with the given prefix
+func targetEnv(prefix string, target Target) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{Name: prefix + "HOST", Value: target.Host.Host},
+		{Name: prefix + "PORT", Value: strconv.Itoa(int(target.Host.EffectivePort()))},
+		{Name: prefix + "USER", Value: target.Host.Superuser},
+		{Name: prefix + "NAME", Value: target.Database},
+	}
+}
+
+// passwordEnv returns the variable the database tools of the engine read the password from
+func passwordEnv(engine k8sv1.DatabaseType) string {
+	if engine == k8sv1.MySQL {
+		return "MYSQL_PWD"
+	}
+	return "PGPASSWORD"
+}
+
+func passwordSource(target Target) *corev1.EnvVarSource {
+	return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: target.CredentialsSecret},
+		Key:                  PasswordKey,
+	}}
+}
+
+// mcContainer runs the MinIO client against the object store of the backup. The credentials
+// are passed through the MC_HOST_<alias> variable, which the kubelet assembles from the secret.
+func mcContainer(backup *k8sv1beta1.DatabaseBackup, name string, args ...string) (corev1.Container, error) {
+	s3 := backup.Spec.Storage.S3
+
+	endpoint, err := url.Parse(s3.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return corev1.Container{}, fmt.Errorf("Invalid S3 endpoint '%s'", s3.Endpoint)
+	}
+
+	image := backup.Spec.UploadImage
+	if image == "" {
+		image = DefaultUploadImage
+	}
+
+	credential := func(key string) corev1.EnvVar {
+		return corev1.EnvVar{Name: key, ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: s3.CredentialsSecretRef},
+			Key:                  key,
+		}}}
+	}
+
+	return corev1.Container{
+		Name:  name,
+		Image: image,
+		Args:  args,
+		Env: []corev1.EnvVar{
+			credential("AWS_ACCESS_KEY_ID"),
+			credential("AWS_SECRET_ACCESS_KEY"),
+			{Name: "MC_HOST_" + alias, Value: fmt.Sprintf("%s://$(AWS_ACCESS_KEY_ID):$(AWS_SECRET_ACCESS_KEY)@%s", endpoint.Scheme, endpoint.Host)},
+		},
+	}, nil
+}
+
+func claimVolume(backup *k8sv1beta1.DatabaseBackup) corev1.Volume {
+	return corev1.Volume{Name: volumeName, VolumeSource: corev1.VolumeSource{
+		PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: backup.Spec.Storage.PersistentVolumeClaim.ClaimName},
+	}}
+}
+
+// dumpFile returns the path of the dump in the containers
+func dumpFile(backup *k8sv1beta1.DatabaseBackup) string {
+	if backup.Spec.Storage.S3 != nil {
+		return path.Join(mountPath, path.Base(Key(backup)))
+	}
+	return path.Join(mountPath, backup.Spec.Storage.PersistentVolumeClaim.Path, Key(backup))
+}
+
+// objectPath returns the path of the dump in the MinIO client
+func objectPath(backup *k8sv1beta1.DatabaseBackup) string {
+	s3 := backup.Spec.Storage.S3
+	return path.Join(alias, s3.Bucket, s3.Prefix, Key(backup))
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+// RestoreContainer is the container loading the dump into the target database
+const RestoreContainer = "restore"
+
+// loadScripts load a dump from stdin into the database named by the environment. The owner
+// and the removal of existing objects are controlled through DB_OWNER and FORCE.
+var loadScripts = map[k8sv1.DatabaseType]string{
+	// without an owner the objects keep the roles of the backed up database
+	k8sv1.Postgres: `pg_restore --host="$DB_HOST" --port="$DB_PORT" --username="$DB_USER" --no-password --dbname="$DB_NAME" --exit-on-error --single-transaction ${DB_OWNER:+--no-owner --no-privileges --role="$DB_OWNER"} ${FORCE:+--clean --if-exists}`,
+	// MySQL has no object owners, only the definers of views and routines are remapped.
+	// Dumps always replace the tables they contain, so FORCE needs no option.
+	k8sv1.MySQL: `if [ -n "${DB_OWNER:-}" ]; then ` +
+		"sed -E \"s/DEFINER=\\`[^\\`]*\\`@\\`[^\\`]*\\`/DEFINER=\\`${DB_OWNER}\\`@\\`%\\`/g\"; " +
+		`else cat; fi | mysql --host="$DB_HOST" --port="$DB_PORT" --user="$DB_USER" "$DB_NAME"`,
+}
+
+// RestoreJob returns the Job loading the dump of the backup into the target. The owner
+// of the restored objects is remapped to owner unless it is empty.
+func RestoreJob(restore *k8sv1beta1.DatabaseRestore, backup *k8sv1beta1.DatabaseBackup, target Target, owner string) (*batchv1.Job, error) {
+	pod, err := restorePod(backup, target, owner, restore.Spec.Force, restore.Spec.Image, restore.Spec.DownloadImage)
+	if err != nil {
+		return nil, err
+	}
+	return job(restore.Namespace, restore.Name+"-restore", pod), nil
+}
+
+// restorePod returns the pod loading the dump of the backup into the target, the images default to the official ones
+func restorePod(backup *k8sv1beta1.DatabaseBackup, target Target, owner string, force bool, image, downloadImage string) (corev1.PodSpec, error) {
+	script, ok := loadScripts[target.Host.Type]
+	if !ok {
+		return corev1.PodSpec{}, fmt.Errorf("Database type '%s' not supported for restores", target.Host.Type)
+	}
+
+	if image == "" {
+		image = Image(&k8sv1beta1.DatabaseBackup{}, target.Host.Type)
+	}
+
+	env := append(connectionEnv(target), corev1.EnvVar{Name: "BACKUP_FILE", Value: dumpFile(backup)})
+	if owner != "" {
+		env = append(env, corev1.EnvVar{Name: "DB_OWNER", Value: owner})
+	}
+	if force {
+		env = append(env, corev1.EnvVar{Name: "FORCE", Value: "true"})
+	}
+
+	load := corev1.Container{
+		Name:         RestoreContainer,
+		Image:        image,
+		Command:      scriptCommand(target.Host.Type, `gunzip -c "$BACKUP_FILE" | `+script),
+		Env:          env,
+		VolumeMounts: []corev1.VolumeMount{{Name: volumeName, MountPath: mountPath, ReadOnly: true}},
+	}
+
+	pod := corev1.PodSpec{RestartPolicy: corev1.RestartPolicyNever}
+
+	if backup.Spec.Storage.S3 != nil {
+		// the dump is downloaded into an emptyDir before it is loaded
+		download, err := mcContainer(backup, "download", "cp", "--quiet", objectPath(backup), dumpFile(backup))
+		if err != nil {
+			return pod, err
+		}
+		if downloadImage != "" {
+			download.Image = downloadImage
+		}
+		download.VolumeMounts = []corev1.VolumeMount{{Name: volumeName, MountPath: mountPath}}
+
+		pod.InitContainers = []corev1.Container{download}
+		pod.Volumes = []corev1.Volume{{Name: volumeName, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+	} else {
+		volume := claimVolume(backup)
+		volume.PersistentVolumeClaim.ReadOnly = true
+		pod.Volumes = []corev1.Volume{volume}
+	}
+	pod.Containers = []corev1.Container{load}
+
+	return pod, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+var _ = Describe("RestoreJob", func() {
+	var restore *k8sv1beta1.DatabaseRestore
+	var backup *k8sv1beta1.DatabaseBackup
+	var target Target
+
+	BeforeEach(func() {
+		restore = &k8sv1beta1.DatabaseRestore{
+			ObjectMeta: metav1.ObjectMeta{Name: "rollback", Namespace: "shop"},
+			Spec: k8sv1beta1.DatabaseRestoreSpec{
+				BackupRef:   k8sv1beta1.DatabaseBackupReference{Name: "nightly"},
+				DatabaseRef: k8sv1beta1.DatabaseReference{Name: "orders-copy"},
+			},
+		}
+		backup = &k8sv1beta1.DatabaseBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "shop"},
+			Spec: k8sv1beta1.DatabaseBackupSpec{
+				DatabaseRef: k8sv1beta1.DatabaseReference{Name: "orders"},
+				Storage: k8sv1beta1.BackupStorage{
+					PersistentVolumeClaim: &k8sv1beta1.PersistentVolumeClaimStorage{ClaimName: "dumps"},
+				},
+			},
+		}
+		target = Target{
+			Host:              k8sv1.DatabaseHostSpec{Type: k8sv1.Postgres, Host: "pg.example.com", Superuser: "admin"},
+			Database:          "shop_orders_copy",
+			CredentialsSecret: "rollback-restore-credentials",
+		}
+	})
+
+	env := func(container corev1.Container) map[string]string {
+		found := map[string]string{}
+		for _, e := range container.Env {
+			found[e.Name] = e.Value
+		}
+		return found
+	}
+
+	It("restores from the claim", func() {
+		job, err := RestoreJob(restore, backup, target, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Name).To(Equal("rollback-restore"))
+
+		pod := job.Spec.Template.Spec
+		Expect(pod.InitContainers).To(BeEmpty())
+		Expect(pod.Volumes[0].PersistentVolumeClaim.ReadOnly).To(BeTrue())
+		Expect(pod.Containers[0].Command[2]).To(ContainSubstring("pg_restore"))
+		Expect(env(pod.Containers[0])).To(HaveKeyWithValue("BACKUP_FILE", "/backup/shop/orders/nightly.dump.gz"))
+		Expect(env(pod.Containers[0])).To(HaveKeyWithValue("DB_NAME", "shop_orders_copy"))
+		Expect(env(pod.Containers[0])).NotTo(HaveKey("DB_OWNER"))
+		Expect(env(pod.Containers[0])).NotTo(HaveKey("FORCE"))
+	})
+
+	It("remaps the owner and replaces existing objects", func() {
+		restore.Spec.Force = true
+
+		job, err := RestoreJob(restore, backup, target, "orders_owner")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env(job.Spec.Template.Spec.Containers[0])).To(HaveKeyWithValue("DB_OWNER", "orders_owner"))
+		Expect(env(job.Spec.Template.Spec.Containers[0])).To(HaveKeyWithValue("FORCE", "true"))
+	})
+
+	It("downloads from the object store", func() {
+		backup.Spec.Storage = k8sv1beta1.BackupStorage{S3: &k8sv1beta1.S3Storage{
+			Endpoint:             "http://minio:9000",
+			Bucket:               "dumps",
+			CredentialsSecretRef: "minio",
+		}}
+		target.Host.Type = k8sv1.MySQL
+
+		job, err := RestoreJob(restore, backup, target, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		pod := job.Spec.Template.Spec
+		Expect(pod.InitContainers[0].Args).To(Equal([]string{"cp", "--quiet", "target/dumps/shop/orders/nightly.dump.gz", "/backup/nightly.dump.gz"}))
+		Expect(pod.Containers[0].Image).To(Equal(DefaultMySQLImage))
+		Expect(pod.Containers[0].Command[2]).To(ContainSubstring("mysql --host"))
+		Expect(env(pod.Containers[0])).To(HaveKeyWithValue("BACKUP_FILE", "/backup/nightly.dump.gz"))
+	})
+})
@@ -0,0 +1,152 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config holds the tuning of the controllers: how many objects they reconcile
+// concurrently, how failed reconciles are retried and how often everything is resynced.
+// The flags set the defaults for all controllers, a config file can override them per controller.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/yaml"
+)
+
+// Names of the controllers in the config file
+const (
+	DatabaseHost           = "databasehost"
+	Database               = "database"
+	DatabaseUser           = "databaseuser"
+	DatabaseBackup         = "databasebackup"
+	DatabaseBackupSchedule = "databasebackupschedule"
+	DatabaseRestore        = "databaserestore"
+	DatabaseMigration      = "databasemigration"
+)
+
+// Config is the tuning of the controllers
+type Config struct {
+	// ResyncPeriod is the interval in which all objects are reconciled again
+	ResyncPeriod metav1.Duration `json:"resyncPeriod,omitempty"`
+	// MaxConcurrentReconcilesPerHost limits the reconciles of databases and users running
+	// at the same time against a single host, so parallel workers don't pile DDL onto it
+	MaxConcurrentReconcilesPerHost int `json:"maxConcurrentReconcilesPerHost,omitempty"`
+	// Defaults apply to every controller without its own settings
+	Defaults Controller `json:"defaults,omitempty"`
+	// Controllers override the defaults for single controllers by their name
+	Controllers map[string]Controller `json:"controllers,omitempty"`
+}
+
+// Controller is the tuning of a single controller
+type Controller struct {
+	// MaxConcurrentReconciles is the number of workers of the controller
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
+	// RateLimiter controls the retries of failed reconciles
+	RateLimiter RateLimiter `json:"rateLimiter,omitempty"`
+}
+
+// RateLimiter delays the retries of an object exponentially and limits the overall rate of retries
+type RateLimiter struct {
+	// BaseDelay is the delay of the first retry of an object
+	BaseDelay metav1.Duration `json:"baseDelay,omitempty"`
+	// MaxDelay caps the exponential delay of the retries of an object
+	MaxDelay metav1.Duration `json:"maxDelay,omitempty"`
+	// QPS is the overall rate of retries
+	QPS float64 `json:"qps,omitempty"`
+	// Burst is the number of retries exceeding the rate
+	Burst int `json:"burst,omitempty"`
+}
+
+// BindFlags binds the defaults of the config to the flag set
+func (c *Config) BindFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&c.ResyncPeriod.Duration, "resync-period", 10*time.Hour,
+		"The interval in which all objects are reconciled again")
+	fs.IntVar(&c.MaxConcurrentReconcilesPerHost, "max-concurrent-reconciles-per-host", 1,
+		"The number of databases and users reconciled at the same time against a single database host, unlimited with 0")
+	fs.IntVar(&c.Defaults.MaxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The number of objects each controller reconciles at the same time")
+	fs.DurationVar(&c.Defaults.RateLimiter.BaseDelay.Duration, "retry-base-delay", 5*time.Millisecond,
+		"The delay of the first retry of a failed reconcile, doubled with every further failure")
+	fs.DurationVar(&c.Defaults.RateLimiter.MaxDelay.Duration, "retry-max-delay", 1000*time.Second,
+		"The maximum delay between the retries of a failed reconcile")
+	fs.Float64Var(&c.Defaults.RateLimiter.QPS, "retry-qps", 10,
+		"The overall rate of retries per controller")
+	fs.IntVar(&c.Defaults.RateLimiter.Burst, "retry-burst", 100,
+		"The number of retries per controller exceeding the rate")
+}
+
+// Load reads the config file over the values of the flags
+func (c *Config) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read config file '%s': %w", path, err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("Failed to parse config file '%s': %w", path, err)
+	}
+
+	for name := range c.Controllers {
+		switch name {
+		case DatabaseHost, Database, DatabaseUser, DatabaseBackup, DatabaseBackupSchedule, DatabaseRestore, DatabaseMigration:
+		default:
+			return fmt.Errorf("Unknown controller '%s' in config file '%s'", name, path)
+		}
+	}
+
+	return nil
+}
+
+// For returns the settings of the controller with the defaults filled in
+func (c *Config) For(name string) Controller {
+	settings := c.Controllers[name]
+	if settings.MaxConcurrentReconciles == 0 {
+		settings.MaxConcurrentReconciles = c.Defaults.MaxConcurrentReconciles
+	}
+
+	limiter := &settings.RateLimiter
+	if limiter.BaseDelay.Duration == 0 {
+		limiter.BaseDelay = c.Defaults.RateLimiter.BaseDelay
+	}
+	if limiter.MaxDelay.Duration == 0 {
+		limiter.MaxDelay = c.Defaults.RateLimiter.MaxDelay
+	}
+	if limiter.QPS == 0 {
+		limiter.QPS = c.Defaults.RateLimiter.QPS
+	}
+	if limiter.Burst == 0 {
+		limiter.Burst = c.Defaults.RateLimiter.Burst
+	}
+
+	return settings
+}
+
+// Options returns the controller options for the settings
+func (c Controller) Options() controller.Options {
+	return controller.Options{
+		MaxConcurrentReconciles: c.MaxConcurrentReconciles,
+		RateLimiter: workqueue.NewMaxOfRateLimiter(
+			workqueue.NewItemExponentialFailureRateLimiter(c.RateLimiter.BaseDelay.Duration, c.RateLimiter.MaxDelay.Duration),
+			&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(c.RateLimiter.QPS), c.RateLimiter.Burst)},
+		),
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	var c Config
+
+	BeforeEach(func() {
+		c = Config{}
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		c.BindFlags(fs)
+		Expect(fs.Parse([]string{"--max-concurrent-reconciles=2", "--retry-qps=5"})).To(Succeed())
+	})
+
+	write := func(content string) string {
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return path
+	}
+
+	It("applies the flags to every controller", func() {
+		settings := c.For(Database)
+		Expect(settings.MaxConcurrentReconciles).To(Equal(2))
+		Expect(settings.RateLimiter.QPS).To(Equal(5.0))
+		Expect(settings.RateLimiter.BaseDelay.Duration).To(Equal(5 * time.Millisecond))
+		Expect(c.ResyncPeriod.Duration).To(Equal(10 * time.Hour))
+	})
+
+	It("overrides the flags per controller from the file", func() {
+		Expect(c.Load(write(`
+resyncPeriod: 1h
+controllers:
+  database:
+    maxConcurrentReconciles: 8
+    rateLimiter:
+      maxDelay: 5m
+`))).To(Succeed())
+
+		Expect(c.ResyncPeriod.Duration).To(Equal(time.Hour))
+
+		database := c.For(Database)
+		Expect(database.MaxConcurrentReconciles).To(Equal(8))
+		Expect(database.RateLimiter.MaxDelay.Duration).To(Equal(5 * time.Minute))
+		Expect(database.RateLimiter.QPS).To(Equal(5.0))
+
+		Expect(c.For(DatabaseUser).MaxConcurrentReconciles).To(Equal(2))
+	})
+
+	It("rejects unknown settings", func() {
+		Expect(c.Load(write("controllers:\n  databases: {}\n"))).To(MatchError(ContainSubstring("Unknown controller 'databases'")))
+		Expect(c.Load(write("maxConcurrentReconcile: 3\n"))).NotTo(Succeed())
+	})
+
+	It("builds the controller options", func() {
+		options := c.For(DatabaseHost).Options()
+		Expect(options.MaxConcurrentReconciles).To(Equal(2))
+		Expect(options.RateLimiter.When("item")).To(Equal(5 * time.Millisecond))
+		Expect(options.RateLimiter.When("item")).To(Equal(10 * time.Millisecond))
+	})
+})
@@ -0,0 +1,42 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	"github.com/tuunit/external-database-operator/internal/provider"
+)
+
+// hostUnavailable reports whether the circuit breaker of the host is open after repeated connection
+// failures. Dependents of the host then wait for its next health check instead of failing on their own.
+func hostUnavailable(pools *provider.Pools, databaseHost *k8sv1.DatabaseHost) (string, time.Duration, bool) {
+	open, lastFailure := pools.CircuitOpen(client.ObjectKeyFromObject(databaseHost))
+	if !open {
+		return "", 0, false
+	}
+
+	// the health check may be overdue, for example while the host reconciler is busy
+	wait := max(time.Until(lastFailure.Add(hostHealthCheckInterval)), time.Second)
+
+	message := fmt.Sprintf("DatabaseHost '%s' is unavailable after repeated connection failures, retrying after its next health check", databaseHost.Name)
+	return message, wait, true
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/backup"
+)
+
+// cloneSource returns the kind and name of the source of the database like "template/staging"
+func cloneSource(source *k8sv1beta1.DatabaseSource) string {
+	switch {
+	case source.Template != nil:
+		return "template/" + source.Template.Name
+	case source.FromDatabase != nil:
+		return "database/" + source.FromDatabase.Name
+	case source.FromBackup != nil:
+		return "backup/" + source.FromBackup.Name
+	}
+	return ""
+}
+
+// templateName returns the name on the host of the Database the database is copied from.
+// The template has to be provisioned on the same host.
+func (r *DatabaseReconciler) templateName(ctx context.Context, database *k8sv1beta1.Database) (string, error) {
+	template := &k8sv1beta1.Database{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: database.Namespace, Name: database.Spec.Source.Template.Name}, template); err != nil {
+		return "", fmt.Errorf("Failed to get template Database '%s': %w", database.Spec.Source.Template.Name, err)
+	}
+
+	if template.Spec.HostRef.Name != database.Spec.HostRef.Name {
+		return "", fmt.Errorf("Template Database '%s' is on DatabaseHost '%s', templates have to be on the same host", template.Name, template.Spec.HostRef.Name)
+	}
+	if template.Status.Name == "" {
+		return "", fmt.Errorf("Template Database '%s' is not provisioned yet", template.Name)
+	}
+
+	return template.Status.Name, nil
+}
+
+// clone fills the database from its source database or backup with a Job. It reports
+// whether the clone is complete, otherwise the result and error are returned by Reconcile.
+func (r *DatabaseReconciler) clone(ctx context.Context, database *k8sv1beta1.Database, databaseHost *k8sv1.DatabaseHost) (bool, ctrl.Result, error) {
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: database.Namespace, Name: database.Name + "-clone"}, job)
+	if apierrors.IsNotFound(err) {
+		result, err := r.startClone(ctx, database, databaseHost)
+		return false, result, err
+	}
+	if err != nil {
+		return false, ctrl.Result{}, err
+	}
+
+	switch {
+	case jobFinished(job, batchv1.JobComplete):
+		for _, name := range []string{cloneCredentialsSecret(database), cloneSourceCredentialsSecret(database)} {
+			if err := deleteJobCredentials(ctx, r, database.Namespace, name); err != nil {
+				return false, ctrl.Result{}, err
+			}
+		}
+
+		database.Status.Clone.CompletionTime = &metav1.Time{Time: time.Now()}
+		r.Recorder.Event(database, corev1.EventTypeNormal, reasonCloned, fmt.Sprintf("Cloned database '%s' from %s", database.Spec.Name, database.Status.Clone.Source))
+		return true, ctrl.Result{}, nil
+	case jobFinished(job, batchv1.JobFailed):
+		message := fmt.Sprintf("Job '%s' cloning from %s failed, delete it to retry", job.Name, database.Status.Clone.Source)
+		// the failure is only reported once, the Job stays until it is deleted
+		if ready := meta.FindStatusCondition(database.Status.Conditions, k8sv1beta1.ConditionTypeReady); ready == nil || ready.Reason != reasonCloneFailed {
+			r.Recorder.Event(database, corev1.EventTypeWarning, reasonCloneFailed, message)
+		}
+		return false, ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonCloneFailed, message)
+	}
+
+	message := fmt.Sprintf("Job '%s' is cloning from %s", job.Name, database.Status.Clone.Source)
+	return false, ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonCloning, message)
+}
+
+// startClone creates the Job streaming the source database or loading the backup into the database,
+// which has to be empty, so data on the host is never overwritten
+func (r *DatabaseReconciler) startClone(ctx context.Context, database *k8sv1beta1.Database, databaseHost *k8sv1.DatabaseHost) (ctrl.Result, error) {
+	postgres := r.Pools.Postgres(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit)
+	empty, err := postgres.DatabaseEmpty(ctx, database.Spec.Name)
+	if err != nil {
+		r.Recorder.Event(database, corev1.EventTypeWarning, reasonCloneFailed, err.Error())
+		return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonCloneFailed, err.Error())
+	}
+	if !empty {
+		message := fmt.Sprintf("Database '%s' is not empty, refusing to clone into it", database.Spec.Name)
+		r.Recorder.Event(database, corev1.EventTypeWarning, reasonCloneFailed, message)
+		return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonCloneFailed, message)
+	}
+
+	target := backup.Target{Host: databaseHost.Spec, Database: database.Spec.Name, CredentialsSecret: cloneCredentialsSecret(database)}
+	source := database.Spec.Source
+
+	var job *batchv1.Job
+	var pointInTime time.Time
+
+	switch {
+	case source.FromDatabase != nil:
+		sourceDatabase := &k8sv1beta1.Database{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: database.Namespace, Name: source.FromDatabase.Name}, sourceDatabase); err != nil {
+			return r.waitForSource(ctx, database, fmt.Sprintf("Failed to get source Database '%s': %s", source.FromDatabase.Name, err))
+		}
+		if sourceDatabase.Status.Name == "" {
+			return r.waitForSource(ctx, database, fmt.Sprintf("Source Database '%s' is not provisioned yet", sourceDatabase.Name))
+		}
+
+		sourceHost := &k8sv1.DatabaseHost{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: database.Namespace, Name: sourceDatabase.Spec.HostRef.Name}, sourceHost); err != nil {
+			return r.waitForSource(ctx, database, fmt.Sprintf("Failed to get DatabaseHost '%s' of the source: %s", sourceDatabase.Spec.HostRef.Name, err))
+		}
+		sourceSpec, err := resolveHostSpec(ctx, r, sourceHost)
+		if err != nil {
+			return r.waitForSource(ctx, database, err.Error())
+		}
+
+		if err := createJobCredentials(ctx, r, r.Scheme, database, cloneSourceCredentialsSecret(database), sourceSpec.Password); err != nil {
+			return ctrl.Result{}, err
+		}
+		job, err = backup.CloneJob(database, backup.Target{
+			Host:              sourceSpec,
+			Database:          sourceDatabase.Status.Name,
+			CredentialsSecret: cloneSourceCredentialsSecret(database),
+		}, target, database.Spec.Owner)
+		if err != nil {
+			return r.waitForSource(ctx, database, err.Error())
+		}
+		// the dump is a consistent snapshot of the source as of the start of the Job
+		pointInTime = time.Now()
+	case source.FromBackup != nil:
+		databaseBackup := &k8sv1beta1.DatabaseBackup{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: database.Namespace, Name: source.FromBackup.Name}, databaseBackup); err != nil {
+			return r.waitForSource(ctx, database, fmt.Sprintf("Failed to get DatabaseBackup '%s': %s", source.FromBackup.Name, err))
+		}
+		if databaseBackup.Status.Phase != k8sv1beta1.BackupPhaseSucceeded {
+			return r.waitForSource(ctx, database, fmt.Sprintf("DatabaseBackup '%s' has not succeeded", databaseBackup.Name))
+		}
+
+		job, err = backup.CloneFromBackupJob(database, databaseBackup, target, database.Spec.Owner)
+		if err != nil {
+			return r.waitForSource(ctx, database, err.Error())
+		}
+		if databaseBackup.Status.StartTime != nil {
+			pointInTime = databaseBackup.Status.StartTime.Time
+		}
+	}
+
+	if err := createJobCredentials(ctx, r, r.Scheme, database, cloneCredentialsSecret(database), databaseHost.Spec.Password); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := controllerutil.SetControllerReference(database, job, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) {
+		return ctrl.Result{}, err
+	}
+
+	if !pointInTime.IsZero() {
+		database.Status.Clone.PointInTime = &metav1.Time{Time: pointInTime}
+	}
+
+	message := fmt.Sprintf("Job '%s' started cloning from %s", job.Name, database.Status.Clone.Source)
+	r.Recorder.Event(database, corev1.EventTypeNormal, reasonCloning, message)
+	return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonCloning, message)
+}
+
+// waitForSource records why the source cannot be cloned yet and retries later
+func (r *DatabaseReconciler) waitForSource(ctx context.Context, database *k8sv1beta1.Database, message string) (ctrl.Result, error) {
+	return ctrl.Result{RequeueAfter: backupRetryInterval}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonCloning, message)
+}
+
+// cloneCredentialsSecret returns the name of the secret holding the superuser password of the host for the clone Job
+func cloneCredentialsSecret(database *k8sv1beta1.Database) string {
+	return database.Name + "-clone-credentials"
+}
+
+// cloneSourceCredentialsSecret returns the name of the secret holding the superuser password of the source host
+func cloneSourceCredentialsSecret(database *k8sv1beta1.Database) string {
+	return database.Name + "-clone-source-credentials"
+}
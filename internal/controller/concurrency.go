@@ -0,0 +1,68 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// HostSlots limits the number of reconciles running at the same time against a single host
+// across all controllers. Workers beyond the limit requeue their object with backoff instead
+// of waiting, so they stay free for the objects on other hosts.
+type HostSlots struct {
+	limit int
+
+	mu    sync.Mutex
+	inUse map[types.NamespacedName]int
+}
+
+// NewHostSlots returns slots allowing limit reconciles per host, unlimited with zero
+func NewHostSlots(limit int) *HostSlots {
+	return &HostSlots{limit: limit, inUse: map[types.NamespacedName]int{}}
+}
+
+// acquire takes a slot of the host and reports whether one was free
+func (s *HostSlots) acquire(host types.NamespacedName) bool {
+	if s == nil || s.limit <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inUse[host] >= s.limit {
+		return false
+	}
+	s.inUse[host]++
+	return true
+}
+
+// release returns a slot of the host taken by acquire
+func (s *HostSlots) release(host types.NamespacedName) {
+	if s == nil || s.limit <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inUse[host]--; s.inUse[host] <= 0 {
+		delete(s.inUse, host)
+	}
+}
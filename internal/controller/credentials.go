@@ -0,0 +1,75 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	"github.com/tuunit/external-database-operator/internal/backup"
+)
+
+// resolveHostSpec returns the spec of the host with the superuser password read from the referenced secret
+func resolveHostSpec(ctx context.Context, c client.Reader, databaseHost *k8sv1.DatabaseHost) (k8sv1.DatabaseHostSpec, error) {
+	spec := databaseHost.Spec
+	if spec.PasswordSecretRef == "" {
+		return spec, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: databaseHost.Namespace, Name: spec.PasswordSecretRef}, secret); err != nil {
+		return spec, fmt.Errorf("Failed to get password secret '%s' of DatabaseHost '%s': %w", spec.PasswordSecretRef, databaseHost.Name, err)
+	}
+
+	password, ok := secret.Data[k8sv1.PasswordSecretKey]
+	if !ok || len(password) == 0 {
+		return spec, fmt.Errorf("Secret '%s' has no key '%s'", spec.PasswordSecretRef, k8sv1.PasswordSecretKey)
+	}
+
+	spec.Password = string(password)
+	return spec, nil
+}
+
+// createJobCredentials stores the superuser password for a Job in a secret owned by owner, so the
+// password secret of the host does not have to be shared with the Job
+func createJobCredentials(ctx context.Context, c client.Writer, scheme *runtime.Scheme, owner client.Object, name, password string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: owner.GetNamespace()},
+		Data:       map[string][]byte{backup.PasswordKey: []byte(password)},
+	}
+	if err := controllerutil.SetControllerReference(owner, secret, scheme); err != nil {
+		return err
+	}
+	if err := c.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// deleteJobCredentials deletes the copy of the superuser password once the Job is finished
+func deleteJobCredentials(ctx context.Context, c client.Writer, namespace, name string) error {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	return client.IgnoreNotFound(c.Delete(ctx, secret))
+}
@@ -18,32 +18,72 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
-	k8sv1alpha1 "github.com/tuunit/external-database-operator/api/v1alpha1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/audit"
+	"github.com/tuunit/external-database-operator/internal/maintenance"
+	"github.com/tuunit/external-database-operator/internal/metrics"
 	"github.com/tuunit/external-database-operator/internal/provider"
+	"github.com/tuunit/external-database-operator/internal/sharding"
+	"github.com/tuunit/external-database-operator/internal/tracing"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 )
 
+// databaseStatsInterval is the interval in which the stats of a database are collected
+const databaseStatsInterval = 5 * time.Minute
+
 // DatabaseReconciler reconciles a Database object
 type DatabaseReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Audit records the statements executed against the hosts
+	Audit audit.Sink
+	// Pools are the connection pools to the hosts shared by all reconcilers
+	Pools *provider.Pools
+	// Shards are the shards of hosts reconciled by this replica, all hosts without sharding
+	Shards *sharding.Sharder
+	// Options configure the workers and the retries of the controller
+	Options controller.Options
+	// Slots limit the reconciles running against a single host
+	Slots *HostSlots
+	// DryRun only plans the statements for all databases instead of executing them
+	DryRun bool
+	// MaxEphemeralTTL caps the lifetime of the databases in namespaces labeled as ephemeral, zero disables the cap
+	MaxEphemeralTTL time.Duration
+	// APIReader reads the namespaces of the databases from the API server, so no informer caches all namespaces
+	APIReader client.Reader
 }
 
 //+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databases,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databases/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databases/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get
+//+kubebuilder:rbac:groups=core,resources=configmaps;secrets,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -54,16 +94,36 @@ type DatabaseReconciler struct {
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.17.0/pkg/reconcile
-func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	log := log.FromContext(ctx)
 
 	finalizer := "k8s.tuunit.com/finalizer"
 
-	database := &k8sv1alpha1.Database{}
+	database := &k8sv1beta1.Database{}
 	if err := r.Get(ctx, req.NamespacedName, database); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	// the database is reconciled by the replica owning the shard of its host
+	if !r.Shards.Owns(database.Namespace, database.Spec.HostRef.Name) {
+		metrics.ForgetDatabase(database.Namespace, database.Name)
+		return ctrl.Result{}, nil
+	}
+
+	host := types.NamespacedName{Namespace: database.Namespace, Name: database.Spec.HostRef.Name}
+	if !r.Slots.acquire(host) {
+		log.V(1).Info("Too many reconciles running against the host, requeueing", "host", host.Name)
+		return ctrl.Result{Requeue: true}, nil
+	}
+	defer r.Slots.release(host)
+
+	// a paused database is not even finalized, its deletion waits until it is resumed
+	if database.Paused() {
+		log.Info("Reconciliation is paused")
+		message := fmt.Sprintf("Reconciliation is paused by the annotation %s", k8sv1beta1.AnnotationPaused)
+		return ctrl.Result{}, r.setPausedCondition(ctx, database, message)
+	}
+
 	if database.ObjectMeta.DeletionTimestamp.IsZero() {
 		if !controllerutil.ContainsFinalizer(database, finalizer) {
 			controllerutil.AddFinalizer(database, finalizer)
@@ -73,7 +133,9 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}
 	} else {
 		if controllerutil.ContainsFinalizer(database, finalizer) {
-			// do stuff before deletion of database
+			if result, err := r.finalize(ctx, database); err != nil || !result.IsZero() {
+				return result, err
+			}
 
 			controllerutil.RemoveFinalizer(database, finalizer)
 			if err := r.Update(ctx, database); err != nil {
@@ -81,70 +143,437 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 			}
 		}
 
+		metrics.ForgetDatabase(database.Namespace, database.Name)
 		return ctrl.Result{}, nil
 	}
 
+	expiry, err := r.expiry(ctx, database)
+	if err != nil {
+		r.Recorder.Event(database, corev1.EventTypeWarning, reasonInvalidExpiry, err.Error())
+		return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonInvalidExpiry, err.Error())
+	}
+	if expiry.IsZero() {
+		database.Status.ExpiresAt = nil
+	} else {
+		if !expiry.After(time.Now()) {
+			// the finalizer applies the deletion policy like for any other deletion
+			message := fmt.Sprintf("Database expired at %s and is deleted", expiry.Format(time.RFC3339))
+			log.Info("Database expired", "expiresAt", expiry)
+			r.Recorder.Event(database, corev1.EventTypeNormal, reasonExpired, message)
+			return ctrl.Result{}, client.IgnoreNotFound(r.Delete(ctx, database))
+		}
+
+		database.Status.ExpiresAt = &metav1.Time{Time: expiry}
+		defer func() {
+			result = requeueBefore(result, err, expiry)
+		}()
+	}
+
 	spec := database.Spec
 
-	if spec.DatabaseHostRef == "" {
-		log.Info("DatabaseHostRef is not set")
-		database.Status.CreationStatus = "DatabaseHostRef is not set"
-		if err := r.Status().Update(ctx, database); err != nil {
-			log.Error(err, "unable to update Database status")
-			return ctrl.Result{}, err
-		}
-		return ctrl.Result{}, nil
+	if spec.HostRef.Name == "" {
+		log.Info("HostRef is not set")
+		return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonHostRefNotSet, "HostRef is not set")
 	}
 
 	databaseHost := &k8sv1.DatabaseHost{}
-	if err := r.Get(ctx, client.ObjectKey{Namespace: database.Namespace, Name: spec.DatabaseHostRef}, databaseHost); err != nil {
+	if err := r.Get(ctx, client.ObjectKey{Namespace: database.Namespace, Name: spec.HostRef.Name}, databaseHost); err != nil {
 		log.Error(err, "unable to fetch DatabaseHost")
 
-		database.Status.CreationStatus = fmt.Sprintf("DatabaseHost '%s' not found", spec.DatabaseHostRef)
-		if err := r.Status().Update(ctx, database); err != nil {
-			log.Error(err, "unable to update Database status")
+		message := fmt.Sprintf("DatabaseHost '%s' not found", spec.HostRef.Name)
+		r.Recorder.Event(database, corev1.EventTypeWarning, reasonHostNotFound, message)
+		if err := r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonHostNotFound, message); err != nil {
 			return ctrl.Result{}, err
 		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	var err error
+	if databaseHost.Paused() {
+		log.Info("Reconciliation of the host is paused")
+		message := fmt.Sprintf("Reconciliation of DatabaseHost '%s' is paused", databaseHost.Name)
+		return ctrl.Result{RequeueAfter: hostHealthCheckInterval}, r.setPausedCondition(ctx, database, message)
+	}
+
+	hostSpec, err := resolveHostSpec(ctx, r, databaseHost)
+	if err != nil {
+		r.Recorder.Event(database, corev1.EventTypeWarning, reasonCredentialsNotFound, err.Error())
+		return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonCredentialsNotFound, err.Error())
+	}
+	databaseHost.Spec = hostSpec
+
+	if message, wait, unavailable := hostUnavailable(r.Pools, databaseHost); unavailable {
+		log.Info("DatabaseHost is unavailable", "retryAfter", wait)
+		return ctrl.Result{RequeueAfter: wait}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonHostUnavailable, message)
+	}
+
+	rename := database.Status.Name != "" && database.Status.Name != spec.Name
+	if rename && !database.RenameAllowed() {
+		message := fmt.Sprintf("Renaming database '%s' to '%s' requires the annotation %s: \"true\"", database.Status.Name, spec.Name, k8sv1beta1.AnnotationAllowRename)
+		r.Recorder.Event(database, corev1.EventTypeWarning, reasonRenameNotAllowed, message)
+		return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonRenameNotAllowed, message)
+	}
+
+	ctx = audit.WithSource(ctx, "Database", database, databaseHost)
+
+	if r.DryRun || database.DryRun() {
+		return ctrl.Result{}, r.plan(ctx, database, databaseHost, rename)
+	}
+
+	database.Status.PendingOperations = nil
+	meta.RemoveStatusCondition(&database.Status.Conditions, k8sv1beta1.ConditionTypeMaintenancePending)
+
+	var renameAt time.Time
+	if rename {
+		open, next, err := maintenance.Open(databaseHost.Spec.MaintenanceWindows, time.Now())
+		if err != nil {
+			r.Recorder.Event(database, corev1.EventTypeWarning, reasonInvalidMaintenanceWindow, err.Error())
+			return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonInvalidMaintenanceWindow, err.Error())
+		}
+		if !open {
+			// the database stays available under its current name until the window opens
+			r.deferOperation(database, fmt.Sprintf("rename database '%s' to '%s'", database.Status.Name, spec.Name), next)
+			renameAt = next
+			spec.Name = database.Status.Name
+			rename = false
+		}
+	}
+
+	var created bool
 
 	switch databaseHost.Spec.Type {
 	case k8sv1.MySQL:
-		log.Info("MySQL database host")
+		message := fmt.Sprintf("Databases on %s host '%s' are not supported yet", databaseHost.Spec.Type, databaseHost.Name)
+		r.Recorder.Event(database, corev1.EventTypeWarning, reasonUnsupportedHostType, message)
+		return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonUnsupportedHostType, message)
 	case k8sv1.Postgres:
 		log.Info("Postgres database host")
 
-		client := provider.NewPostgresClient(databaseHost.Spec)
-		err = client.CreateDB(&spec)
+		client := r.Pools.Postgres(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit)
+		if rename {
+			log.Info("Renaming database", "from", database.Status.Name, "to", spec.Name)
+			if err = client.RenameDB(ctx, database.Status.Name, spec.Name); err != nil {
+				r.Recorder.Event(database, corev1.EventTypeWarning, reasonRenameFailed, err.Error())
+				return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonRenameFailed, err.Error())
+			}
+		}
+
+		// the source only applies when the database is first provisioned
+		cloning := spec.Source != nil && database.Status.Name == ""
+		if cloning && spec.Source.Template != nil {
+			var template string
+			if template, err = r.templateName(ctx, database); err != nil {
+				r.Recorder.Event(database, corev1.EventTypeWarning, reasonCloneFailed, err.Error())
+				return ctrl.Result{RequeueAfter: backupRetryInterval}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonCloneFailed, err.Error())
+			}
+			if created, err = client.CreateDBFromTemplate(ctx, &spec, template); created {
+				now := metav1.Now()
+				database.Status.Clone = &k8sv1beta1.CloneStatus{Source: cloneSource(spec.Source), PointInTime: &now, CompletionTime: &now}
+			}
+		} else {
+			created, err = client.CreateDB(ctx, &spec)
+			if err == nil && cloning && database.Status.Clone == nil {
+				database.Status.Clone = &k8sv1beta1.CloneStatus{Source: cloneSource(spec.Source)}
+			}
+		}
 	}
 
+	if errors.Is(err, provider.ErrUnsupportedLocale) {
+		// retrying does not help until the charset or collation of the database is changed
+		r.Recorder.Event(database, corev1.EventTypeWarning, reasonUnsupportedLocale, err.Error())
+		return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonUnsupportedLocale, err.Error())
+	}
 	if err != nil {
-		database.Status.CreationStatus = err.Error()
+		r.Recorder.Event(database, corev1.EventTypeWarning, reasonCreateFailed, err.Error())
+		return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonCreateFailed, err.Error())
+	}
 
-		if err := r.Status().Update(ctx, database); err != nil {
-			log.Error(err, "unable to update database status")
-			return ctrl.Result{}, err
+	if database.Status.CreationTime.IsZero() {
+		database.Status.CreationTime = metav1.Now()
+	}
+
+	// the database is provisioned while its data is cloned, so the clone is not started twice
+	if clone := database.Status.Clone; clone != nil && clone.CompletionTime == nil {
+		database.Status.Name = spec.Name
+		if done, result, err := r.clone(ctx, database, databaseHost); !done {
+			return result, err
 		}
+	}
+
+	reason, message := r.provisioned(database, spec.Name, created, rename)
+	database.Status.Name = spec.Name
+
+	// the init scripts run once the database exists under its name and holds its cloned data
+	if databaseHost.Spec.Type == k8sv1.Postgres {
+		client := r.Pools.Postgres(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit)
+		if err := r.runInitScripts(ctx, database, client); err != nil {
+			r.Recorder.Event(database, corev1.EventTypeWarning, reasonInitScriptFailed, err.Error())
+			return ctrl.Result{}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonInitScriptFailed, err.Error())
+		}
+	}
 
+	result = ctrl.Result{RequeueAfter: r.collectStats(ctx, database, databaseHost)}
+	if !renameAt.IsZero() {
+		result = requeueBefore(result, nil, renameAt)
+	}
+
+	return result, r.setReadyCondition(ctx, database, metav1.ConditionTrue, reason, message)
+}
+
+// provisioned records the event for the database being created, adopted or renamed under the name
+// and returns the reason and the message for its Ready condition
+func (r *DatabaseReconciler) provisioned(database *k8sv1beta1.Database, name string, created, rename bool) (string, string) {
+	reason := reasonCreated
+	message := fmt.Sprintf("Database '%s' successfully created.", name)
+	if rename {
+		database.Status.PreviousName = database.Status.Name
+
+		reason = reasonRenamed
+		message = fmt.Sprintf("Database '%s' successfully renamed to '%s'.", database.Status.PreviousName, name)
+		r.Recorder.Event(database, corev1.EventTypeNormal, reason, message)
+	} else if created {
+		r.Recorder.Event(database, corev1.EventTypeNormal, reason, message)
+	} else if database.Status.Name == "" {
+		reason = reasonAdopted
+		message = fmt.Sprintf("Database '%s' already existed and was adopted.", name)
+		r.Recorder.Event(database, corev1.EventTypeNormal, reason, message)
+	}
+	return reason, message
+}
+
+// finalize drops the database from its host if the deletion policy requests it.
+// A non-zero result means the drop is deferred and the finalizer has to stay.
+func (r *DatabaseReconciler) finalize(ctx context.Context, database *k8sv1beta1.Database) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if database.Spec.DeletionPolicy != k8sv1beta1.DeletionPolicyDelete || database.Status.Name == "" {
 		return ctrl.Result{}, nil
 	}
 
-	database.Status.CreationStatus = fmt.Sprintf("Database '%s' successfully created.", spec.Name)
-	database.Status.CreationTime = metav1.Now()
+	databaseHost := &k8sv1.DatabaseHost{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: database.Namespace, Name: database.Spec.HostRef.Name}, databaseHost); err != nil {
+		if apierrors.IsNotFound(err) {
+			// without its host the database cannot be dropped anymore
+			message := fmt.Sprintf("DatabaseHost '%s' not found, database '%s' was not dropped", database.Spec.HostRef.Name, database.Status.Name)
+			r.Recorder.Event(database, corev1.EventTypeWarning, reasonHostNotFound, message)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
 
-	if err := r.Status().Update(ctx, database); err != nil {
-		log.Error(err, "unable to update database status")
+	if databaseHost.Paused() {
+		message := fmt.Sprintf("Reconciliation of DatabaseHost '%s' is paused", databaseHost.Name)
+		return ctrl.Result{RequeueAfter: hostHealthCheckInterval}, r.setPausedCondition(ctx, database, message)
+	}
+
+	hostSpec, err := resolveHostSpec(ctx, r, databaseHost)
+	if err != nil {
+		r.Recorder.Event(database, corev1.EventTypeWarning, reasonCredentialsNotFound, err.Error())
 		return ctrl.Result{}, err
 	}
+	databaseHost.Spec = hostSpec
+
+	if message, wait, unavailable := hostUnavailable(r.Pools, databaseHost); unavailable {
+		log.Info("DatabaseHost is unavailable, postponing the drop", "retryAfter", wait)
+		return ctrl.Result{RequeueAfter: wait}, r.setReadyCondition(ctx, database, metav1.ConditionFalse, reasonHostUnavailable, message)
+	}
+
+	ctx = audit.WithSource(ctx, "Database", database, databaseHost)
+	dryRun := r.DryRun || database.DryRun()
+
+	if !dryRun {
+		open, next, err := maintenance.Open(databaseHost.Spec.MaintenanceWindows, time.Now())
+		if err != nil {
+			r.Recorder.Event(database, corev1.EventTypeWarning, reasonInvalidMaintenanceWindow, err.Error())
+			return ctrl.Result{}, err
+		}
+		if !open {
+			r.deferOperation(database, fmt.Sprintf("drop database '%s'", database.Status.Name), next)
+			return ctrl.Result{RequeueAfter: time.Until(next)}, r.Status().Update(ctx, database)
+		}
+	}
+
+	var dropped bool
+
+	switch databaseHost.Spec.Type {
+	case k8sv1.MySQL:
+		log.Info("MySQL database host")
+	case k8sv1.Postgres:
+		client := r.Pools.Postgres(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit)
+		if dryRun {
+			var plan provider.Plan
+			if plan, err = client.PlanDropDB(ctx, database.Status.Name); err == nil {
+				r.Recorder.Event(database, corev1.EventTypeNormal, reasonDryRun, planMessage(plan))
+			}
+		} else {
+			dropped, err = client.DropDB(ctx, database.Status.Name)
+		}
+	}
+
+	if err != nil {
+		r.Recorder.Event(database, corev1.EventTypeWarning, reasonDropFailed, err.Error())
+		return ctrl.Result{}, err
+	}
+
+	if dropped {
+		r.Recorder.Eventf(database, corev1.EventTypeNormal, reasonDropped, "Database '%s' successfully dropped.", database.Status.Name)
+	}
 
 	return ctrl.Result{}, nil
 }
 
+// deferOperation queues the operation in the status of the database until the next maintenance window
+// of its host opens. The Ready condition is left alone, as the database stays usable until then.
+func (r *DatabaseReconciler) deferOperation(database *k8sv1beta1.Database, operation string, next time.Time) {
+	message := fmt.Sprintf("Waiting for the maintenance window at %s to %s", next.Format(time.RFC3339), operation)
+	r.Recorder.Event(database, corev1.EventTypeNormal, reasonDeferred, message)
+
+	database.Status.PendingOperations = append(database.Status.PendingOperations, operation)
+	meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+		Type:               k8sv1beta1.ConditionTypeMaintenancePending,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonDeferred,
+		Message:            message,
+		ObservedGeneration: database.Generation,
+	})
+}
+
+// setPausedCondition records in the status of the database that its reconciliation is paused
+func (r *DatabaseReconciler) setPausedCondition(ctx context.Context, database *k8sv1beta1.Database, message string) error {
+	meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+		Type:               k8sv1beta1.ConditionTypePaused,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonPaused,
+		Message:            message,
+		ObservedGeneration: database.Generation,
+	})
+
+	if err := r.Status().Update(ctx, database); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update Database status")
+		return err
+	}
+
+	return nil
+}
+
+// plan publishes the statements which would bring the database to its desired state without executing them
+func (r *DatabaseReconciler) plan(ctx context.Context, database *k8sv1beta1.Database, databaseHost *k8sv1.DatabaseHost, rename bool) error {
+	log := log.FromContext(ctx)
+
+	var err error
+	var plan provider.Plan
+
+	switch databaseHost.Spec.Type {
+	case k8sv1.MySQL:
+		log.Info("MySQL database host")
+	case k8sv1.Postgres:
+		client := r.Pools.Postgres(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit)
+		if rename {
+			plan, err = client.PlanRenameDB(ctx, database.Status.Name, database.Spec.Name)
+		}
+		// the renamed database already exists, so it is only created if there is nothing to rename
+		if err == nil && len(plan) == 0 {
+			if source := database.Spec.Source; source != nil && source.Template != nil && database.Status.Name == "" {
+				var template string
+				if template, err = r.templateName(ctx, database); err == nil {
+					plan, err = client.PlanCreateDBFromTemplate(ctx, &database.Spec, template)
+				}
+			} else {
+				plan, err = client.PlanCreateDB(ctx, &database.Spec)
+			}
+		}
+		if err == nil {
+			var scripts provider.Plan
+			scripts, err = r.planInitScripts(ctx, database, client)
+			plan = append(plan, scripts...)
+		}
+	}
+
+	if err != nil {
+		r.Recorder.Event(database, corev1.EventTypeWarning, reasonPlanFailed, err.Error())
+		return r.setPlannedCondition(ctx, database, nil, metav1.ConditionFalse, reasonPlanFailed, err.Error())
+	}
+
+	message := planMessage(plan)
+	r.Recorder.Event(database, corev1.EventTypeNormal, reasonDryRun, message)
+	return r.setPlannedCondition(ctx, database, plan, metav1.ConditionTrue, reasonDryRun, message)
+}
+
+// setPlannedCondition records the outcome of a dry run in the status of the database
+func (r *DatabaseReconciler) setPlannedCondition(ctx context.Context, database *k8sv1beta1.Database, plan provider.Plan, status metav1.ConditionStatus, reason, message string) error {
+	database.Status.ObservedGeneration = database.Generation
+	database.Status.PlannedStatements = plan.Strings()
+	meta.RemoveStatusCondition(&database.Status.Conditions, k8sv1beta1.ConditionTypePaused)
+	meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+		Type:               k8sv1beta1.ConditionTypePlanned,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: database.Generation,
+	})
+
+	if err := r.Status().Update(ctx, database); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update Database status")
+		return err
+	}
+
+	return nil
+}
+
+// setReadyCondition records the outcome of the reconciliation in the status of the database
+func (r *DatabaseReconciler) setReadyCondition(ctx context.Context, database *k8sv1beta1.Database, status metav1.ConditionStatus, reason, message string) error {
+	database.Status.ObservedGeneration = database.Generation
+	// a reconciliation which is not a dry run supersedes the plan of a previous one
+	database.Status.PlannedStatements = nil
+	meta.RemoveStatusCondition(&database.Status.Conditions, k8sv1beta1.ConditionTypePlanned)
+	meta.RemoveStatusCondition(&database.Status.Conditions, k8sv1beta1.ConditionTypePaused)
+	meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+		Type:               k8sv1beta1.ConditionTypeReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: database.Generation,
+	})
+
+	if err := r.Status().Update(ctx, database); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update Database status")
+		return err
+	}
+
+	return nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *DatabaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&k8sv1alpha1.Database{}).
-		Complete(r)
+	if err := indexHostRef(context.Background(), mgr, &k8sv1beta1.Database{}); err != nil {
+		return err
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&k8sv1beta1.Database{}).
+		Owns(&batchv1.Job{}).
+		Watches(&k8sv1.DatabaseHost{}, handler.EnqueueRequestsFromMapFunc(r.databasesForHost), builder.WithPredicates(hostChanged)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.databasesForScriptSource)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.databasesForScriptSource))
+
+	if r.Shards != nil {
+		b = b.WatchesRawSource(r.Shards.Source(&k8sv1beta1.DatabaseList{}, hostName), &handler.EnqueueRequestForObject{})
+	}
+
+	return b.WithOptions(r.Options).Complete(tracing.Reconciler("Database", r))
+}
+
+// databasesForHost returns the Databases on the host, so they are reconciled once the host
+// is created or recovers instead of waiting for their next resync
+func (r *DatabaseReconciler) databasesForHost(ctx context.Context, host client.Object) []reconcile.Request {
+	list := &k8sv1beta1.DatabaseList{}
+	if err := dependents(ctx, r, host, list); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list Databases of DatabaseHost")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+	}
+	return requests
 }
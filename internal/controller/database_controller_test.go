@@ -18,16 +18,26 @@ package controller
 
 import (
 	"context"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	k8sv1alpha1 "github.com/tuunit/external-database-operator/api/v1alpha1"
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/provider"
 )
 
 var _ = Describe("Database Controller", func() {
@@ -40,13 +50,13 @@ var _ = Describe("Database Controller", func() {
 			Name:      resourceName,
 			Namespace: "default", // TODO(user):Modify as needed
 		}
-		database := &k8sv1alpha1.Database{}
+		database := &k8sv1beta1.Database{}
 
 		BeforeEach(func() {
 			By("creating the custom resource for the Kind Database")
 			err := k8sClient.Get(ctx, typeNamespacedName, database)
 			if err != nil && errors.IsNotFound(err) {
-				resource := &k8sv1alpha1.Database{
+				resource := &k8sv1beta1.Database{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      resourceName,
 						Namespace: "default",
@@ -59,7 +69,7 @@ var _ = Describe("Database Controller", func() {
 
 		AfterEach(func() {
 			// TODO(user): Cleanup logic after each test, like removing the resource instance.
-			resource := &k8sv1alpha1.Database{}
+			resource := &k8sv1beta1.Database{}
 			err := k8sClient.Get(ctx, typeNamespacedName, resource)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -69,8 +79,9 @@ var _ = Describe("Database Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &DatabaseReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -81,4 +92,488 @@ var _ = Describe("Database Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When a DatabaseHost changes", func() {
+		ctx := context.Background()
+
+		It("should enqueue the databases on the host", func() {
+			onHost := &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "on-host", Namespace: "default"},
+				Spec:       k8sv1beta1.DatabaseSpec{HostRef: k8sv1beta1.DatabaseHostReference{Name: "postgres"}},
+			}
+			elsewhere := &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "elsewhere", Namespace: "default"},
+				Spec:       k8sv1beta1.DatabaseSpec{HostRef: k8sv1beta1.DatabaseHostReference{Name: "mysql"}},
+			}
+			otherNamespace := &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "other-namespace", Namespace: "other"},
+				Spec:       k8sv1beta1.DatabaseSpec{HostRef: k8sv1beta1.DatabaseHostReference{Name: "postgres"}},
+			}
+
+			c := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithIndex(&k8sv1beta1.Database{}, hostRefField, hostRef).
+				WithObjects(onHost, elsewhere, otherNamespace).
+				Build()
+			controllerReconciler := &DatabaseReconciler{Client: c}
+
+			host := &k8sv1.DatabaseHost{ObjectMeta: metav1.ObjectMeta{Name: "postgres", Namespace: "default"}}
+			Expect(controllerReconciler.databasesForHost(ctx, host)).To(ConsistOf(reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: "on-host", Namespace: "default"},
+			}))
+		})
+	})
+	Context("When cloning a database", func() {
+		ctx := context.Background()
+
+		It("should only accept templates on the same host", func() {
+			staging := &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "staging", Namespace: "default"},
+				Spec:       k8sv1beta1.DatabaseSpec{Name: "staging", HostRef: k8sv1beta1.DatabaseHostReference{Name: "postgres"}},
+				Status:     k8sv1beta1.DatabaseStatus{Name: "staging"},
+			}
+			preview := &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "preview", Namespace: "default"},
+				Spec: k8sv1beta1.DatabaseSpec{
+					Name:    "preview",
+					HostRef: k8sv1beta1.DatabaseHostReference{Name: "postgres"},
+					Source:  &k8sv1beta1.DatabaseSource{Template: &k8sv1beta1.DatabaseReference{Name: "staging"}},
+				},
+			}
+
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(staging).Build()
+			controllerReconciler := &DatabaseReconciler{Client: c}
+
+			Expect(cloneSource(preview.Spec.Source)).To(Equal("template/staging"))
+			Expect(controllerReconciler.templateName(ctx, preview)).To(Equal("staging"))
+
+			preview.Spec.HostRef.Name = "other"
+			_, err := controllerReconciler.templateName(ctx, preview)
+			Expect(err).To(MatchError(ContainSubstring("same host")))
+		})
+
+		It("should record the completion of the clone Job", func() {
+			preview := &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "preview", Namespace: "default"},
+				Spec: k8sv1beta1.DatabaseSpec{
+					Name:    "preview",
+					HostRef: k8sv1beta1.DatabaseHostReference{Name: "postgres"},
+					Source:  &k8sv1beta1.DatabaseSource{FromBackup: &k8sv1beta1.DatabaseBackupReference{Name: "nightly"}},
+				},
+				Status: k8sv1beta1.DatabaseStatus{Clone: &k8sv1beta1.CloneStatus{Source: "backup/nightly"}},
+			}
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "preview-clone", Namespace: "default"},
+				Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+					{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+				}},
+			}
+
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(preview, job).Build()
+			controllerReconciler := &DatabaseReconciler{Client: c, Recorder: record.NewFakeRecorder(10)}
+
+			done, _, err := controllerReconciler.clone(ctx, preview, &k8sv1.DatabaseHost{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(done).To(BeTrue())
+			Expect(preview.Status.Clone.CompletionTime).NotTo(BeNil())
+		})
+	})
+
+	Context("When a database expires", func() {
+		ctx := context.Background()
+
+		It("should cap the lifetime in ephemeral namespaces", func() {
+			created := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+			database := &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "ci", Namespace: "ci", CreationTimestamp: created},
+				Spec: k8sv1beta1.DatabaseSpec{
+					Name: "ci",
+					TTL:  &metav1.Duration{Duration: 72 * time.Hour},
+				},
+			}
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   "ci",
+				Labels: map[string]string{k8sv1beta1.LabelEphemeral: "true"},
+			}}
+
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(namespace).Build()
+			controllerReconciler := &DatabaseReconciler{Client: c, APIReader: c}
+
+			Expect(controllerReconciler.expiry(ctx, database)).To(BeTemporally("==", created.Add(72*time.Hour)))
+
+			controllerReconciler.MaxEphemeralTTL = 24 * time.Hour
+			Expect(controllerReconciler.expiry(ctx, database)).To(BeTemporally("==", created.Add(24*time.Hour)))
+
+			database.Annotations = map[string]string{k8sv1beta1.AnnotationTTL: "2h"}
+			Expect(controllerReconciler.expiry(ctx, database)).To(BeTemporally("==", created.Add(2*time.Hour)))
+
+			database.Annotations[k8sv1beta1.AnnotationTTL] = "two hours"
+			_, err := controllerReconciler.expiry(ctx, database)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should requeue until the expiry", func() {
+			expiry := time.Now().Add(time.Minute)
+
+			result := requeueBefore(reconcile.Result{}, nil, expiry)
+			Expect(result.RequeueAfter).To(BeNumerically("~", time.Minute, time.Second))
+
+			result = requeueBefore(reconcile.Result{RequeueAfter: time.Second}, nil, expiry)
+			Expect(result.RequeueAfter).To(Equal(time.Second))
+		})
+
+		It("should delete the expired Database", func() {
+			database := &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "expired",
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(time.Now().Add(-2 * time.Hour)),
+					Finalizers:        []string{"k8s.tuunit.com/finalizer"},
+				},
+				Spec: k8sv1beta1.DatabaseSpec{
+					Name:    "expired",
+					HostRef: k8sv1beta1.DatabaseHostReference{Name: "postgres"},
+					TTL:     &metav1.Duration{Duration: time.Hour},
+				},
+			}
+
+			c := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithStatusSubresource(database).
+				WithObjects(database).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler := &DatabaseReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: "expired", Namespace: "default"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).To(Receive(ContainSubstring(reasonExpired)))
+
+			Expect(c.Get(ctx, types.NamespacedName{Name: "expired", Namespace: "default"}, database)).To(Succeed())
+			Expect(database.DeletionTimestamp).NotTo(BeNil())
+		})
+	})
+
+	Context("When provisioning a database", func() {
+		ctx := context.Background()
+
+		It("should record the creation, adoption and rename", func() {
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler := &DatabaseReconciler{Recorder: recorder}
+
+			database := &k8sv1beta1.Database{Spec: k8sv1beta1.DatabaseSpec{Name: "orders"}}
+			reason, _ := controllerReconciler.provisioned(database, database.Spec.Name, true, false)
+			Expect(reason).To(Equal(reasonCreated))
+			Expect(recorder.Events).To(Receive(ContainSubstring(reasonCreated)))
+
+			reason, _ = controllerReconciler.provisioned(database, database.Spec.Name, false, false)
+			Expect(reason).To(Equal(reasonAdopted))
+			Expect(recorder.Events).To(Receive(ContainSubstring(reasonAdopted)))
+
+			database.Status.Name = "orders"
+			reason, _ = controllerReconciler.provisioned(database, database.Spec.Name, false, false)
+			Expect(reason).To(Equal(reasonCreated))
+			Expect(recorder.Events).NotTo(Receive())
+
+			database.Spec.Name = "purchases"
+			reason, message := controllerReconciler.provisioned(database, database.Spec.Name, false, true)
+			Expect(reason).To(Equal(reasonRenamed))
+			Expect(message).To(ContainSubstring("'orders' successfully renamed to 'purchases'"))
+			Expect(database.Status.PreviousName).To(Equal("orders"))
+			Expect(recorder.Events).To(Receive(ContainSubstring(reasonRenamed)))
+		})
+
+		It("should record the failure to create the database", func() {
+			database, host := provisioningObjects(k8sv1.Postgres)
+			c := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithStatusSubresource(database).
+				WithObjects(database, host).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler := &DatabaseReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(database)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).To(Receive(ContainSubstring(reasonCreateFailed)))
+
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(database), database)).To(Succeed())
+			ready := meta.FindStatusCondition(database.Status.Conditions, k8sv1beta1.ConditionTypeReady)
+			Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+			Expect(ready.Reason).To(Equal(reasonCreateFailed))
+		})
+
+		It("should not report databases on MySQL hosts as ready", func() {
+			database, host := provisioningObjects(k8sv1.MySQL)
+			c := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithStatusSubresource(database).
+				WithObjects(database, host).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler := &DatabaseReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(database)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).To(Receive(ContainSubstring(reasonUnsupportedHostType)))
+
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(database), database)).To(Succeed())
+			ready := meta.FindStatusCondition(database.Status.Conditions, k8sv1beta1.ConditionTypeReady)
+			Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+			Expect(ready.Reason).To(Equal(reasonUnsupportedHostType))
+			Expect(database.Status.Name).To(BeEmpty())
+		})
+	})
+
+	Context("When the reconciliation is paused or deferred", func() {
+		ctx := context.Background()
+
+		It("should neither finalize nor provision a paused database", func() {
+			database, host := provisioningObjects(k8sv1.Postgres)
+			database.Finalizers = nil
+			database.Annotations = map[string]string{k8sv1beta1.AnnotationPaused: "true"}
+			c := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithStatusSubresource(database).
+				WithObjects(database, host).
+				Build()
+			controllerReconciler := &DatabaseReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(10)}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(database)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.IsZero()).To(BeTrue())
+
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(database), database)).To(Succeed())
+			Expect(database.Finalizers).To(BeEmpty())
+			Expect(meta.IsStatusConditionTrue(database.Status.Conditions, k8sv1beta1.ConditionTypePaused)).To(BeTrue())
+		})
+
+		It("should defer a rename until the maintenance window of the host opens", func() {
+			database, host := provisioningObjects(k8sv1.Postgres)
+			database.Annotations = map[string]string{k8sv1beta1.AnnotationAllowRename: "true"}
+			database.Status.Name = "purchases"
+			host.Spec.MaintenanceWindows = []k8sv1.MaintenanceWindow{{
+				Schedule: "0 0 1 1 *",
+				Duration: metav1.Duration{Duration: time.Minute},
+			}}
+			c := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithStatusSubresource(database).
+				WithObjects(database, host).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler := &DatabaseReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(database)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Events).To(Receive(ContainSubstring(reasonDeferred)))
+
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(database), database)).To(Succeed())
+			Expect(database.Status.Name).To(Equal("purchases"))
+			Expect(database.Status.PendingOperations).To(ConsistOf("rename database 'purchases' to 'orders'"))
+			Expect(meta.IsStatusConditionTrue(database.Status.Conditions, k8sv1beta1.ConditionTypeMaintenancePending)).To(BeTrue())
+			Expect(meta.FindStatusCondition(database.Status.Conditions, k8sv1beta1.ConditionTypeReady).Reason).NotTo(Equal(reasonDeferred))
+		})
+
+		It("should keep a deferred database ready", func() {
+			database, _ := provisioningObjects(k8sv1.Postgres)
+			database.Status.Conditions = []metav1.Condition{{Type: k8sv1beta1.ConditionTypeReady, Status: metav1.ConditionTrue, Reason: reasonCreated}}
+			controllerReconciler := &DatabaseReconciler{Recorder: record.NewFakeRecorder(10)}
+
+			controllerReconciler.deferOperation(database, "rename database 'purchases' to 'orders'", time.Now().Add(time.Hour))
+			Expect(meta.IsStatusConditionTrue(database.Status.Conditions, k8sv1beta1.ConditionTypeReady)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(database.Status.Conditions, k8sv1beta1.ConditionTypeMaintenancePending)).To(BeTrue())
+			Expect(database.Status.PendingOperations).To(ConsistOf("rename database 'purchases' to 'orders'"))
+		})
+	})
+
+	Context("When the host is unavailable", func() {
+		ctx := context.Background()
+
+		It("should not touch the host while its circuit is open", func() {
+			database, host := provisioningObjects(k8sv1.Postgres)
+			c := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithStatusSubresource(database).
+				WithObjects(database, host).
+				Build()
+			pools := provider.NewPools(provider.PoolOptions{FailureThreshold: 1})
+			controllerReconciler := &DatabaseReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(10), Pools: pools}
+
+			Expect(pools.Postgres(client.ObjectKeyFromObject(host), host.Spec, nil).CheckConnection(ctx)).NotTo(Succeed())
+			open, _ := pools.CircuitOpen(client.ObjectKeyFromObject(host))
+			Expect(open).To(BeTrue())
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(database)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(database), database)).To(Succeed())
+			Expect(meta.FindStatusCondition(database.Status.Conditions, k8sv1beta1.ConditionTypeReady).Reason).To(Equal(reasonHostUnavailable))
+		})
+
+		It("should requeue while all slots of the host are taken", func() {
+			database, host := provisioningObjects(k8sv1.Postgres)
+			database.Annotations = map[string]string{k8sv1beta1.AnnotationPaused: "true"}
+			c := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithStatusSubresource(database).
+				WithObjects(database, host).
+				Build()
+			slots := NewHostSlots(1)
+			controllerReconciler := &DatabaseReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(10), Slots: slots}
+
+			Expect(slots.acquire(types.NamespacedName{Namespace: host.Namespace, Name: host.Name})).To(BeTrue())
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(database)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Requeue).To(BeTrue())
+
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(database), database)).To(Succeed())
+			Expect(database.Status.Conditions).To(BeEmpty())
+
+			slots.release(types.NamespacedName{Namespace: host.Namespace, Name: host.Name})
+			result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(database)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Requeue).To(BeFalse())
+			Expect(slots.acquire(types.NamespacedName{Namespace: host.Namespace, Name: host.Name})).To(BeTrue())
+		})
+	})
+
+	Context("When running init scripts", func() {
+		ctx := context.Background()
+
+		It("should only return the scripts which have to run", func() {
+			seed := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "seed", Namespace: "default"},
+				Data: map[string]string{
+					"colors.sql": "INSERT INTO colors VALUES ('red');",
+					"sizes.sql":  "INSERT INTO sizes VALUES ('small');",
+				},
+			}
+			grants := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "grants", Namespace: "default"},
+				Data:       map[string][]byte{"grants.sql": []byte("GRANT SELECT ON colors TO reporting;")},
+			}
+			database := &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+				Spec: k8sv1beta1.DatabaseSpec{
+					Name: "app",
+					InitScripts: []k8sv1beta1.InitScript{
+						{
+							Name:            "colors",
+							ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "seed"}, Key: "colors.sql"},
+						},
+						{
+							Name:            "sizes",
+							ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "seed"}, Key: "sizes.sql"},
+							RunPolicy:       k8sv1beta1.InitScriptRunOnChange,
+						},
+						{
+							Name:         "grants",
+							SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "grants"}, Key: "grants.sql"},
+						},
+					},
+				},
+			}
+
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(seed, grants, database).Build()
+			controllerReconciler := &DatabaseReconciler{Client: c}
+
+			scripts, err := controllerReconciler.pendingInitScripts(ctx, database)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(HaveLen(3))
+			Expect(scripts[2].Sensitive).To(BeTrue())
+
+			for _, script := range scripts {
+				setInitScriptStatus(database, k8sv1beta1.InitScriptStatus{Name: script.Name, Checksum: script.checksum})
+			}
+			database.Status.InitScripts = append(database.Status.InitScripts, k8sv1beta1.InitScriptStatus{Name: "removed"})
+
+			scripts, err = controllerReconciler.pendingInitScripts(ctx, database)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(BeEmpty())
+			Expect(database.Status.InitScripts).To(HaveLen(3))
+
+			seed.Data["colors.sql"] = "INSERT INTO colors VALUES ('blue');"
+			seed.Data["sizes.sql"] = "INSERT INTO sizes VALUES ('large');"
+			Expect(c.Update(ctx, seed)).To(Succeed())
+
+			scripts, err = controllerReconciler.pendingInitScripts(ctx, database)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(HaveLen(1))
+			Expect(scripts[0].Name).To(Equal("sizes"))
+		})
+
+		It("should enqueue the databases using a ConfigMap", func() {
+			database := &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+				Spec: k8sv1beta1.DatabaseSpec{
+					Name: "app",
+					InitScripts: []k8sv1beta1.InitScript{{
+						Name:            "colors",
+						ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "seed"}, Key: "colors.sql"},
+					}},
+				},
+			}
+
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(database).Build()
+			controllerReconciler := &DatabaseReconciler{Client: c}
+
+			Expect(controllerReconciler.databasesForScriptSource(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "seed", Namespace: "default"}})).
+				To(ConsistOf(reconcile.Request{NamespacedName: types.NamespacedName{Name: "app", Namespace: "default"}}))
+			Expect(controllerReconciler.databasesForScriptSource(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "seed", Namespace: "default"}})).
+				To(BeEmpty())
+		})
+	})
+
+	Context("When collecting stats", func() {
+		It("should collect the stats at most once per interval", func() {
+			collectedAt := metav1.NewTime(time.Now().Add(-time.Minute))
+			database := &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+				Spec:       k8sv1beta1.DatabaseSpec{Name: "app"},
+				Status: k8sv1beta1.DatabaseStatus{
+					Stats: &k8sv1beta1.DatabaseStats{SizeBytes: 1024, Size: "1.0Ki", CollectedAt: collectedAt},
+				},
+			}
+
+			controllerReconciler := &DatabaseReconciler{}
+			next := controllerReconciler.collectStats(context.Background(), database, &k8sv1.DatabaseHost{})
+			Expect(next).To(BeNumerically("~", databaseStatsInterval-time.Minute, time.Second))
+			Expect(database.Status.Stats.CollectedAt).To(Equal(collectedAt))
+		})
+
+		It("should format sizes with binary units", func() {
+			Expect(formatBytes(512)).To(Equal("512"))
+			Expect(formatBytes(1536)).To(Equal("1.5Ki"))
+			Expect(formatBytes(8 * 1024 * 1024)).To(Equal("8.0Mi"))
+			Expect(formatBytes(3 << 40)).To(Equal("3.0Ti"))
+		})
+	})
 })
+
+// provisioningObjects returns a Database on a host of the given type which refuses all connections
+func provisioningObjects(hostType k8sv1.DatabaseType) (*k8sv1beta1.Database, *k8sv1.DatabaseHost) {
+	database := &k8sv1beta1.Database{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "orders",
+			Namespace:  "default",
+			Finalizers: []string{"k8s.tuunit.com/finalizer"},
+		},
+		Spec: k8sv1beta1.DatabaseSpec{
+			Name:    "orders",
+			HostRef: k8sv1beta1.DatabaseHostReference{Name: "unreachable"},
+		},
+	}
+	host := &k8sv1.DatabaseHost{
+		ObjectMeta: metav1.ObjectMeta{Name: "unreachable", Namespace: "default"},
+		Spec: k8sv1.DatabaseHostSpec{
+			Host:      "127.0.0.1",
+			Port:      1,
+			Type:      hostType,
+			Superuser: "postgres",
+			Password:  "postgres",
+		},
+	}
+	return database, host
+}
@@ -0,0 +1,330 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/backup"
+	"github.com/tuunit/external-database-operator/internal/sharding"
+	"github.com/tuunit/external-database-operator/internal/tracing"
+)
+
+// backupRetryInterval is the interval in which a backup waiting for its database is retried
+const backupRetryInterval = 30 * time.Second
+
+// DatabaseBackupReconciler reconciles a DatabaseBackup object
+type DatabaseBackupReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// APIReader reads the pods of the Jobs from the API server, so no informer caches all pods
+	APIReader client.Reader
+	// Shards are the shards of hosts reconciled by this replica, all hosts without sharding
+	Shards *sharding.Sharder
+	// Options configure the workers and the retries of the controller
+	Options controller.Options
+}
+
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databasebackups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databasebackups/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databasebackups/finalizers,verbs=update
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;delete
+
+// Reconcile runs a Job dumping the referenced database to the configured storage and
+// records the location, size and checksum of the dump once the Job succeeded.
+func (r *DatabaseBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	finalizer := "k8s.tuunit.com/finalizer"
+
+	databaseBackup := &k8sv1beta1.DatabaseBackup{}
+	if err := r.Get(ctx, req.NamespacedName, databaseBackup); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if databaseBackup.ObjectMeta.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(databaseBackup, finalizer) {
+			controllerutil.AddFinalizer(databaseBackup, finalizer)
+			if err := r.Update(ctx, databaseBackup); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	} else {
+		if controllerutil.ContainsFinalizer(databaseBackup, finalizer) {
+			if result, err := r.finalize(ctx, databaseBackup); err != nil || !result.IsZero() {
+				return result, err
+			}
+
+			controllerutil.RemoveFinalizer(databaseBackup, finalizer)
+			if err := r.Update(ctx, databaseBackup); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if databaseBackup.Finished() {
+		return ctrl.Result{}, nil
+	}
+
+	database := &k8sv1beta1.Database{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: databaseBackup.Namespace, Name: databaseBackup.Spec.DatabaseRef.Name}, database); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		message := fmt.Sprintf("Database '%s' not found", databaseBackup.Spec.DatabaseRef.Name)
+		r.Recorder.Event(databaseBackup, corev1.EventTypeWarning, reasonDatabaseNotFound, message)
+		return ctrl.Result{RequeueAfter: backupRetryInterval}, r.setReadyCondition(ctx, databaseBackup, metav1.ConditionFalse, reasonDatabaseNotFound, message)
+	}
+
+	// the backup is run by the replica owning the shard of the host of its database
+	if !r.Shards.Owns(database.Namespace, database.Spec.HostRef.Name) {
+		return ctrl.Result{}, nil
+	}
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: databaseBackup.Namespace, Name: databaseBackup.Name + "-backup"}, job)
+	if apierrors.IsNotFound(err) {
+		return r.start(ctx, databaseBackup, database)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	switch {
+	case jobFinished(job, batchv1.JobComplete):
+		result, err := r.result(ctx, job)
+		if err != nil {
+			log.Error(err, "unable to read result of backup Job")
+			return r.fail(ctx, databaseBackup, err.Error())
+		}
+
+		databaseBackup.Status.Phase = k8sv1beta1.BackupPhaseSucceeded
+		databaseBackup.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+		databaseBackup.Status.Location = backup.Location(databaseBackup)
+		databaseBackup.Status.Size = result.Size
+		databaseBackup.Status.Checksum = result.Checksum
+
+		message := fmt.Sprintf("Database '%s' dumped to '%s'", database.Status.Name, databaseBackup.Status.Location)
+		r.Recorder.Event(databaseBackup, corev1.EventTypeNormal, reasonBackupSucceeded, message)
+		if err := deleteJobCredentials(ctx, r, databaseBackup.Namespace, credentialsSecret(databaseBackup)); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.setReadyCondition(ctx, databaseBackup, metav1.ConditionTrue, reasonBackupSucceeded, message)
+	case jobFinished(job, batchv1.JobFailed):
+		return r.fail(ctx, databaseBackup, fmt.Sprintf("Job '%s' failed, see the logs of its pods", job.Name))
+	}
+
+	if databaseBackup.Status.Phase != k8sv1beta1.BackupPhaseRunning {
+		databaseBackup.Status.Phase = k8sv1beta1.BackupPhaseRunning
+		return ctrl.Result{}, r.setReadyCondition(ctx, databaseBackup, metav1.ConditionFalse, reasonBackupRunning, fmt.Sprintf("Job '%s' is running", job.Name))
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// start creates the credentials and the Job dumping the database
+func (r *DatabaseBackupReconciler) start(ctx context.Context, databaseBackup *k8sv1beta1.DatabaseBackup, database *k8sv1beta1.Database) (ctrl.Result, error) {
+	databaseHost := &k8sv1.DatabaseHost{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: database.Namespace, Name: database.Spec.HostRef.Name}, databaseHost); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		message := fmt.Sprintf("DatabaseHost '%s' not found", database.Spec.HostRef.Name)
+		r.Recorder.Event(databaseBackup, corev1.EventTypeWarning, reasonHostNotFound, message)
+		return ctrl.Result{RequeueAfter: backupRetryInterval}, r.setReadyCondition(ctx, databaseBackup, metav1.ConditionFalse, reasonHostNotFound, message)
+	}
+
+	// databases on MySQL hosts are never provisioned, so they would never become ready
+	if databaseHost.Spec.Type == k8sv1.MySQL {
+		return r.fail(ctx, databaseBackup, fmt.Sprintf("Backups of databases on %s host '%s' are not supported yet", databaseHost.Spec.Type, databaseHost.Name))
+	}
+
+	// the name of the database on the host is only known once the database is provisioned
+	if database.Status.Name == "" || !meta.IsStatusConditionTrue(database.Status.Conditions, k8sv1beta1.ConditionTypeReady) {
+		message := fmt.Sprintf("Database '%s' is not ready", database.Name)
+		databaseBackup.Status.Phase = k8sv1beta1.BackupPhasePending
+		return ctrl.Result{RequeueAfter: backupRetryInterval}, r.setReadyCondition(ctx, databaseBackup, metav1.ConditionFalse, reasonDatabaseNotReady, message)
+	}
+
+	hostSpec, err := resolveHostSpec(ctx, r, databaseHost)
+	if err != nil {
+		r.Recorder.Event(databaseBackup, corev1.EventTypeWarning, reasonCredentialsNotFound, err.Error())
+		return ctrl.Result{RequeueAfter: backupRetryInterval}, r.setReadyCondition(ctx, databaseBackup, metav1.ConditionFalse, reasonCredentialsNotFound, err.Error())
+	}
+
+	if err := createJobCredentials(ctx, r, r.Scheme, databaseBackup, credentialsSecret(databaseBackup), hostSpec.Password); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	job, err := backup.Job(databaseBackup, backup.Target{
+		Host:              hostSpec,
+		Database:          database.Status.Name,
+		CredentialsSecret: credentialsSecret(databaseBackup),
+	})
+	if err != nil {
+		return r.fail(ctx, databaseBackup, err.Error())
+	}
+	if err := controllerutil.SetControllerReference(databaseBackup, job, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) {
+		return ctrl.Result{}, err
+	}
+
+	message := fmt.Sprintf("Job '%s' started dumping database '%s'", job.Name, database.Status.Name)
+	r.Recorder.Event(databaseBackup, corev1.EventTypeNormal, reasonBackupStarted, message)
+
+	databaseBackup.Status.Phase = k8sv1beta1.BackupPhaseRunning
+	databaseBackup.Status.JobName = job.Name
+	databaseBackup.Status.StartTime = &metav1.Time{Time: time.Now()}
+	databaseBackup.Status.DatabaseType = hostSpec.Type
+	return ctrl.Result{}, r.setReadyCondition(ctx, databaseBackup, metav1.ConditionFalse, reasonBackupRunning, message)
+}
+
+// fail marks the backup as failed for good
+func (r *DatabaseBackupReconciler) fail(ctx context.Context, databaseBackup *k8sv1beta1.DatabaseBackup, message string) (ctrl.Result, error) {
+	r.Recorder.Event(databaseBackup, corev1.EventTypeWarning, reasonBackupFailed, message)
+	if err := deleteJobCredentials(ctx, r, databaseBackup.Namespace, credentialsSecret(databaseBackup)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	databaseBackup.Status.Phase = k8sv1beta1.BackupPhaseFailed
+	databaseBackup.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	return ctrl.Result{}, r.setReadyCondition(ctx, databaseBackup, metav1.ConditionFalse, reasonBackupFailed, message)
+}
+
+// result reads the size and checksum of the dump from the termination message of the dump container
+func (r *DatabaseBackupReconciler) result(ctx context.Context, job *batchv1.Job) (backup.Result, error) {
+	pods := &corev1.PodList{}
+	if err := r.APIReader.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return backup.Result{}, err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			if status.Name == backup.DumpContainer && status.State.Terminated != nil {
+				return backup.ParseResult(status.State.Terminated.Message)
+			}
+		}
+	}
+
+	return backup.Result{}, fmt.Errorf("No succeeded pod of Job '%s' reported a result", job.Name)
+}
+
+// finalize removes the dump from the storage if the deletion policy is Delete
+func (r *DatabaseBackupReconciler) finalize(ctx context.Context, databaseBackup *k8sv1beta1.DatabaseBackup) (ctrl.Result, error) {
+	if databaseBackup.Spec.DeletionPolicy != k8sv1beta1.DeletionPolicyDelete || databaseBackup.Status.Location == "" {
+		return ctrl.Result{}, nil
+	}
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: databaseBackup.Namespace, Name: databaseBackup.Name + "-cleanup"}, job)
+	if apierrors.IsNotFound(err) {
+		job, err = backup.CleanupJob(databaseBackup, backup.Image(databaseBackup, databaseBackup.Status.DatabaseType))
+		if err != nil {
+			r.Recorder.Event(databaseBackup, corev1.EventTypeWarning, reasonCleanupFailed, err.Error())
+			return ctrl.Result{}, nil
+		}
+		if err := controllerutil.SetControllerReference(databaseBackup, job, r.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: backupRetryInterval}, r.Create(ctx, job)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	switch {
+	case jobFinished(job, batchv1.JobComplete):
+		r.Recorder.Event(databaseBackup, corev1.EventTypeNormal, reasonDumpRemoved, fmt.Sprintf("Removed dump '%s'", databaseBackup.Status.Location))
+		return ctrl.Result{}, nil
+	case jobFinished(job, batchv1.JobFailed):
+		// a failed cleanup does not block the deletion, the dump has to be removed manually
+		message := fmt.Sprintf("Failed to remove dump '%s', Job '%s' failed", databaseBackup.Status.Location, job.Name)
+		r.Recorder.Event(databaseBackup, corev1.EventTypeWarning, reasonCleanupFailed, message)
+		return ctrl.Result{}, nil
+	}
+
+	return ctrl.Result{RequeueAfter: backupRetryInterval}, nil
+}
+
+func (r *DatabaseBackupReconciler) setReadyCondition(ctx context.Context, databaseBackup *k8sv1beta1.DatabaseBackup, status metav1.ConditionStatus, reason, message string) error {
+	meta.SetStatusCondition(&databaseBackup.Status.Conditions, metav1.Condition{
+		Type:               k8sv1beta1.ConditionTypeReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: databaseBackup.Generation,
+	})
+
+	if err := r.Status().Update(ctx, databaseBackup); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update DatabaseBackup status")
+		return err
+	}
+
+	return nil
+}
+
+// credentialsSecret returns the name of the secret holding the superuser password for the Job of the backup
+func credentialsSecret(databaseBackup *k8sv1beta1.DatabaseBackup) string {
+	return databaseBackup.Name + "-backup-credentials"
+}
+
+// jobFinished reports whether the Job has the finished condition of the given type
+func jobFinished(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DatabaseBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&k8sv1beta1.DatabaseBackup{}).
+		Owns(&batchv1.Job{}).
+		WithOptions(r.Options).
+		Complete(tracing.Reconciler("DatabaseBackup", r))
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/backup"
+)
+
+var _ = Describe("DatabaseBackup Controller", func() {
+	ctx := context.Background()
+
+	var c client.Client
+	var controllerReconciler *DatabaseBackupReconciler
+
+	backupName := types.NamespacedName{Name: "nightly", Namespace: "default"}
+	jobName := types.NamespacedName{Name: "nightly-backup", Namespace: "default"}
+
+	BeforeEach(func() {
+		host := &k8sv1.DatabaseHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "postgres", Namespace: "default"},
+			Spec:       k8sv1.DatabaseHostSpec{Type: k8sv1.Postgres, Host: "pg.example.com", Superuser: "admin", Password: "secret"},
+		}
+		database := &k8sv1beta1.Database{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec:       k8sv1beta1.DatabaseSpec{Name: "app", HostRef: k8sv1beta1.DatabaseHostReference{Name: host.Name}},
+			Status: k8sv1beta1.DatabaseStatus{
+				Name:       "app",
+				Conditions: []metav1.Condition{{Type: k8sv1beta1.ConditionTypeReady, Status: metav1.ConditionTrue, Reason: reasonCreated}},
+			},
+		}
+		databaseBackup := &k8sv1beta1.DatabaseBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: backupName.Name, Namespace: backupName.Namespace},
+			Spec: k8sv1beta1.DatabaseBackupSpec{
+				DatabaseRef: k8sv1beta1.DatabaseReference{Name: database.Name},
+				Storage: k8sv1beta1.BackupStorage{
+					PersistentVolumeClaim: &k8sv1beta1.PersistentVolumeClaimStorage{ClaimName: "dumps"},
+				},
+			},
+		}
+
+		c = fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&k8sv1beta1.DatabaseBackup{}).
+			WithObjects(host, database, databaseBackup).
+			Build()
+		controllerReconciler = &DatabaseBackupReconciler{
+			Client:    c,
+			Scheme:    scheme.Scheme,
+			Recorder:  record.NewFakeRecorder(10),
+			APIReader: c,
+		}
+	})
+
+	reconcileBackup := func() *k8sv1beta1.DatabaseBackup {
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: backupName})
+		Expect(err).NotTo(HaveOccurred())
+
+		databaseBackup := &k8sv1beta1.DatabaseBackup{}
+		Expect(c.Get(ctx, backupName, databaseBackup)).To(Succeed())
+		return databaseBackup
+	}
+
+	It("should run a Job and record the result of the dump", func() {
+		databaseBackup := reconcileBackup()
+		Expect(databaseBackup.Status.Phase).To(Equal(k8sv1beta1.BackupPhaseRunning))
+		Expect(databaseBackup.Status.JobName).To(Equal(jobName.Name))
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "nightly-backup-credentials", Namespace: "default"}, secret)).To(Succeed())
+		Expect(secret.Data).To(HaveKeyWithValue(backup.PasswordKey, []byte("secret")))
+
+		job := &batchv1.Job{}
+		Expect(c.Get(ctx, jobName, job)).To(Succeed())
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		Expect(c.Status().Update(ctx, job)).To(Succeed())
+		Expect(c.Create(ctx, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly-backup-abcde", Namespace: "default", Labels: map[string]string{"job-name": jobName.Name}},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodSucceeded,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  backup.DumpContainer,
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: `{"size":2048,"checksum":"sha256:abc"}`}},
+				}},
+			},
+		})).To(Succeed())
+
+		databaseBackup = reconcileBackup()
+		Expect(databaseBackup.Status.Phase).To(Equal(k8sv1beta1.BackupPhaseSucceeded))
+		Expect(databaseBackup.Status.Size).To(Equal(int64(2048)))
+		Expect(databaseBackup.Status.Checksum).To(Equal("sha256:abc"))
+		Expect(databaseBackup.Status.Location).To(Equal("/default/app/nightly.dump.gz"))
+		Expect(meta.IsStatusConditionTrue(databaseBackup.Status.Conditions, k8sv1beta1.ConditionTypeReady)).To(BeTrue())
+		Expect(errors.IsNotFound(c.Get(ctx, types.NamespacedName{Name: "nightly-backup-credentials", Namespace: "default"}, secret))).To(BeTrue())
+	})
+
+	It("should mark the backup as failed when the Job fails", func() {
+		reconcileBackup()
+
+		job := &batchv1.Job{}
+		Expect(c.Get(ctx, jobName, job)).To(Succeed())
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+		Expect(c.Status().Update(ctx, job)).To(Succeed())
+
+		databaseBackup := reconcileBackup()
+		Expect(databaseBackup.Status.Phase).To(Equal(k8sv1beta1.BackupPhaseFailed))
+		Expect(databaseBackup.Status.CompletionTime).NotTo(BeNil())
+	})
+
+	It("should fail backups of databases on MySQL hosts", func() {
+		host := &k8sv1.DatabaseHost{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "postgres", Namespace: "default"}, host)).To(Succeed())
+		host.Spec.Type = k8sv1.MySQL
+		Expect(c.Update(ctx, host)).To(Succeed())
+
+		databaseBackup := reconcileBackup()
+		Expect(databaseBackup.Status.Phase).To(Equal(k8sv1beta1.BackupPhaseFailed))
+		Expect(meta.FindStatusCondition(databaseBackup.Status.Conditions, k8sv1beta1.ConditionTypeReady).Message).To(ContainSubstring("not supported"))
+		Expect(errors.IsNotFound(c.Get(ctx, jobName, &batchv1.Job{}))).To(BeTrue())
+	})
+
+	It("should remove the dump with the image of the database type recorded on the backup", func() {
+		databaseBackup := reconcileBackup()
+		Expect(databaseBackup.Status.DatabaseType).To(Equal(k8sv1.Postgres))
+
+		databaseBackup.Spec.DeletionPolicy = k8sv1beta1.DeletionPolicyDelete
+		Expect(c.Update(ctx, databaseBackup)).To(Succeed())
+		databaseBackup.Status.Location = "/default/app/nightly.dump.gz"
+		databaseBackup.Status.DatabaseType = k8sv1.MySQL
+		Expect(c.Status().Update(ctx, databaseBackup)).To(Succeed())
+		Expect(c.Delete(ctx, databaseBackup)).To(Succeed())
+
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: backupName})
+		Expect(err).NotTo(HaveOccurred())
+
+		job := &batchv1.Job{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "nightly-cleanup", Namespace: "default"}, job)).To(Succeed())
+		Expect(job.Spec.Template.Spec.Containers[0].Image).To(Equal(backup.DefaultMySQLImage))
+	})
+})
@@ -0,0 +1,234 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/tracing"
+)
+
+// DatabaseBackupScheduleReconciler reconciles a DatabaseBackupSchedule object
+type DatabaseBackupScheduleReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Options configure the workers and the retries of the controller
+	Options controller.Options
+}
+
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databasebackupschedules,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databasebackupschedules/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databasebackupschedules/finalizers,verbs=update
+
+// Reconcile creates a DatabaseBackup from the template whenever the schedule is due and
+// deletes the backups of the schedule which are no longer retained.
+func (r *DatabaseBackupScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	backupSchedule := &k8sv1beta1.DatabaseBackupSchedule{}
+	if err := r.Get(ctx, req.NamespacedName, backupSchedule); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !backupSchedule.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	backups := &k8sv1beta1.DatabaseBackupList{}
+	if err := r.List(ctx, backups, client.InNamespace(backupSchedule.Namespace), client.MatchingLabels{k8sv1beta1.LabelBackupSchedule: backupSchedule.Name}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	backupSchedule.Status.LastSuccessfulBackup = ""
+	if latest := latestSuccessfulBackup(backups.Items); latest != nil {
+		backupSchedule.Status.LastSuccessfulBackup = latest.Name
+	}
+
+	now := time.Now()
+	for _, expired := range expiredBackups(backups.Items, backupSchedule.Spec.Retention, now) {
+		log.Info("Deleting backup which is no longer retained", "backup", expired.Name)
+		if err := r.Delete(ctx, expired); client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	schedule, err := cron.ParseStandard(backupSchedule.Spec.Schedule)
+	if err != nil {
+		message := fmt.Sprintf("Invalid schedule '%s': %s", backupSchedule.Spec.Schedule, err)
+		r.Recorder.Event(backupSchedule, corev1.EventTypeWarning, reasonInvalidSchedule, message)
+		backupSchedule.Status.NextScheduleTime = nil
+		return ctrl.Result{}, r.setReadyCondition(ctx, backupSchedule, metav1.ConditionFalse, reasonInvalidSchedule, message)
+	}
+
+	if backupSchedule.Spec.Suspend {
+		backupSchedule.Status.NextScheduleTime = nil
+		return ctrl.Result{}, r.setReadyCondition(ctx, backupSchedule, metav1.ConditionFalse, reasonPaused, "Schedule is suspended")
+	}
+
+	last := backupSchedule.CreationTimestamp.Time
+	if backupSchedule.Status.LastScheduleTime != nil {
+		last = backupSchedule.Status.LastScheduleTime.Time
+	}
+
+	// only the most recent missed run is caught up on, like a CronJob with concurrencyPolicy Forbid
+	if due := mostRecentRun(schedule, last, now); !due.IsZero() {
+		if err := r.createBackup(ctx, backupSchedule, due); err != nil {
+			return ctrl.Result{}, err
+		}
+		backupSchedule.Status.LastScheduleTime = &metav1.Time{Time: due}
+	}
+
+	next := schedule.Next(now)
+	backupSchedule.Status.NextScheduleTime = &metav1.Time{Time: next}
+	message := fmt.Sprintf("Next backup is scheduled at %s", next.Format(time.RFC3339))
+	return ctrl.Result{RequeueAfter: next.Sub(now)}, r.setReadyCondition(ctx, backupSchedule, metav1.ConditionTrue, reasonScheduled, message)
+}
+
+// createBackup creates the DatabaseBackup of the schedule for the given run
+func (r *DatabaseBackupScheduleReconciler) createBackup(ctx context.Context, backupSchedule *k8sv1beta1.DatabaseBackupSchedule, run time.Time) error {
+	databaseBackup := &k8sv1beta1.DatabaseBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", backupSchedule.Name, run.Unix()),
+			Namespace: backupSchedule.Namespace,
+			Labels:    map[string]string{k8sv1beta1.LabelBackupSchedule: backupSchedule.Name},
+		},
+		Spec: backupSchedule.Spec.Template,
+	}
+	if err := controllerutil.SetControllerReference(backupSchedule, databaseBackup, r.Scheme); err != nil {
+		return err
+	}
+
+	if err := r.Create(ctx, databaseBackup); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return nil
+		}
+		return fmt.Errorf("Failed to create backup '%s': %w", databaseBackup.Name, err)
+	}
+
+	r.Recorder.Event(backupSchedule, corev1.EventTypeNormal, reasonBackupStarted, fmt.Sprintf("Created backup '%s'", databaseBackup.Name))
+	return nil
+}
+
+func (r *DatabaseBackupScheduleReconciler) setReadyCondition(ctx context.Context, backupSchedule *k8sv1beta1.DatabaseBackupSchedule, status metav1.ConditionStatus, reason, message string) error {
+	meta.SetStatusCondition(&backupSchedule.Status.Conditions, metav1.Condition{
+		Type:               k8sv1beta1.ConditionTypeReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: backupSchedule.Generation,
+	})
+
+	if err := r.Status().Update(ctx, backupSchedule); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update DatabaseBackupSchedule status")
+		return err
+	}
+
+	return nil
+}
+
+// mostRecentRun returns the latest run of the schedule after last which is due at now,
+// or the zero time if no run is due
+func mostRecentRun(schedule cron.Schedule, last, now time.Time) time.Time {
+	var due time.Time
+	// the number of runs looked at is bounded, so a long outage does not stall the reconciler
+	for run, i := schedule.Next(last), 0; !run.After(now) && i < 1000; run, i = schedule.Next(run), i+1 {
+		due = run
+	}
+	return due
+}
+
+// latestSuccessfulBackup returns the most recently completed successful backup
+func latestSuccessfulBackup(backups []k8sv1beta1.DatabaseBackup) *k8sv1beta1.DatabaseBackup {
+	var latest *k8sv1beta1.DatabaseBackup
+	for i := range backups {
+		b := &backups[i]
+		if b.Status.Phase != k8sv1beta1.BackupPhaseSucceeded || b.Status.CompletionTime == nil {
+			continue
+		}
+		if latest == nil || b.Status.CompletionTime.After(latest.Status.CompletionTime.Time) {
+			latest = b
+		}
+	}
+	return latest
+}
+
+// expiredBackups returns the finished backups which are no longer retained. The most recent
+// successful backup is always kept, unfinished backups are never deleted.
+func expiredBackups(backups []k8sv1beta1.DatabaseBackup, retention k8sv1beta1.BackupRetention, now time.Time) []*k8sv1beta1.DatabaseBackup {
+	var succeeded, failed []*k8sv1beta1.DatabaseBackup
+	for i := range backups {
+		b := &backups[i]
+		if !b.DeletionTimestamp.IsZero() || b.Status.CompletionTime == nil {
+			continue
+		}
+		switch b.Status.Phase {
+		case k8sv1beta1.BackupPhaseSucceeded:
+			succeeded = append(succeeded, b)
+		case k8sv1beta1.BackupPhaseFailed:
+			failed = append(failed, b)
+		}
+	}
+
+	newestFirst := func(list []*k8sv1beta1.DatabaseBackup) {
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Status.CompletionTime.After(list[j].Status.CompletionTime.Time)
+		})
+	}
+	newestFirst(succeeded)
+	newestFirst(failed)
+
+	keepLast := max(int(retention.KeepLast), 1)
+
+	var expired []*k8sv1beta1.DatabaseBackup
+	for i, b := range succeeded {
+		tooOld := retention.MaxAge != nil && now.Sub(b.Status.CompletionTime.Time) > retention.MaxAge.Duration
+		if i >= keepLast || (i > 0 && tooOld) {
+			expired = append(expired, b)
+		}
+	}
+	if len(failed) > int(retention.KeepFailed) {
+		expired = append(expired, failed[max(int(retention.KeepFailed), 0):]...)
+	}
+	return expired
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DatabaseBackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&k8sv1beta1.DatabaseBackupSchedule{}).
+		Owns(&k8sv1beta1.DatabaseBackup{}).
+		WithOptions(r.Options).
+		Complete(tracing.Reconciler("DatabaseBackupSchedule", r))
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+var _ = Describe("DatabaseBackupSchedule Controller", func() {
+	ctx := context.Background()
+
+	It("should create the backup when the schedule is due", func() {
+		scheduleName := types.NamespacedName{Name: "nightly", Namespace: "default"}
+		backupSchedule := &k8sv1beta1.DatabaseBackupSchedule{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              scheduleName.Name,
+				Namespace:         scheduleName.Namespace,
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-2 * time.Hour)),
+			},
+			Spec: k8sv1beta1.DatabaseBackupScheduleSpec{
+				Schedule: "0 * * * *",
+				Template: k8sv1beta1.DatabaseBackupSpec{DatabaseRef: k8sv1beta1.DatabaseReference{Name: "app"}},
+			},
+		}
+
+		c := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&k8sv1beta1.DatabaseBackupSchedule{}).
+			WithObjects(backupSchedule).
+			Build()
+		controllerReconciler := &DatabaseBackupScheduleReconciler{
+			Client:   c,
+			Scheme:   scheme.Scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+
+		result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: scheduleName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("<=", time.Hour))
+
+		backups := &k8sv1beta1.DatabaseBackupList{}
+		Expect(c.List(ctx, backups, client.MatchingLabels{k8sv1beta1.LabelBackupSchedule: scheduleName.Name})).To(Succeed())
+		Expect(backups.Items).To(HaveLen(1))
+		Expect(backups.Items[0].Spec.DatabaseRef.Name).To(Equal("app"))
+
+		Expect(c.Get(ctx, scheduleName, backupSchedule)).To(Succeed())
+		Expect(backupSchedule.Status.LastScheduleTime).NotTo(BeNil())
+		Expect(backupSchedule.Status.NextScheduleTime.After(time.Now())).To(BeTrue())
+
+		By("not creating another backup before the next run")
+		_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: scheduleName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.List(ctx, backups, client.MatchingLabels{k8sv1beta1.LabelBackupSchedule: scheduleName.Name})).To(Succeed())
+		Expect(backups.Items).To(HaveLen(1))
+	})
+
+	It("should only expire backups beyond the retention", func() {
+		now := time.Now()
+		finished := func(name string, phase k8sv1beta1.BackupPhase, age time.Duration) k8sv1beta1.DatabaseBackup {
+			return k8sv1beta1.DatabaseBackup{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Status:     k8sv1beta1.DatabaseBackupStatus{Phase: phase, CompletionTime: &metav1.Time{Time: now.Add(-age)}},
+			}
+		}
+		backups := []k8sv1beta1.DatabaseBackup{
+			finished("a", k8sv1beta1.BackupPhaseSucceeded, 50*time.Hour),
+			finished("b", k8sv1beta1.BackupPhaseSucceeded, 26*time.Hour),
+			finished("c", k8sv1beta1.BackupPhaseSucceeded, 2*time.Hour),
+			finished("d", k8sv1beta1.BackupPhaseFailed, 3*time.Hour),
+			finished("e", k8sv1beta1.BackupPhaseFailed, 1*time.Hour),
+			{ObjectMeta: metav1.ObjectMeta{Name: "f"}, Status: k8sv1beta1.DatabaseBackupStatus{Phase: k8sv1beta1.BackupPhaseRunning}},
+		}
+
+		names := func(expired []*k8sv1beta1.DatabaseBackup) []string {
+			var result []string
+			for _, b := range expired {
+				result = append(result, b.Name)
+			}
+			return result
+		}
+
+		Expect(names(expiredBackups(backups, k8sv1beta1.BackupRetention{KeepLast: 2, KeepFailed: 1}, now))).To(ConsistOf("a", "d"))
+		Expect(names(expiredBackups(backups, k8sv1beta1.BackupRetention{
+			KeepLast: 7,
+			MaxAge:   &metav1.Duration{Duration: 24 * time.Hour},
+		}, now))).To(ConsistOf("a", "b", "d", "e"))
+		Expect(names(expiredBackups(backups, k8sv1beta1.BackupRetention{
+			KeepLast:   7,
+			MaxAge:     &metav1.Duration{Duration: time.Hour},
+			KeepFailed: 2,
+		}, now))).To(ConsistOf("a", "b"))
+		Expect(latestSuccessfulBackup(backups).Name).To(Equal("c"))
+	})
+})
@@ -18,29 +18,63 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/audit"
+	"github.com/tuunit/external-database-operator/internal/maintenance"
+	"github.com/tuunit/external-database-operator/internal/metrics"
 	"github.com/tuunit/external-database-operator/internal/provider"
+	"github.com/tuunit/external-database-operator/internal/sharding"
+	"github.com/tuunit/external-database-operator/internal/tracing"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
+// hostHealthCheckInterval is the interval in which the connection to a host is checked
+const hostHealthCheckInterval = time.Minute
+
 // DatabaseHostReconciler reconciles a DatabaseHost object
 type DatabaseHostReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Audit records the statements executed against the hosts
+	Audit audit.Sink
+	// Pools are the connection pools to the hosts shared by all reconcilers
+	Pools *provider.Pools
+	// Shards are the shards of hosts reconciled by this replica, all hosts without sharding
+	Shards *sharding.Sharder
+	// Options configure the workers and the retries of the controller
+	Options controller.Options
 }
 
 //+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databasehosts,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databasehosts/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databasehosts/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databases;databaseusers,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -54,27 +88,97 @@ type DatabaseHostReconciler struct {
 func (r *DatabaseHostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
+	finalizer := "k8s.tuunit.com/finalizer"
+
 	databaseHost := &k8sv1.DatabaseHost{}
 	if err := r.Get(ctx, req.NamespacedName, databaseHost); err != nil {
 		log.Error(err, "unable to fetch DatabaseHost")
+		if apierrors.IsNotFound(err) {
+			r.Pools.Invalidate(req.NamespacedName)
+			metrics.HostUp.DeletePartialMatch(prometheus.Labels{"namespace": req.Namespace, "host": req.Name})
+			metrics.HostConnectionCheckDuration.DeletePartialMatch(prometheus.Labels{"namespace": req.Namespace, "host": req.Name})
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	// another replica owns the shard of the host, its series are exported over there
+	if !r.Shards.Owns(databaseHost.Namespace, databaseHost.Name) {
+		metrics.HostUp.DeletePartialMatch(prometheus.Labels{"namespace": req.Namespace, "host": req.Name})
+		metrics.HostConnectionCheckDuration.DeletePartialMatch(prometheus.Labels{"namespace": req.Namespace, "host": req.Name})
+		return ctrl.Result{}, nil
+	}
+
 	spec := databaseHost.Spec
 
-	var err error
+	if databaseHost.Paused() {
+		log.Info("Reconciliation is paused")
+		meta.SetStatusCondition(&databaseHost.Status.Conditions, metav1.Condition{
+			Type:               k8sv1.ConditionTypePaused,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonPaused,
+			Message:            fmt.Sprintf("Reconciliation is paused by the annotation %s", k8sv1.AnnotationPaused),
+			ObservedGeneration: databaseHost.Generation,
+		})
+		if err := r.Status().Update(ctx, databaseHost); err != nil {
+			log.Error(err, "unable to update DatabaseHost status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	meta.RemoveStatusCondition(&databaseHost.Status.Conditions, k8sv1.ConditionTypePaused)
+
+	if databaseHost.ObjectMeta.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(databaseHost, finalizer) {
+			controllerutil.AddFinalizer(databaseHost, finalizer)
+			if err := r.Update(ctx, databaseHost); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	} else {
+		if controllerutil.ContainsFinalizer(databaseHost, finalizer) {
+			if blocked, err := r.finalize(ctx, databaseHost); err != nil || blocked {
+				return ctrl.Result{}, err
+			}
+
+			controllerutil.RemoveFinalizer(databaseHost, finalizer)
+			if err := r.Update(ctx, databaseHost); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	databaseHost.Status.NextMaintenanceWindow = nil
+	if _, next, err := maintenance.Open(spec.MaintenanceWindows, time.Now()); err != nil {
+		r.Recorder.Event(databaseHost, corev1.EventTypeWarning, reasonInvalidMaintenanceWindow, err.Error())
+	} else if !next.IsZero() {
+		databaseHost.Status.NextMaintenanceWindow = &metav1.Time{Time: next}
+	}
 
+	ctx = audit.WithSource(ctx, "DatabaseHost", databaseHost, databaseHost)
+
+	spec, err := resolveHostSpec(ctx, r, databaseHost)
+	if err != nil {
+		databaseHost.Status.ConnectionStatus = err.Error()
+		r.Recorder.Event(databaseHost, corev1.EventTypeWarning, reasonCredentialsNotFound, err.Error())
+		if err := r.Status().Update(ctx, databaseHost); err != nil {
+			log.Error(err, "unable to update DatabaseHost status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: hostHealthCheckInterval}, nil
+	}
+
+	var server serverClient
 	switch databaseHost.Spec.Type {
 	case k8sv1.MySQL:
 		log.Info("MySQL database host")
-		// Todo: Implement MySQL connection
+		server = r.Pools.MySQL(req.NamespacedName, spec, r.Audit)
 	case k8sv1.Postgres:
 		log.Info("Postgres database host")
-		client := provider.NewPostgresClient(spec)
-		err = client.CheckConnection()
-		// Todo: Configure RequeueAfter to retry the connection
+		server = r.Pools.Postgres(req.NamespacedName, spec, r.Audit)
 	default:
 		databaseHost.Status.ConnectionStatus = fmt.Sprintf("Database type '%s' not supported", spec.Type)
+		r.Recorder.Event(databaseHost, corev1.EventTypeWarning, reasonUnsupportedType, databaseHost.Status.ConnectionStatus)
 		if err := r.Status().Update(ctx, databaseHost); err != nil {
 			log.Error(err, "unable to update DatabaseHost status")
 			return ctrl.Result{}, err
@@ -82,29 +186,188 @@ func (r *DatabaseHostReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, nil
 	}
 
+	start := time.Now()
+	err = server.CheckConnection(ctx)
+	metrics.HostConnectionCheckDuration.WithLabelValues(databaseHost.Namespace, databaseHost.Name, string(spec.Type)).Observe(time.Since(start).Seconds())
 	if err != nil {
+		metrics.HostUp.WithLabelValues(databaseHost.Namespace, databaseHost.Name, string(spec.Type)).Set(0)
+
 		databaseHost.Status.ConnectionStatus = err.Error()
+		r.Recorder.Event(databaseHost, corev1.EventTypeWarning, reasonConnectionFailed, err.Error())
 		if err := r.Status().Update(ctx, databaseHost); err != nil {
 			log.Error(err, "unable to update DatabaseHost status")
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, nil
+		return ctrl.Result{RequeueAfter: hostHealthCheckInterval}, nil
 	}
 
-	databaseHost.Status.ConnectionStatus = fmt.Sprintf("Connection with host '%s' was successful", spec.Host)
-	databaseHost.Status.LastConnectionTime = metav1.Now()
+	metrics.HostUp.WithLabelValues(databaseHost.Namespace, databaseHost.Name, string(spec.Type)).Set(1)
+
+	r.connected(databaseHost, spec.Host)
+
+	// the providers pick their dialect from the discovered server, an upgrade shows up on the next check
+	if info, err := server.DiscoverServer(ctx); err != nil {
+		log.Error(err, "unable to discover server")
+		r.Recorder.Event(databaseHost, corev1.EventTypeWarning, reasonDiscoveryFailed, err.Error())
+	} else {
+		if previous := databaseHost.Status.Server; previous == nil || previous.Version != info.Version || previous.Flavor != info.Flavor {
+			r.Recorder.Eventf(databaseHost, corev1.EventTypeNormal, reasonServerDiscovered, "Discovered %s %s", info.Flavor, info.Version)
+		}
+		databaseHost.Status.Server = &info
+	}
+
+	// new databases get the defaults of the host, MariaDB for example lacks the collations of MySQL 8
+	if mysql, ok := server.(*provider.MySQL); ok {
+		r.localeChecked(databaseHost, mysql.ValidateLocale(ctx, spec.EffectiveCharset(), spec.EffectiveCollation()))
+	}
 
 	if err := r.Status().Update(ctx, databaseHost); err != nil {
 		log.Error(err, "unable to update DatabaseHost status")
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: hostHealthCheckInterval}, nil
+}
+
+// connected records a successful connection check in the status of the host. The event is only
+// recorded when the host was not connected before, not on every health check.
+func (r *DatabaseHostReconciler) connected(databaseHost *k8sv1.DatabaseHost, host string) {
+	previous := databaseHost.Status.ConnectionStatus
+
+	databaseHost.Status.ConnectionStatus = fmt.Sprintf("Connection with host '%s' was successful", host)
+	databaseHost.Status.LastConnectionTime = metav1.Now()
+	if previous != databaseHost.Status.ConnectionStatus {
+		r.Recorder.Event(databaseHost, corev1.EventTypeNormal, reasonConnectionSucceeded, databaseHost.Status.ConnectionStatus)
+	}
+}
+
+// localeChecked records whether the default charset and collation of the host are available.
+// The event is only recorded when they became unavailable, not on every health check.
+func (r *DatabaseHostReconciler) localeChecked(databaseHost *k8sv1.DatabaseHost, err error) {
+	switch {
+	case err == nil:
+		meta.RemoveStatusCondition(&databaseHost.Status.Conditions, k8sv1.ConditionTypeLocaleUnsupported)
+	case errors.Is(err, provider.ErrUnsupportedLocale):
+		if !meta.IsStatusConditionTrue(databaseHost.Status.Conditions, k8sv1.ConditionTypeLocaleUnsupported) {
+			r.Recorder.Event(databaseHost, corev1.EventTypeWarning, reasonUnsupportedLocale, err.Error())
+		}
+		meta.SetStatusCondition(&databaseHost.Status.Conditions, metav1.Condition{
+			Type:               k8sv1.ConditionTypeLocaleUnsupported,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonUnsupportedLocale,
+			Message:            err.Error(),
+			ObservedGeneration: databaseHost.Generation,
+		})
+	default:
+		// the locale is checked again on the next health check
+		r.Recorder.Event(databaseHost, corev1.EventTypeWarning, reasonDiscoveryFailed, err.Error())
+	}
+}
+
+// serverClient checks the connection to a host and discovers the server running on it
+type serverClient interface {
+	CheckConnection(ctx context.Context) error
+	DiscoverServer(ctx context.Context) (k8sv1.ServerInfo, error)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *DatabaseHostReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&k8sv1.DatabaseHost{}).
-		Complete(r)
+		Watches(&k8sv1beta1.Database{}, handler.EnqueueRequestsFromMapFunc(hostOf), builder.WithPredicates(dependentDeleted)).
+		Watches(&k8sv1beta1.DatabaseUser{}, handler.EnqueueRequestsFromMapFunc(hostOf), builder.WithPredicates(dependentDeleted)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.hostsForSecret))
+
+	if r.Shards != nil {
+		b = b.WatchesRawSource(r.Shards.Source(&k8sv1.DatabaseHostList{}, client.Object.GetName), &handler.EnqueueRequestForObject{})
+	}
+
+	return b.WithOptions(r.Options).Complete(tracing.Reconciler("DatabaseHost", r))
+}
+
+// finalize keeps the host until no databases or users are left on it and reports whether some are.
+// With the cascade annotation it deletes them, so each one is dropped or retained according to
+// its own deletion policy while the host still exists.
+func (r *DatabaseHostReconciler) finalize(ctx context.Context, databaseHost *k8sv1.DatabaseHost) (bool, error) {
+	databases := &k8sv1beta1.DatabaseList{}
+	if err := dependents(ctx, r, databaseHost, databases); err != nil {
+		return true, err
+	}
+	users := &k8sv1beta1.DatabaseUserList{}
+	if err := dependents(ctx, r, databaseHost, users); err != nil {
+		return true, err
+	}
+
+	var refs []k8sv1.DependentReference
+	var objects []client.Object
+	for i := range databases.Items {
+		refs = append(refs, k8sv1.DependentReference{Kind: "Database", Name: databases.Items[i].Name})
+		objects = append(objects, &databases.Items[i])
+	}
+	for i := range users.Items {
+		refs = append(refs, k8sv1.DependentReference{Kind: "DatabaseUser", Name: users.Items[i].Name})
+		objects = append(objects, &users.Items[i])
+	}
+
+	if len(objects) == 0 {
+		return false, nil
+	}
+
+	names := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		names = append(names, ref.Kind+"/"+ref.Name)
+	}
+
+	reason := reasonDeletionBlocked
+	message := fmt.Sprintf("DatabaseHost '%s' is still used by %s, delete them or set the annotation %s: \"true\"",
+		databaseHost.Name, strings.Join(names, ", "), k8sv1.AnnotationCascade)
+	if databaseHost.Cascade() {
+		for _, obj := range objects {
+			if !obj.GetDeletionTimestamp().IsZero() {
+				continue
+			}
+			if err := r.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+				return true, err
+			}
+		}
+
+		reason = reasonCascading
+		message = fmt.Sprintf("Waiting for the deletion of %s", strings.Join(names, ", "))
+		r.Recorder.Event(databaseHost, corev1.EventTypeNormal, reason, message)
+	} else {
+		r.Recorder.Event(databaseHost, corev1.EventTypeWarning, reason, message)
+	}
+
+	databaseHost.Status.Dependents = refs
+	meta.SetStatusCondition(&databaseHost.Status.Conditions, metav1.Condition{
+		Type:               k8sv1.ConditionTypeDeletionBlocked,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: databaseHost.Generation,
+	})
+	if err := r.Status().Update(ctx, databaseHost); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update DatabaseHost status")
+		return true, err
+	}
+
+	return true, nil
+}
+
+// hostsForSecret returns the hosts which read their password from the secret,
+// so a changed password replaces their connection pools right away
+func (r *DatabaseHostReconciler) hostsForSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	hosts := &k8sv1.DatabaseHostList{}
+	if err := r.List(ctx, hosts, client.InNamespace(secret.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list DatabaseHosts")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, host := range hosts.Items {
+		if host.Spec.PasswordSecretRef == secret.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&host)})
+		}
+	}
+	return requests
 }
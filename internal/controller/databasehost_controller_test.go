@@ -18,16 +18,24 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/provider"
 )
 
 var _ = Describe("DatabaseHost Controller", func() {
@@ -69,8 +77,9 @@ var _ = Describe("DatabaseHost Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &DatabaseHostReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -81,4 +90,112 @@ var _ = Describe("DatabaseHost Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When deleting a resource with dependents", func() {
+		ctx := context.Background()
+
+		var c client.Client
+		var controllerReconciler *DatabaseHostReconciler
+
+		hostName := types.NamespacedName{Name: "postgres", Namespace: "default"}
+		databaseName := types.NamespacedName{Name: "app", Namespace: "default"}
+
+		BeforeEach(func() {
+			host := &k8sv1.DatabaseHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       hostName.Name,
+					Namespace:  hostName.Namespace,
+					Finalizers: []string{"k8s.tuunit.com/finalizer"},
+				},
+			}
+			database := &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: databaseName.Name, Namespace: databaseName.Namespace},
+				Spec:       k8sv1beta1.DatabaseSpec{HostRef: k8sv1beta1.DatabaseHostReference{Name: hostName.Name}},
+			}
+
+			c = fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithIndex(&k8sv1beta1.Database{}, hostRefField, hostRef).
+				WithIndex(&k8sv1beta1.DatabaseUser{}, hostRefField, hostRef).
+				WithStatusSubresource(&k8sv1.DatabaseHost{}).
+				WithObjects(host, database).
+				Build()
+			controllerReconciler = &DatabaseHostReconciler{
+				Client:   c,
+				Scheme:   scheme.Scheme,
+				Recorder: record.NewFakeRecorder(10),
+			}
+
+			Expect(c.Delete(ctx, host)).To(Succeed())
+		})
+
+		It("should block the deletion until the dependents are gone", func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: hostName})
+			Expect(err).NotTo(HaveOccurred())
+
+			host := &k8sv1.DatabaseHost{}
+			Expect(c.Get(ctx, hostName, host)).To(Succeed())
+			Expect(host.Status.Dependents).To(ConsistOf(k8sv1.DependentReference{Kind: "Database", Name: databaseName.Name}))
+			Expect(meta.IsStatusConditionTrue(host.Status.Conditions, k8sv1.ConditionTypeDeletionBlocked)).To(BeTrue())
+			Expect(c.Get(ctx, databaseName, &k8sv1beta1.Database{})).To(Succeed())
+
+			Expect(c.Delete(ctx, &k8sv1beta1.Database{ObjectMeta: metav1.ObjectMeta{Name: databaseName.Name, Namespace: databaseName.Namespace}})).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: hostName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(c.Get(ctx, hostName, host))).To(BeTrue())
+		})
+
+		It("should delete the dependents with the cascade annotation", func() {
+			host := &k8sv1.DatabaseHost{}
+			Expect(c.Get(ctx, hostName, host)).To(Succeed())
+			host.Annotations = map[string]string{k8sv1.AnnotationCascade: "true"}
+			Expect(c.Update(ctx, host)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: hostName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(c.Get(ctx, databaseName, &k8sv1beta1.Database{}))).To(BeTrue())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: hostName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(c.Get(ctx, hostName, host))).To(BeTrue())
+		})
+	})
+
+	Context("When the connection check succeeds", func() {
+		It("should only record an event when the host was not connected before", func() {
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler := &DatabaseHostReconciler{Recorder: recorder}
+
+			host := &k8sv1.DatabaseHost{Status: k8sv1.DatabaseHostStatus{ConnectionStatus: "connection refused"}}
+			controllerReconciler.connected(host, "postgres.example.com")
+			Expect(recorder.Events).To(Receive(ContainSubstring(reasonConnectionSucceeded)))
+			Expect(host.Status.LastConnectionTime.IsZero()).To(BeFalse())
+
+			controllerReconciler.connected(host, "postgres.example.com")
+			Expect(recorder.Events).NotTo(Receive())
+
+			host.Status.ConnectionStatus = "connection refused"
+			controllerReconciler.connected(host, "postgres.example.com")
+			Expect(recorder.Events).To(Receive(ContainSubstring(reasonConnectionSucceeded)))
+		})
+	})
+
+	Context("When the locale of a MySQL host is checked", func() {
+		It("should report an unavailable default collation until it is fixed", func() {
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler := &DatabaseHostReconciler{Recorder: recorder}
+			host := &k8sv1.DatabaseHost{}
+
+			err := fmt.Errorf("%w: collation 'utf8mb4_0900_ai_ci' is not available on host 'mariadb'", provider.ErrUnsupportedLocale)
+			controllerReconciler.localeChecked(host, err)
+			Expect(recorder.Events).To(Receive(ContainSubstring(reasonUnsupportedLocale)))
+			Expect(meta.IsStatusConditionTrue(host.Status.Conditions, k8sv1.ConditionTypeLocaleUnsupported)).To(BeTrue())
+
+			controllerReconciler.localeChecked(host, err)
+			Expect(recorder.Events).NotTo(Receive())
+
+			controllerReconciler.localeChecked(host, nil)
+			Expect(meta.FindStatusCondition(host.Status.Conditions, k8sv1.ConditionTypeLocaleUnsupported)).To(BeNil())
+		})
+	})
 })
@@ -0,0 +1,341 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/audit"
+	"github.com/tuunit/external-database-operator/internal/migration"
+	"github.com/tuunit/external-database-operator/internal/provider"
+	"github.com/tuunit/external-database-operator/internal/sharding"
+	"github.com/tuunit/external-database-operator/internal/tracing"
+)
+
+const (
+	// migrationLockRetryInterval is the interval in which a migration locked by another run is retried
+	migrationLockRetryInterval = 10 * time.Second
+	// artifactPollInterval is the interval in which artifacts referenced by a tag are pulled again
+	artifactPollInterval = 5 * time.Minute
+)
+
+// DatabaseMigrationReconciler reconciles a DatabaseMigration object
+type DatabaseMigrationReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Audit records the statements executed against the hosts
+	Audit audit.Sink
+	// Pools are the connection pools to the hosts shared by all reconcilers
+	Pools *provider.Pools
+	// Shards are the shards of hosts reconciled by this replica, all hosts without sharding
+	Shards *sharding.Sharder
+	// Registry pulls the migrations of OCI artifacts, with the default HTTP client if unset
+	Registry *migration.Puller
+	// Options configure the workers and the retries of the controller
+	Options controller.Options
+}
+
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databasemigrations,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databasemigrations/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databasemigrations/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+
+// Reconcile applies the migrations of the ConfigMap or the OCI artifact up to the target version
+// once the target database is provisioned. A migration which failed or was changed after it was
+// applied stops the run until the migrations or the target are changed.
+func (r *DatabaseMigrationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	databaseMigration := &k8sv1beta1.DatabaseMigration{}
+	if err := r.Get(ctx, req.NamespacedName, databaseMigration); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !databaseMigration.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	database := &k8sv1beta1.Database{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: databaseMigration.Namespace, Name: databaseMigration.Spec.DatabaseRef.Name}, database); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		message := fmt.Sprintf("Database '%s' not found", databaseMigration.Spec.DatabaseRef.Name)
+		return r.wait(ctx, databaseMigration, k8sv1beta1.ConditionTypeTargetReady, reasonDatabaseNotFound, message)
+	}
+
+	// the migration is run by the replica owning the shard of the host of its database
+	if !r.Shards.Owns(database.Namespace, database.Spec.HostRef.Name) {
+		return ctrl.Result{}, nil
+	}
+
+	// the name of the database on the host is only known once the database is provisioned
+	if database.Status.Name == "" || !meta.IsStatusConditionTrue(database.Status.Conditions, k8sv1beta1.ConditionTypeReady) {
+		message := fmt.Sprintf("Database '%s' is not ready", database.Name)
+		return r.wait(ctx, databaseMigration, k8sv1beta1.ConditionTypeTargetReady, reasonDatabaseNotReady, message)
+	}
+
+	databaseHost := &k8sv1.DatabaseHost{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: database.Namespace, Name: database.Spec.HostRef.Name}, databaseHost); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		message := fmt.Sprintf("DatabaseHost '%s' not found", database.Spec.HostRef.Name)
+		return r.wait(ctx, databaseMigration, k8sv1beta1.ConditionTypeTargetReady, reasonHostNotFound, message)
+	}
+
+	hostSpec, err := resolveHostSpec(ctx, r, databaseHost)
+	if err != nil {
+		return r.wait(ctx, databaseMigration, k8sv1beta1.ConditionTypeTargetReady, reasonCredentialsNotFound, err.Error())
+	}
+	databaseHost.Spec = hostSpec
+
+	if databaseHost.Spec.Type != k8sv1.Postgres {
+		message := fmt.Sprintf("%s on %s hosts", provider.ErrMigrationsUnsupported, databaseHost.Spec.Type)
+		return r.fail(ctx, databaseMigration, k8sv1beta1.ConditionTypeTargetReady, reasonUnsupportedType, message)
+	}
+
+	if message, wait, unavailable := hostUnavailable(r.Pools, databaseHost); unavailable {
+		log.Info("DatabaseHost is unavailable", "retryAfter", wait)
+		setCondition(&databaseMigration.Status.Conditions, databaseMigration.Generation, k8sv1beta1.ConditionTypeTargetReady, metav1.ConditionFalse, reasonHostUnavailable, message)
+		return ctrl.Result{RequeueAfter: wait}, r.updateStatus(ctx, databaseMigration)
+	}
+
+	setCondition(&databaseMigration.Status.Conditions, databaseMigration.Generation, k8sv1beta1.ConditionTypeTargetReady, metav1.ConditionTrue, reasonDatabaseReady, fmt.Sprintf("Database '%s' is ready", database.Status.Name))
+
+	files, result, err := r.files(ctx, databaseMigration)
+	if result != nil {
+		return *result, err
+	}
+
+	migrations, err := migration.Parse(files)
+	if err != nil {
+		return r.fail(ctx, databaseMigration, k8sv1beta1.ConditionTypeReady, reasonInvalidMigrations, err.Error())
+	}
+
+	ctx = audit.WithSource(ctx, "DatabaseMigration", databaseMigration, databaseHost)
+	client := r.Pools.Postgres(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit)
+	table := databaseMigration.TrackingTable()
+
+	applied, err := client.AppliedMigrations(ctx, database.Status.Name, table)
+	if err != nil {
+		r.Recorder.Event(databaseMigration, corev1.EventTypeWarning, reasonConnectionFailed, err.Error())
+		return r.wait(ctx, databaseMigration, k8sv1beta1.ConditionTypeReady, reasonConnectionFailed, err.Error())
+	}
+
+	pending, err := migration.Unapplied(migrations, applied, databaseMigration.Spec.TargetVersion)
+	recordMigrations(databaseMigration, applied, pending)
+	if err != nil {
+		return r.fail(ctx, databaseMigration, k8sv1beta1.ConditionTypeReady, reasonMigrationFailed, err.Error())
+	}
+
+	if len(pending) > 0 {
+		message := fmt.Sprintf("Applying %d migrations to database '%s'", len(pending), database.Status.Name)
+		r.Recorder.Event(databaseMigration, corev1.EventTypeNormal, reasonMigrating, message)
+		databaseMigration.Status.Phase = k8sv1beta1.MigrationPhaseRunning
+		setCondition(&databaseMigration.Status.Conditions, databaseMigration.Generation, k8sv1beta1.ConditionTypeReady, metav1.ConditionFalse, reasonMigrating, message)
+		if err := r.updateStatus(ctx, databaseMigration); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		migrateErr := client.Migrate(ctx, database.Status.Name, database.Spec.Owner, table, pending)
+		if errors.Is(migrateErr, provider.ErrMigrationLocked) {
+			setCondition(&databaseMigration.Status.Conditions, databaseMigration.Generation, k8sv1beta1.ConditionTypeReady, metav1.ConditionFalse, reasonMigrationLocked, migrateErr.Error())
+			return ctrl.Result{RequeueAfter: migrationLockRetryInterval}, r.updateStatus(ctx, databaseMigration)
+		}
+
+		// the migrations applied before a failing one are committed, so the status is refreshed either way
+		if applied, err = client.AppliedMigrations(ctx, database.Status.Name, table); err != nil {
+			return ctrl.Result{}, err
+		}
+		if pending, err = migration.Unapplied(migrations, applied, databaseMigration.Spec.TargetVersion); err != nil {
+			return ctrl.Result{}, err
+		}
+		recordMigrations(databaseMigration, applied, pending)
+
+		if migrateErr != nil {
+			return r.fail(ctx, databaseMigration, k8sv1beta1.ConditionTypeReady, reasonMigrationFailed, migrateErr.Error())
+		}
+	}
+
+	message := fmt.Sprintf("Database '%s' is at version %d", database.Status.Name, databaseMigration.Status.CurrentVersion)
+	if databaseMigration.Status.Phase != k8sv1beta1.MigrationPhaseSucceeded {
+		r.Recorder.Event(databaseMigration, corev1.EventTypeNormal, reasonMigrated, message)
+	}
+	databaseMigration.Status.Phase = k8sv1beta1.MigrationPhaseSucceeded
+	setCondition(&databaseMigration.Status.Conditions, databaseMigration.Generation, k8sv1beta1.ConditionTypeReady, metav1.ConditionTrue, reasonMigrated, message)
+	return pollArtifact(databaseMigration), r.updateStatus(ctx, databaseMigration)
+}
+
+// files reads the migrations from the source of the migration. If they cannot be read, the
+// status records why and the result to return from the reconciliation is set.
+func (r *DatabaseMigrationReconciler) files(ctx context.Context, databaseMigration *k8sv1beta1.DatabaseMigration) (map[string]string, *ctrl.Result, error) {
+	source := databaseMigration.Spec.Source
+	if source.OCI == nil {
+		if source.ConfigMap == nil {
+			result, err := r.fail(ctx, databaseMigration, k8sv1beta1.ConditionTypeReady, reasonInvalidMigrations, "Neither a ConfigMap nor an OCI artifact is set as source")
+			return nil, &result, err
+		}
+
+		configMap := &corev1.ConfigMap{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: databaseMigration.Namespace, Name: source.ConfigMap.Name}, configMap); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, &ctrl.Result{}, err
+			}
+
+			message := fmt.Sprintf("ConfigMap '%s' not found", source.ConfigMap.Name)
+			result, err := r.wait(ctx, databaseMigration, k8sv1beta1.ConditionTypeReady, reasonMigrationsNotFound, message)
+			return nil, &result, err
+		}
+		return configMap.Data, nil, nil
+	}
+
+	ref, err := migration.ParseReference(source.OCI.Reference)
+	if err != nil {
+		result, err := r.fail(ctx, databaseMigration, k8sv1beta1.ConditionTypeReady, reasonInvalidMigrations, err.Error())
+		return nil, &result, err
+	}
+
+	var credentials migration.Credentials
+	if source.OCI.PullSecret != nil {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: databaseMigration.Namespace, Name: source.OCI.PullSecret.Name}, secret); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, &ctrl.Result{}, err
+			}
+
+			message := fmt.Sprintf("Secret '%s' not found", source.OCI.PullSecret.Name)
+			result, err := r.wait(ctx, databaseMigration, k8sv1beta1.ConditionTypeReady, reasonCredentialsNotFound, message)
+			return nil, &result, err
+		}
+
+		if credentials, err = migration.CredentialsFromDockerConfig(secret.Data[corev1.DockerConfigJsonKey], ref.Registry); err != nil {
+			message := fmt.Sprintf("Secret '%s': %s", secret.Name, err)
+			result, err := r.fail(ctx, databaseMigration, k8sv1beta1.ConditionTypeReady, reasonCredentialsNotFound, message)
+			return nil, &result, err
+		}
+	}
+
+	artifact, err := r.Registry.Pull(ctx, ref, credentials, source.OCI.PlainHTTP)
+	if err != nil {
+		r.Recorder.Event(databaseMigration, corev1.EventTypeWarning, reasonMigrationsNotFound, err.Error())
+		result, err := r.wait(ctx, databaseMigration, k8sv1beta1.ConditionTypeReady, reasonMigrationsNotFound, err.Error())
+		return nil, &result, err
+	}
+
+	databaseMigration.Status.ArtifactDigest = artifact.Digest
+	return artifact.Files, nil, nil
+}
+
+// pollArtifact requeues migrations reading from an artifact referenced by a tag,
+// so migrations pushed to the tag later are applied
+func pollArtifact(databaseMigration *k8sv1beta1.DatabaseMigration) ctrl.Result {
+	if databaseMigration.Spec.Source.OCI == nil || strings.Contains(databaseMigration.Spec.Source.OCI.Reference, "@") {
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: artifactPollInterval}
+}
+
+// recordMigrations publishes the applied and pending versions in the status of the migration
+func recordMigrations(databaseMigration *k8sv1beta1.DatabaseMigration, applied []k8sv1beta1.AppliedMigration, pending []provider.Migration) {
+	databaseMigration.Status.AppliedVersions = applied
+	databaseMigration.Status.CurrentVersion = 0
+	for _, migration := range applied {
+		databaseMigration.Status.CurrentVersion = max(databaseMigration.Status.CurrentVersion, migration.Version)
+	}
+
+	databaseMigration.Status.PendingVersions = nil
+	for _, migration := range pending {
+		databaseMigration.Status.PendingVersions = append(databaseMigration.Status.PendingVersions, migration.Version)
+	}
+}
+
+// wait records why the migration cannot run yet and retries it later
+func (r *DatabaseMigrationReconciler) wait(ctx context.Context, databaseMigration *k8sv1beta1.DatabaseMigration, conditionType, reason, message string) (ctrl.Result, error) {
+	databaseMigration.Status.Phase = k8sv1beta1.MigrationPhasePending
+	setCondition(&databaseMigration.Status.Conditions, databaseMigration.Generation, conditionType, metav1.ConditionFalse, reason, message)
+	setCondition(&databaseMigration.Status.Conditions, databaseMigration.Generation, k8sv1beta1.ConditionTypeReady, metav1.ConditionFalse, reason, message)
+	return ctrl.Result{RequeueAfter: backupRetryInterval}, r.updateStatus(ctx, databaseMigration)
+}
+
+// fail marks the migration as failed until its spec, its ConfigMap or the artifact behind its tag change
+func (r *DatabaseMigrationReconciler) fail(ctx context.Context, databaseMigration *k8sv1beta1.DatabaseMigration, conditionType, reason, message string) (ctrl.Result, error) {
+	r.Recorder.Event(databaseMigration, corev1.EventTypeWarning, reason, message)
+
+	databaseMigration.Status.Phase = k8sv1beta1.MigrationPhaseFailed
+	setCondition(&databaseMigration.Status.Conditions, databaseMigration.Generation, conditionType, metav1.ConditionFalse, reason, message)
+	setCondition(&databaseMigration.Status.Conditions, databaseMigration.Generation, k8sv1beta1.ConditionTypeReady, metav1.ConditionFalse, reason, message)
+	return pollArtifact(databaseMigration), r.updateStatus(ctx, databaseMigration)
+}
+
+func (r *DatabaseMigrationReconciler) updateStatus(ctx context.Context, databaseMigration *k8sv1beta1.DatabaseMigration) error {
+	if err := r.Status().Update(ctx, databaseMigration); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update DatabaseMigration status")
+		return err
+	}
+	return nil
+}
+
+// migrationsForConfigMap returns the migrations reading from the ConfigMap, so new migrations
+// are applied and fixed ones retried right after the ConfigMap changed
+func (r *DatabaseMigrationReconciler) migrationsForConfigMap(ctx context.Context, configMap client.Object) []reconcile.Request {
+	migrations := &k8sv1beta1.DatabaseMigrationList{}
+	if err := r.List(ctx, migrations, client.InNamespace(configMap.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list DatabaseMigrations")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, migration := range migrations.Items {
+		if migration.Spec.Source.ConfigMap != nil && migration.Spec.Source.ConfigMap.Name == configMap.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&migration)})
+		}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DatabaseMigrationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&k8sv1beta1.DatabaseMigration{}).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.migrationsForConfigMap)).
+		WithOptions(r.Options).
+		Complete(tracing.Reconciler("DatabaseMigration", r))
+}
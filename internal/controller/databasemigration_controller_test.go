@@ -0,0 +1,179 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/provider"
+)
+
+var _ = Describe("DatabaseMigration Controller", func() {
+	ctx := context.Background()
+
+	var c client.Client
+	var controllerReconciler *DatabaseMigrationReconciler
+	var host *k8sv1.DatabaseHost
+	var database *k8sv1beta1.Database
+	var databaseMigration *k8sv1beta1.DatabaseMigration
+
+	migrationName := types.NamespacedName{Name: "schema", Namespace: "default"}
+
+	BeforeEach(func() {
+		host = &k8sv1.DatabaseHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "mysql", Namespace: "default"},
+			Spec:       k8sv1.DatabaseHostSpec{Type: k8sv1.MySQL, Host: "mysql.example.com", Superuser: "root", Password: "secret"},
+		}
+		database = &k8sv1beta1.Database{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec:       k8sv1beta1.DatabaseSpec{Name: "app", Owner: "app", HostRef: k8sv1beta1.DatabaseHostReference{Name: host.Name}},
+			Status: k8sv1beta1.DatabaseStatus{
+				Name:       "app",
+				Conditions: []metav1.Condition{{Type: k8sv1beta1.ConditionTypeReady, Status: metav1.ConditionTrue, Reason: reasonCreated}},
+			},
+		}
+		databaseMigration = &k8sv1beta1.DatabaseMigration{
+			ObjectMeta: metav1.ObjectMeta{Name: migrationName.Name, Namespace: migrationName.Namespace},
+			Spec: k8sv1beta1.DatabaseMigrationSpec{
+				DatabaseRef: k8sv1beta1.DatabaseReference{Name: database.Name},
+				Source:      k8sv1beta1.MigrationSource{ConfigMap: &corev1.LocalObjectReference{Name: "app-migrations"}},
+			},
+		}
+	})
+
+	reconcileMigration := func() *k8sv1beta1.DatabaseMigration {
+		c = fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&k8sv1beta1.DatabaseMigration{}).
+			WithObjects(host, database, databaseMigration).
+			Build()
+		controllerReconciler = &DatabaseMigrationReconciler{
+			Client:   c,
+			Scheme:   scheme.Scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: migrationName})
+		Expect(err).NotTo(HaveOccurred())
+
+		migration := &k8sv1beta1.DatabaseMigration{}
+		Expect(c.Get(ctx, migrationName, migration)).To(Succeed())
+		return migration
+	}
+
+	It("should wait for the database to be ready", func() {
+		database.Status = k8sv1beta1.DatabaseStatus{}
+
+		migration := reconcileMigration()
+		Expect(migration.Status.Phase).To(Equal(k8sv1beta1.MigrationPhasePending))
+		Expect(meta.IsStatusConditionFalse(migration.Status.Conditions, k8sv1beta1.ConditionTypeTargetReady)).To(BeTrue())
+	})
+
+	It("should refuse hosts without support for migrations", func() {
+		migration := reconcileMigration()
+		Expect(migration.Status.Phase).To(Equal(k8sv1beta1.MigrationPhaseFailed))
+		condition := meta.FindStatusCondition(migration.Status.Conditions, k8sv1beta1.ConditionTypeTargetReady)
+		Expect(condition.Reason).To(Equal(reasonUnsupportedType))
+		Expect(condition.Message).To(Equal("Migrations are not supported on mysql hosts"))
+	})
+
+	It("should record the applied and pending versions", func() {
+		recordMigrations(databaseMigration,
+			[]k8sv1beta1.AppliedMigration{{Version: 1, Name: "create_users"}, {Version: 2, Name: "add_email"}},
+			[]provider.Migration{{Version: 3, Name: "create_orders"}})
+
+		Expect(databaseMigration.Status.CurrentVersion).To(Equal(int64(2)))
+		Expect(databaseMigration.Status.AppliedVersions).To(HaveLen(2))
+		Expect(databaseMigration.Status.PendingVersions).To(Equal([]int64{3}))
+		Expect(databaseMigration.TrackingTable()).To(Equal(k8sv1beta1.DefaultMigrationTable))
+	})
+
+	It("should read the migrations from an OCI artifact", func() {
+		content := "CREATE TABLE users (id bigint);"
+		layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+		manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[`+
+			`{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"%s","size":%d,`+
+			`"annotations":{"org.opencontainers.image.title":"0001_create_users.up.sql"}}]}`, layerDigest, len(content))
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/v2/acme/migrations/manifests/v1":
+				fmt.Fprint(w, manifest)
+			case "/v2/acme/migrations/blobs/" + layerDigest:
+				fmt.Fprint(w, content)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer registry.Close()
+
+		// the host is unreachable, so the migration waits after the artifact was pulled
+		host.Spec = k8sv1.DatabaseHostSpec{Type: k8sv1.Postgres, Host: "127.0.0.1", Port: 1, Superuser: "postgres", Password: "postgres"}
+		databaseMigration.Spec.Source = k8sv1beta1.MigrationSource{OCI: &k8sv1beta1.OCIArtifactSource{
+			Reference: strings.TrimPrefix(registry.URL, "http://") + "/acme/migrations:v1",
+			PlainHTTP: true,
+		}}
+
+		migration := reconcileMigration()
+		Expect(migration.Status.Phase).To(Equal(k8sv1beta1.MigrationPhasePending))
+		Expect(migration.Status.ArtifactDigest).To(Equal(fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest)))))
+		Expect(meta.FindStatusCondition(migration.Status.Conditions, k8sv1beta1.ConditionTypeReady).Reason).To(Equal(reasonConnectionFailed))
+		Expect(pollArtifact(migration)).To(Equal(ctrl.Result{RequeueAfter: artifactPollInterval}))
+	})
+
+	It("should wait for the pull secret of an OCI artifact", func() {
+		host.Spec.Type = k8sv1.Postgres
+		databaseMigration.Spec.Source = k8sv1beta1.MigrationSource{OCI: &k8sv1beta1.OCIArtifactSource{
+			Reference:  "ghcr.io/acme/migrations@sha256:" + strings.Repeat("a", 64),
+			PullSecret: &corev1.LocalObjectReference{Name: "ghcr"},
+		}}
+
+		migration := reconcileMigration()
+		Expect(migration.Status.Phase).To(Equal(k8sv1beta1.MigrationPhasePending))
+		Expect(meta.FindStatusCondition(migration.Status.Conditions, k8sv1beta1.ConditionTypeReady).Reason).To(Equal(reasonCredentialsNotFound))
+		Expect(pollArtifact(migration)).To(Equal(ctrl.Result{}))
+	})
+
+	It("should enqueue the migrations reading from a ConfigMap", func() {
+		reconcileMigration()
+
+		Expect(controllerReconciler.migrationsForConfigMap(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "app-migrations", Namespace: "default"}})).
+			To(ConsistOf(reconcile.Request{NamespacedName: migrationName}))
+		Expect(controllerReconciler.migrationsForConfigMap(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}})).
+			To(BeEmpty())
+	})
+})
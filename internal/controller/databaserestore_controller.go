@@ -0,0 +1,293 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/audit"
+	"github.com/tuunit/external-database-operator/internal/backup"
+	"github.com/tuunit/external-database-operator/internal/provider"
+	"github.com/tuunit/external-database-operator/internal/sharding"
+	"github.com/tuunit/external-database-operator/internal/tracing"
+)
+
+// DatabaseRestoreReconciler reconciles a DatabaseRestore object
+type DatabaseRestoreReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Audit records the statements executed against the hosts
+	Audit audit.Sink
+	// Pools are the connection pools to the hosts shared by all reconcilers
+	Pools *provider.Pools
+	// Shards are the shards of hosts reconciled by this replica, all hosts without sharding
+	Shards *sharding.Sharder
+	// Options configure the workers and the retries of the controller
+	Options controller.Options
+}
+
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databaserestores,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databaserestores/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databaserestores/finalizers,verbs=update
+
+// Reconcile runs a Job loading the dump of the referenced backup into the target database once
+// the backup succeeded and the target is provisioned. Targets which already contain objects are
+// only restored into when the restore is forced.
+func (r *DatabaseRestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	databaseRestore := &k8sv1beta1.DatabaseRestore{}
+	if err := r.Get(ctx, req.NamespacedName, databaseRestore); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !databaseRestore.ObjectMeta.DeletionTimestamp.IsZero() || databaseRestore.Finished() {
+		return ctrl.Result{}, nil
+	}
+
+	databaseBackup := &k8sv1beta1.DatabaseBackup{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: databaseRestore.Namespace, Name: databaseRestore.Spec.BackupRef.Name}, databaseBackup); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		message := fmt.Sprintf("DatabaseBackup '%s' not found", databaseRestore.Spec.BackupRef.Name)
+		return r.wait(ctx, databaseRestore, k8sv1beta1.ConditionTypeBackupAvailable, reasonBackupNotFound, message)
+	}
+
+	switch databaseBackup.Status.Phase {
+	case k8sv1beta1.BackupPhaseSucceeded:
+		setCondition(&databaseRestore.Status.Conditions, databaseRestore.Generation, k8sv1beta1.ConditionTypeBackupAvailable, metav1.ConditionTrue, reasonBackupSucceeded, fmt.Sprintf("Dump '%s' is available", databaseBackup.Status.Location))
+	case k8sv1beta1.BackupPhaseFailed:
+		return r.fail(ctx, databaseRestore, k8sv1beta1.ConditionTypeBackupAvailable, reasonBackupFailed, fmt.Sprintf("DatabaseBackup '%s' failed", databaseBackup.Name))
+	default:
+		message := fmt.Sprintf("DatabaseBackup '%s' has not succeeded yet", databaseBackup.Name)
+		return r.wait(ctx, databaseRestore, k8sv1beta1.ConditionTypeBackupAvailable, reasonBackupRunning, message)
+	}
+
+	database := &k8sv1beta1.Database{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: databaseRestore.Namespace, Name: databaseRestore.Spec.DatabaseRef.Name}, database); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		message := fmt.Sprintf("Database '%s' not found", databaseRestore.Spec.DatabaseRef.Name)
+		return r.wait(ctx, databaseRestore, k8sv1beta1.ConditionTypeTargetReady, reasonDatabaseNotFound, message)
+	}
+
+	// the restore is run by the replica owning the shard of the host of its target
+	if !r.Shards.Owns(database.Namespace, database.Spec.HostRef.Name) {
+		return ctrl.Result{}, nil
+	}
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: databaseRestore.Namespace, Name: databaseRestore.Name + "-restore"}, job)
+	if apierrors.IsNotFound(err) {
+		return r.start(ctx, databaseRestore, databaseBackup, database)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	switch {
+	case jobFinished(job, batchv1.JobComplete):
+		if err := deleteJobCredentials(ctx, r, databaseRestore.Namespace, restoreCredentialsSecret(databaseRestore)); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		message := fmt.Sprintf("Restored '%s' into database '%s'", databaseBackup.Status.Location, database.Status.Name)
+		r.Recorder.Event(databaseRestore, corev1.EventTypeNormal, reasonRestoreSucceeded, message)
+		databaseRestore.Status.Phase = k8sv1beta1.RestorePhaseSucceeded
+		databaseRestore.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+		setCondition(&databaseRestore.Status.Conditions, databaseRestore.Generation, k8sv1beta1.ConditionTypeReady, metav1.ConditionTrue, reasonRestoreSucceeded, message)
+		return ctrl.Result{}, r.updateStatus(ctx, databaseRestore)
+	case jobFinished(job, batchv1.JobFailed):
+		return r.fail(ctx, databaseRestore, k8sv1beta1.ConditionTypeReady, reasonRestoreFailed, fmt.Sprintf("Job '%s' failed, see the logs of its pods", job.Name))
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// start checks the target and creates the credentials and the Job restoring the dump
+func (r *DatabaseRestoreReconciler) start(ctx context.Context, databaseRestore *k8sv1beta1.DatabaseRestore, databaseBackup *k8sv1beta1.DatabaseBackup, database *k8sv1beta1.Database) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	databaseHost := &k8sv1.DatabaseHost{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: database.Namespace, Name: database.Spec.HostRef.Name}, databaseHost); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		message := fmt.Sprintf("DatabaseHost '%s' not found", database.Spec.HostRef.Name)
+		return r.wait(ctx, databaseRestore, k8sv1beta1.ConditionTypeTargetReady, reasonHostNotFound, message)
+	}
+
+	// a dump can only be loaded by the tools of the engine it was taken from
+	if databaseBackup.Status.DatabaseType != "" && databaseBackup.Status.DatabaseType != databaseHost.Spec.Type {
+		message := fmt.Sprintf("DatabaseBackup '%s' is a %s dump and cannot be restored into database '%s' on %s host '%s'",
+			databaseBackup.Name, databaseBackup.Status.DatabaseType, database.Name, databaseHost.Spec.Type, databaseHost.Name)
+		return r.fail(ctx, databaseRestore, k8sv1beta1.ConditionTypeTargetReady, reasonTypeMismatch, message)
+	}
+
+	// the name of the database on the host is only known once the database is provisioned
+	if database.Status.Name == "" || !meta.IsStatusConditionTrue(database.Status.Conditions, k8sv1beta1.ConditionTypeReady) {
+		message := fmt.Sprintf("Database '%s' is not ready", database.Name)
+		return r.wait(ctx, databaseRestore, k8sv1beta1.ConditionTypeTargetReady, reasonDatabaseNotReady, message)
+	}
+
+	hostSpec, err := resolveHostSpec(ctx, r, databaseHost)
+	if err != nil {
+		return r.wait(ctx, databaseRestore, k8sv1beta1.ConditionTypeTargetReady, reasonCredentialsNotFound, err.Error())
+	}
+	databaseHost.Spec = hostSpec
+
+	var owner string
+	if databaseRestore.Spec.RemapOwner {
+		if database.Spec.Owner == "" {
+			message := fmt.Sprintf("Database '%s' has no owner to remap the restored objects to", database.Name)
+			return r.fail(ctx, databaseRestore, k8sv1beta1.ConditionTypeTargetReady, reasonOwnerNotSet, message)
+		}
+		owner = database.Spec.Owner
+	}
+
+	if !databaseRestore.Spec.Force {
+		if message, wait, unavailable := hostUnavailable(r.Pools, databaseHost); unavailable {
+			log.Info("DatabaseHost is unavailable", "retryAfter", wait)
+			setCondition(&databaseRestore.Status.Conditions, databaseRestore.Generation, k8sv1beta1.ConditionTypeTargetReady, metav1.ConditionFalse, reasonHostUnavailable, message)
+			return ctrl.Result{RequeueAfter: wait}, r.updateStatus(ctx, databaseRestore)
+		}
+
+		var empty bool
+		switch databaseHost.Spec.Type {
+		case k8sv1.MySQL:
+			client := r.Pools.MySQL(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit)
+			empty, err = client.DatabaseEmpty(audit.WithSource(ctx, "DatabaseRestore", databaseRestore, databaseHost), database.Status.Name)
+		case k8sv1.Postgres:
+			client := r.Pools.Postgres(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit)
+			empty, err = client.DatabaseEmpty(audit.WithSource(ctx, "DatabaseRestore", databaseRestore, databaseHost), database.Status.Name)
+		}
+		if err != nil {
+			r.Recorder.Event(databaseRestore, corev1.EventTypeWarning, reasonConnectionFailed, err.Error())
+			return r.wait(ctx, databaseRestore, k8sv1beta1.ConditionTypeTargetReady, reasonConnectionFailed, err.Error())
+		}
+		if !empty {
+			message := fmt.Sprintf("Database '%s' is not empty, set force to overwrite it", database.Status.Name)
+			return r.fail(ctx, databaseRestore, k8sv1beta1.ConditionTypeTargetReady, reasonTargetNotEmpty, message)
+		}
+	}
+
+	setCondition(&databaseRestore.Status.Conditions, databaseRestore.Generation, k8sv1beta1.ConditionTypeTargetReady, metav1.ConditionTrue, reasonDatabaseReady, fmt.Sprintf("Database '%s' is ready", database.Status.Name))
+
+	if err := createJobCredentials(ctx, r, r.Scheme, databaseRestore, restoreCredentialsSecret(databaseRestore), hostSpec.Password); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	job, err := backup.RestoreJob(databaseRestore, databaseBackup, backup.Target{
+		Host:              hostSpec,
+		Database:          database.Status.Name,
+		CredentialsSecret: restoreCredentialsSecret(databaseRestore),
+	}, owner)
+	if err != nil {
+		return r.fail(ctx, databaseRestore, k8sv1beta1.ConditionTypeReady, reasonRestoreFailed, err.Error())
+	}
+	if err := controllerutil.SetControllerReference(databaseRestore, job, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) {
+		return ctrl.Result{}, err
+	}
+
+	message := fmt.Sprintf("Job '%s' started restoring '%s' into database '%s'", job.Name, databaseBackup.Status.Location, database.Status.Name)
+	r.Recorder.Event(databaseRestore, corev1.EventTypeNormal, reasonRestoreStarted, message)
+
+	databaseRestore.Status.Phase = k8sv1beta1.RestorePhaseRunning
+	databaseRestore.Status.JobName = job.Name
+	databaseRestore.Status.StartTime = &metav1.Time{Time: time.Now()}
+	setCondition(&databaseRestore.Status.Conditions, databaseRestore.Generation, k8sv1beta1.ConditionTypeReady, metav1.ConditionFalse, reasonRestoreRunning, message)
+	return ctrl.Result{}, r.updateStatus(ctx, databaseRestore)
+}
+
+// wait records why the restore cannot start yet and retries it later
+func (r *DatabaseRestoreReconciler) wait(ctx context.Context, databaseRestore *k8sv1beta1.DatabaseRestore, conditionType, reason, message string) (ctrl.Result, error) {
+	databaseRestore.Status.Phase = k8sv1beta1.RestorePhasePending
+	setCondition(&databaseRestore.Status.Conditions, databaseRestore.Generation, conditionType, metav1.ConditionFalse, reason, message)
+	setCondition(&databaseRestore.Status.Conditions, databaseRestore.Generation, k8sv1beta1.ConditionTypeReady, metav1.ConditionFalse, reason, message)
+	return ctrl.Result{RequeueAfter: backupRetryInterval}, r.updateStatus(ctx, databaseRestore)
+}
+
+// fail marks the restore as failed for good
+func (r *DatabaseRestoreReconciler) fail(ctx context.Context, databaseRestore *k8sv1beta1.DatabaseRestore, conditionType, reason, message string) (ctrl.Result, error) {
+	r.Recorder.Event(databaseRestore, corev1.EventTypeWarning, reason, message)
+	if err := deleteJobCredentials(ctx, r, databaseRestore.Namespace, restoreCredentialsSecret(databaseRestore)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	databaseRestore.Status.Phase = k8sv1beta1.RestorePhaseFailed
+	databaseRestore.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	setCondition(&databaseRestore.Status.Conditions, databaseRestore.Generation, conditionType, metav1.ConditionFalse, reason, message)
+	setCondition(&databaseRestore.Status.Conditions, databaseRestore.Generation, k8sv1beta1.ConditionTypeReady, metav1.ConditionFalse, reason, message)
+	return ctrl.Result{}, r.updateStatus(ctx, databaseRestore)
+}
+
+func (r *DatabaseRestoreReconciler) updateStatus(ctx context.Context, databaseRestore *k8sv1beta1.DatabaseRestore) error {
+	if err := r.Status().Update(ctx, databaseRestore); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update DatabaseRestore status")
+		return err
+	}
+	return nil
+}
+
+// setCondition sets the condition of the given type without updating the status
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: generation,
+	})
+}
+
+// restoreCredentialsSecret returns the name of the secret holding the superuser password for the Job of the restore
+func restoreCredentialsSecret(databaseRestore *k8sv1beta1.DatabaseRestore) string {
+	return databaseRestore.Name + "-restore-credentials"
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DatabaseRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&k8sv1beta1.DatabaseRestore{}).
+		Owns(&batchv1.Job{}).
+		WithOptions(r.Options).
+		Complete(tracing.Reconciler("DatabaseRestore", r))
+}
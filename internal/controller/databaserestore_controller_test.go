@@ -0,0 +1,158 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+var _ = Describe("DatabaseRestore Controller", func() {
+	ctx := context.Background()
+
+	var c client.Client
+	var controllerReconciler *DatabaseRestoreReconciler
+	var host *k8sv1.DatabaseHost
+	var databaseBackup *k8sv1beta1.DatabaseBackup
+	var databaseRestore *k8sv1beta1.DatabaseRestore
+
+	restoreName := types.NamespacedName{Name: "rollback", Namespace: "default"}
+
+	BeforeEach(func() {
+		host = &k8sv1.DatabaseHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "mysql", Namespace: "default"},
+			Spec:       k8sv1.DatabaseHostSpec{Type: k8sv1.MySQL, Host: "mysql.example.com", Superuser: "root", Password: "secret"},
+		}
+		databaseBackup = &k8sv1beta1.DatabaseBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "default"},
+			Spec: k8sv1beta1.DatabaseBackupSpec{
+				DatabaseRef: k8sv1beta1.DatabaseReference{Name: "app"},
+				Storage: k8sv1beta1.BackupStorage{
+					PersistentVolumeClaim: &k8sv1beta1.PersistentVolumeClaimStorage{ClaimName: "dumps"},
+				},
+			},
+			Status: k8sv1beta1.DatabaseBackupStatus{Phase: k8sv1beta1.BackupPhaseSucceeded, Location: "/default/app/nightly.dump.gz"},
+		}
+		databaseRestore = &k8sv1beta1.DatabaseRestore{
+			ObjectMeta: metav1.ObjectMeta{Name: restoreName.Name, Namespace: restoreName.Namespace},
+			Spec: k8sv1beta1.DatabaseRestoreSpec{
+				BackupRef:   k8sv1beta1.DatabaseBackupReference{Name: databaseBackup.Name},
+				DatabaseRef: k8sv1beta1.DatabaseReference{Name: "app-copy"},
+			},
+		}
+	})
+
+	reconcileRestore := func(objects ...client.Object) *k8sv1beta1.DatabaseRestore {
+		database := &k8sv1beta1.Database{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-copy", Namespace: "default"},
+			Spec:       k8sv1beta1.DatabaseSpec{Name: "app_copy", Owner: "app", HostRef: k8sv1beta1.DatabaseHostReference{Name: host.Name}},
+			Status: k8sv1beta1.DatabaseStatus{
+				Name:       "app_copy",
+				Conditions: []metav1.Condition{{Type: k8sv1beta1.ConditionTypeReady, Status: metav1.ConditionTrue, Reason: reasonCreated}},
+			},
+		}
+
+		c = fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&k8sv1beta1.DatabaseRestore{}).
+			WithObjects(append(objects, host, database, databaseRestore)...).
+			Build()
+		controllerReconciler = &DatabaseRestoreReconciler{
+			Client:   c,
+			Scheme:   scheme.Scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: restoreName})
+		Expect(err).NotTo(HaveOccurred())
+
+		restore := &k8sv1beta1.DatabaseRestore{}
+		Expect(c.Get(ctx, restoreName, restore)).To(Succeed())
+		return restore
+	}
+
+	It("should wait for the backup to succeed", func() {
+		databaseBackup.Status.Phase = k8sv1beta1.BackupPhaseRunning
+
+		restore := reconcileRestore(databaseBackup)
+		Expect(restore.Status.Phase).To(Equal(k8sv1beta1.RestorePhasePending))
+		Expect(meta.IsStatusConditionFalse(restore.Status.Conditions, k8sv1beta1.ConditionTypeBackupAvailable)).To(BeTrue())
+	})
+
+	It("should wait until it can verify that the MySQL database is empty", func() {
+		host.Spec.Host = "127.0.0.1"
+		host.Spec.Port = 1
+
+		restore := reconcileRestore(databaseBackup)
+		Expect(restore.Status.Phase).To(Equal(k8sv1beta1.RestorePhasePending))
+		Expect(meta.IsStatusConditionTrue(restore.Status.Conditions, k8sv1beta1.ConditionTypeBackupAvailable)).To(BeTrue())
+		condition := meta.FindStatusCondition(restore.Status.Conditions, k8sv1beta1.ConditionTypeTargetReady)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(reasonConnectionFailed))
+	})
+
+	It("should refuse to restore a dump of another database type", func() {
+		databaseBackup.Status.DatabaseType = k8sv1.Postgres
+		databaseRestore.Spec.Force = true
+
+		restore := reconcileRestore(databaseBackup)
+		Expect(restore.Status.Phase).To(Equal(k8sv1beta1.RestorePhaseFailed))
+		condition := meta.FindStatusCondition(restore.Status.Conditions, k8sv1beta1.ConditionTypeTargetReady)
+		Expect(condition.Reason).To(Equal(reasonTypeMismatch))
+		Expect(condition.Message).To(ContainSubstring("is a postgres dump"))
+		Expect(errors.IsNotFound(c.Get(ctx, types.NamespacedName{Name: "rollback-restore", Namespace: "default"}, &batchv1.Job{}))).To(BeTrue())
+	})
+
+	It("should run the restore Job when forced", func() {
+		databaseRestore.Spec.Force = true
+		databaseRestore.Spec.RemapOwner = true
+
+		restore := reconcileRestore(databaseBackup)
+		Expect(restore.Status.Phase).To(Equal(k8sv1beta1.RestorePhaseRunning))
+		Expect(meta.IsStatusConditionTrue(restore.Status.Conditions, k8sv1beta1.ConditionTypeTargetReady)).To(BeTrue())
+
+		job := &batchv1.Job{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "rollback-restore", Namespace: "default"}, job)).To(Succeed())
+		Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "DB_OWNER", Value: "app"}))
+
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		Expect(c.Status().Update(ctx, job)).To(Succeed())
+
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: restoreName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, restoreName, restore)).To(Succeed())
+		Expect(restore.Status.Phase).To(Equal(k8sv1beta1.RestorePhaseSucceeded))
+		Expect(meta.IsStatusConditionTrue(restore.Status.Conditions, k8sv1beta1.ConditionTypeReady)).To(BeTrue())
+	})
+})
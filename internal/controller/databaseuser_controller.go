@@ -18,24 +18,65 @@ package controller
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
 	k8sv1alpha1 "github.com/tuunit/external-database-operator/api/v1alpha1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/audit"
+	"github.com/tuunit/external-database-operator/internal/maintenance"
+	"github.com/tuunit/external-database-operator/internal/provider"
+	"github.com/tuunit/external-database-operator/internal/sharding"
+	"github.com/tuunit/external-database-operator/internal/tracing"
 )
 
 // DatabaseUserReconciler reconciles a DatabaseUser object
 type DatabaseUserReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// Audit records the statements executed against the hosts
+	Audit audit.Sink
+	// Pools are the connection pools to the hosts shared by all reconcilers
+	Pools *provider.Pools
+	// Shards are the shards of hosts reconciled by this replica, all hosts without sharding
+	Shards *sharding.Sharder
+	// Options configure the workers and the retries of the controller
+	Options controller.Options
+	// Slots limit the reconciles running against a single host
+	Slots *HostSlots
+	// DryRun only plans the statements for all users instead of executing them
+	DryRun bool
 }
 
 //+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databaseusers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databaseusers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=k8s.tuunit.com,resources=databaseusers/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -47,16 +88,550 @@ type DatabaseUserReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.17.0/pkg/reconcile
 func (r *DatabaseUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	log := log.FromContext(ctx)
 
-	// TODO(user): your logic here
+	finalizer := "k8s.tuunit.com/finalizer"
+
+	databaseUser := &k8sv1beta1.DatabaseUser{}
+	if err := r.Get(ctx, req.NamespacedName, databaseUser); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// the user is reconciled by the replica owning the shard of its host
+	if !r.Shards.Owns(databaseUser.Namespace, databaseUser.Spec.HostRef.Name) {
+		return ctrl.Result{}, nil
+	}
+
+	host := types.NamespacedName{Namespace: databaseUser.Namespace, Name: databaseUser.Spec.HostRef.Name}
+	if !r.Slots.acquire(host) {
+		log.V(1).Info("Too many reconciles running against the host, requeueing", "host", host.Name)
+		return ctrl.Result{Requeue: true}, nil
+	}
+	defer r.Slots.release(host)
+
+	// a paused user is not even finalized, its deletion waits until it is resumed
+	if databaseUser.Paused() {
+		log.Info("Reconciliation is paused")
+		message := fmt.Sprintf("Reconciliation is paused by the annotation %s", k8sv1beta1.AnnotationPaused)
+		return ctrl.Result{}, r.setPausedCondition(ctx, databaseUser, message)
+	}
+
+	if databaseUser.ObjectMeta.DeletionTimestamp.IsZero() {
+		// a user converted from v1alpha1 without a host fails the validation of its hostRef,
+		// so it cannot get the finalizer and only its status is updated until the host is named
+		if databaseUser.Spec.HostRef.Name == "" {
+			log.Info("HostRef is not set")
+			message := fmt.Sprintf("HostRef is not set, users created through v1alpha1 name their host with the annotation %s", k8sv1alpha1.AnnotationHostRef)
+			return ctrl.Result{}, r.setReadyCondition(ctx, databaseUser, metav1.ConditionFalse, reasonHostRefNotSet, message)
+		}
+
+		if !controllerutil.ContainsFinalizer(databaseUser, finalizer) {
+			controllerutil.AddFinalizer(databaseUser, finalizer)
+			if err := r.Update(ctx, databaseUser); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	} else {
+		if controllerutil.ContainsFinalizer(databaseUser, finalizer) {
+			if result, err := r.finalize(ctx, databaseUser); err != nil || !result.IsZero() {
+				return result, err
+			}
+
+			controllerutil.RemoveFinalizer(databaseUser, finalizer)
+			if err := r.Update(ctx, databaseUser); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	spec := databaseUser.Spec
+
+	databaseHost := &k8sv1.DatabaseHost{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: databaseUser.Namespace, Name: spec.HostRef.Name}, databaseHost); err != nil {
+		log.Error(err, "unable to fetch DatabaseHost")
+
+		message := fmt.Sprintf("DatabaseHost '%s' not found", spec.HostRef.Name)
+		r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonHostNotFound, message)
+		if err := r.setReadyCondition(ctx, databaseUser, metav1.ConditionFalse, reasonHostNotFound, message); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if databaseHost.Paused() {
+		log.Info("Reconciliation of the host is paused")
+		message := fmt.Sprintf("Reconciliation of DatabaseHost '%s' is paused", databaseHost.Name)
+		return ctrl.Result{RequeueAfter: hostHealthCheckInterval}, r.setPausedCondition(ctx, databaseUser, message)
+	}
+
+	hostSpec, err := resolveHostSpec(ctx, r, databaseHost)
+	if err != nil {
+		r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonCredentialsNotFound, err.Error())
+		return ctrl.Result{}, r.setReadyCondition(ctx, databaseUser, metav1.ConditionFalse, reasonCredentialsNotFound, err.Error())
+	}
+	databaseHost.Spec = hostSpec
+
+	if message, wait, unavailable := hostUnavailable(r.Pools, databaseHost); unavailable {
+		log.Info("DatabaseHost is unavailable", "retryAfter", wait)
+		return ctrl.Result{RequeueAfter: wait}, r.setReadyCondition(ctx, databaseUser, metav1.ConditionFalse, reasonHostUnavailable, message)
+	}
+
+	password, err := r.password(ctx, databaseUser)
+	if err != nil {
+		r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonPasswordNotFound, err.Error())
+		return ctrl.Result{}, r.setReadyCondition(ctx, databaseUser, metav1.ConditionFalse, reasonPasswordNotFound, err.Error())
+	}
+
+	ctx = audit.WithSource(ctx, "DatabaseUser", databaseUser, databaseHost)
+
+	if r.DryRun || databaseUser.DryRun() {
+		return ctrl.Result{}, r.plan(ctx, databaseUser, databaseHost, password)
+	}
+
+	databaseUser.Status.PendingOperations = nil
+	meta.RemoveStatusCondition(&databaseUser.Status.Conditions, k8sv1beta1.ConditionTypeMaintenancePending)
+
+	// password rotations wait for the next maintenance window of the host
+	var rotateAt time.Time
+	applied := passwordApplied(databaseUser.Status.PasswordDigest, password)
+	if databaseUser.Status.PasswordDigest != "" && !applied {
+		open, next, err := maintenance.Open(databaseHost.Spec.MaintenanceWindows, time.Now())
+		if err != nil {
+			r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonInvalidMaintenanceWindow, err.Error())
+			return ctrl.Result{}, r.setReadyCondition(ctx, databaseUser, metav1.ConditionFalse, reasonInvalidMaintenanceWindow, err.Error())
+		}
+		if !open {
+			rotateAt = next
+		}
+	}
+
+	switch databaseHost.Spec.Type {
+	case k8sv1.MySQL:
+		message := fmt.Sprintf("Users on %s host '%s' are not supported yet", databaseHost.Spec.Type, databaseHost.Name)
+		r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonUnsupportedHostType, message)
+		return ctrl.Result{}, r.setReadyCondition(ctx, databaseUser, metav1.ConditionFalse, reasonUnsupportedHostType, message)
+	case k8sv1.Postgres:
+		log.Info("Postgres database host")
+
+		client := r.Pools.Postgres(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit)
+
+		created, err := client.CreateUser(ctx, &spec, password)
+		if err != nil {
+			r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonCreateFailed, err.Error())
+			return ctrl.Result{}, r.setReadyCondition(ctx, databaseUser, metav1.ConditionFalse, reasonCreateFailed, err.Error())
+		}
+
+		if created {
+			r.Recorder.Eventf(databaseUser, corev1.EventTypeNormal, reasonCreated, "User '%s' successfully created.", spec.Username)
+		} else if !applied && rotateAt.IsZero() {
+			if err := client.SetPassword(ctx, spec.Username, password); err != nil {
+				r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonPasswordFailed, err.Error())
+				return ctrl.Result{}, r.setReadyCondition(ctx, databaseUser, metav1.ConditionFalse, reasonPasswordFailed, err.Error())
+			}
+			r.Recorder.Eventf(databaseUser, corev1.EventTypeNormal, reasonPasswordRotated, "Password of user '%s' rotated.", spec.Username)
+		}
+		if created || !applied && rotateAt.IsZero() {
+			if databaseUser.Status.PasswordDigest, err = passwordDigest(password); err != nil {
+				return ctrl.Result{}, err
+			}
+			applied = true
+		}
+
+		granted, revoked := diffPrivileges(databaseUser.Status.Privileges, spec.Privileges)
+		if err := client.RevokePrivileges(ctx, spec.Username, revoked); err != nil {
+			r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonGrantsFailed, err.Error())
+			return ctrl.Result{}, r.setReadyCondition(ctx, databaseUser, metav1.ConditionFalse, reasonGrantsFailed, err.Error())
+		}
+		if err := client.GrantPrivileges(ctx, spec.Username, granted); err != nil {
+			r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonGrantsFailed, err.Error())
+			return ctrl.Result{}, r.setReadyCondition(ctx, databaseUser, metav1.ConditionFalse, reasonGrantsFailed, err.Error())
+		}
+		if len(granted) > 0 || len(revoked) > 0 {
+			r.Recorder.Eventf(databaseUser, corev1.EventTypeNormal, reasonGrantsChanged,
+				"Granted %d and revoked %d privileges of user '%s'.", len(granted), len(revoked), spec.Username)
+		}
+		databaseUser.Status.Privileges = spec.Privileges
+	}
+
+	// the user keeps logging in with its current password until the window opens
+	var result ctrl.Result
+	if !applied && !rotateAt.IsZero() {
+		r.deferOperation(databaseUser, fmt.Sprintf("rotate password of user '%s'", spec.Username), rotateAt)
+		result.RequeueAfter = time.Until(rotateAt)
+	}
+
+	message := fmt.Sprintf("User '%s' successfully created.", spec.Username)
+	return result, r.setReadyCondition(ctx, databaseUser, metav1.ConditionTrue, reasonCreated, message)
+}
+
+// password returns the password of the user, either set inline or read from the referenced secret
+func (r *DatabaseUserReconciler) password(ctx context.Context, databaseUser *k8sv1beta1.DatabaseUser) (string, error) {
+	if databaseUser.Spec.PasswordSecretRef == nil {
+		if databaseUser.Spec.Password == "" {
+			return "", fmt.Errorf("Neither password nor passwordSecretRef is set")
+		}
+		return databaseUser.Spec.Password, nil
+	}
+
+	ref := databaseUser.Spec.PasswordSecretRef
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: databaseUser.Namespace, Name: ref.Name}, secret); err != nil {
+		return "", fmt.Errorf("Failed to get secret '%s': %w", ref.Name, err)
+	}
+
+	password, ok := secret.Data[ref.Key]
+	if !ok || len(password) == 0 {
+		return "", fmt.Errorf("Secret '%s' has no key '%s'", ref.Name, ref.Key)
+	}
+
+	return string(password), nil
+}
+
+// passwordDigest returns the salted HMAC-SHA256 digest of the password as "<salt>:<digest>" in hex
+func passwordDigest(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("Failed to generate salt: %w", err)
+	}
+	return hex.EncodeToString(salt) + ":" + hex.EncodeToString(passwordMAC(salt, password)), nil
+}
+
+// passwordApplied reports whether the digest was computed from the password,
+// an empty or malformed digest never matches
+func passwordApplied(digest, password string) bool {
+	encodedSalt, encodedSum, ok := strings.Cut(digest, ":")
+	if !ok {
+		return false
+	}
+	salt, err := hex.DecodeString(encodedSalt)
+	if err != nil {
+		return false
+	}
+	sum, err := hex.DecodeString(encodedSum)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(sum, passwordMAC(salt, password))
+}
+
+func passwordMAC(salt []byte, password string) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+// plan publishes the statements which would bring the user to its desired state without executing them
+func (r *DatabaseUserReconciler) plan(ctx context.Context, databaseUser *k8sv1beta1.DatabaseUser, databaseHost *k8sv1.DatabaseHost, password string) error {
+	log := log.FromContext(ctx)
+
+	var err error
+	var plan provider.Plan
+
+	switch databaseHost.Spec.Type {
+	case k8sv1.MySQL:
+		log.Info("MySQL database host")
+	case k8sv1.Postgres:
+		plan, err = planUser(ctx, r.Pools.Postgres(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit), databaseUser, password)
+	}
+
+	if err != nil {
+		r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonPlanFailed, err.Error())
+		return r.setPlannedCondition(ctx, databaseUser, nil, metav1.ConditionFalse, reasonPlanFailed, err.Error())
+	}
+
+	message := planMessage(plan)
+	r.Recorder.Event(databaseUser, corev1.EventTypeNormal, reasonDryRun, message)
+	return r.setPlannedCondition(ctx, databaseUser, plan, metav1.ConditionTrue, reasonDryRun, message)
+}
+
+// planUser plans the same statements a reconciliation of the user would execute
+func planUser(ctx context.Context, client provider.DatabaseProvider, databaseUser *k8sv1beta1.DatabaseUser, password string) (provider.Plan, error) {
+	spec := databaseUser.Spec
+
+	plan, err := client.PlanCreateUser(ctx, &spec, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(plan) == 0 && !passwordApplied(databaseUser.Status.PasswordDigest, password) {
+		passwordPlan, err := client.PlanSetPassword(ctx, spec.Username, password)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, passwordPlan...)
+	}
+
+	granted, revoked := diffPrivileges(databaseUser.Status.Privileges, spec.Privileges)
+	revokePlan, err := client.PlanRevokePrivileges(ctx, spec.Username, revoked)
+	if err != nil {
+		return nil, err
+	}
+	grantPlan, err := client.PlanGrantPrivileges(ctx, spec.Username, granted)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append(plan, revokePlan...), grantPlan...), nil
+}
+
+// finalize drops the user from its host if the deletion policy requests it.
+// A non-zero result means the drop is deferred and the finalizer has to stay.
+func (r *DatabaseUserReconciler) finalize(ctx context.Context, databaseUser *k8sv1beta1.DatabaseUser) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// a user without an applied password was never provisioned by the operator
+	if databaseUser.Spec.DeletionPolicy != k8sv1beta1.DeletionPolicyDelete || databaseUser.Status.PasswordDigest == "" {
+		return ctrl.Result{}, nil
+	}
+
+	databaseHost := &k8sv1.DatabaseHost{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: databaseUser.Namespace, Name: databaseUser.Spec.HostRef.Name}, databaseHost); err != nil {
+		if apierrors.IsNotFound(err) {
+			// without its host the user cannot be dropped anymore
+			message := fmt.Sprintf("DatabaseHost '%s' not found, user '%s' was not dropped", databaseUser.Spec.HostRef.Name, databaseUser.Spec.Username)
+			r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonHostNotFound, message)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if databaseHost.Paused() {
+		message := fmt.Sprintf("Reconciliation of DatabaseHost '%s' is paused", databaseHost.Name)
+		return ctrl.Result{RequeueAfter: hostHealthCheckInterval}, r.setPausedCondition(ctx, databaseUser, message)
+	}
+
+	hostSpec, err := resolveHostSpec(ctx, r, databaseHost)
+	if err != nil {
+		r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonCredentialsNotFound, err.Error())
+		return ctrl.Result{}, err
+	}
+	databaseHost.Spec = hostSpec
+
+	if message, wait, unavailable := hostUnavailable(r.Pools, databaseHost); unavailable {
+		log.Info("DatabaseHost is unavailable, postponing the drop", "retryAfter", wait)
+		return ctrl.Result{RequeueAfter: wait}, r.setReadyCondition(ctx, databaseUser, metav1.ConditionFalse, reasonHostUnavailable, message)
+	}
+
+	ctx = audit.WithSource(ctx, "DatabaseUser", databaseUser, databaseHost)
+	dryRun := r.DryRun || databaseUser.DryRun()
+
+	if !dryRun {
+		open, next, err := maintenance.Open(databaseHost.Spec.MaintenanceWindows, time.Now())
+		if err != nil {
+			r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonInvalidMaintenanceWindow, err.Error())
+			return ctrl.Result{}, err
+		}
+		if !open {
+			r.deferOperation(databaseUser, fmt.Sprintf("drop user '%s'", databaseUser.Spec.Username), next)
+			return ctrl.Result{RequeueAfter: time.Until(next)}, r.Status().Update(ctx, databaseUser)
+		}
+	}
+
+	var dropped bool
+
+	switch databaseHost.Spec.Type {
+	case k8sv1.MySQL:
+		log.Info("MySQL database host")
+	case k8sv1.Postgres:
+		client := r.Pools.Postgres(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit)
+		if dryRun {
+			var plan provider.Plan
+			if plan, err = client.PlanDropUser(ctx, databaseUser.Spec.Username); err == nil {
+				r.Recorder.Event(databaseUser, corev1.EventTypeNormal, reasonDryRun, planMessage(plan))
+			}
+		} else {
+			dropped, err = client.DropUser(ctx, databaseUser.Spec.Username)
+		}
+	}
+
+	if err != nil {
+		r.Recorder.Event(databaseUser, corev1.EventTypeWarning, reasonDropFailed, err.Error())
+		return ctrl.Result{}, err
+	}
+
+	if dropped {
+		r.Recorder.Eventf(databaseUser, corev1.EventTypeNormal, reasonDropped, "User '%s' successfully dropped.", databaseUser.Spec.Username)
+	}
 
 	return ctrl.Result{}, nil
 }
 
+// deferOperation queues the operation in the status of the user until the next maintenance window
+// of its host opens. The Ready condition is left alone, as the user stays usable until then.
+func (r *DatabaseUserReconciler) deferOperation(databaseUser *k8sv1beta1.DatabaseUser, operation string, next time.Time) {
+	message := fmt.Sprintf("Waiting for the maintenance window at %s to %s", next.Format(time.RFC3339), operation)
+	r.Recorder.Event(databaseUser, corev1.EventTypeNormal, reasonDeferred, message)
+
+	databaseUser.Status.PendingOperations = append(databaseUser.Status.PendingOperations, operation)
+	meta.SetStatusCondition(&databaseUser.Status.Conditions, metav1.Condition{
+		Type:               k8sv1beta1.ConditionTypeMaintenancePending,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonDeferred,
+		Message:            message,
+		ObservedGeneration: databaseUser.Generation,
+	})
+}
+
+// setPausedCondition records in the status of the user that its reconciliation is paused
+func (r *DatabaseUserReconciler) setPausedCondition(ctx context.Context, databaseUser *k8sv1beta1.DatabaseUser, message string) error {
+	meta.SetStatusCondition(&databaseUser.Status.Conditions, metav1.Condition{
+		Type:               k8sv1beta1.ConditionTypePaused,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonPaused,
+		Message:            message,
+		ObservedGeneration: databaseUser.Generation,
+	})
+
+	if err := r.Status().Update(ctx, databaseUser); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update DatabaseUser status")
+		return err
+	}
+
+	return nil
+}
+
+// setPlannedCondition records the outcome of a dry run in the status of the user
+func (r *DatabaseUserReconciler) setPlannedCondition(ctx context.Context, databaseUser *k8sv1beta1.DatabaseUser, plan provider.Plan, status metav1.ConditionStatus, reason, message string) error {
+	databaseUser.Status.ObservedGeneration = databaseUser.Generation
+	databaseUser.Status.PlannedStatements = plan.Strings()
+	meta.RemoveStatusCondition(&databaseUser.Status.Conditions, k8sv1beta1.ConditionTypePaused)
+	meta.SetStatusCondition(&databaseUser.Status.Conditions, metav1.Condition{
+		Type:               k8sv1beta1.ConditionTypePlanned,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: databaseUser.Generation,
+	})
+
+	if err := r.Status().Update(ctx, databaseUser); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update DatabaseUser status")
+		return err
+	}
+
+	return nil
+}
+
+// setReadyCondition records the outcome of the reconciliation in the status of the user
+func (r *DatabaseUserReconciler) setReadyCondition(ctx context.Context, databaseUser *k8sv1beta1.DatabaseUser, status metav1.ConditionStatus, reason, message string) error {
+	databaseUser.Status.ObservedGeneration = databaseUser.Generation
+	// a reconciliation which is not a dry run supersedes the plan of a previous one
+	databaseUser.Status.PlannedStatements = nil
+	meta.RemoveStatusCondition(&databaseUser.Status.Conditions, k8sv1beta1.ConditionTypePlanned)
+	meta.RemoveStatusCondition(&databaseUser.Status.Conditions, k8sv1beta1.ConditionTypePaused)
+	meta.SetStatusCondition(&databaseUser.Status.Conditions, metav1.Condition{
+		Type:               k8sv1beta1.ConditionTypeReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: databaseUser.Generation,
+	})
+
+	if err := r.Status().Update(ctx, databaseUser); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update DatabaseUser status")
+		return err
+	}
+
+	return nil
+}
+
+// diffPrivileges returns the privileges which have to be granted and revoked
+// to get from the applied privileges to the desired ones, sorted by their target
+// so the same change always plans the same statements
+func diffPrivileges(applied, desired []k8sv1beta1.Privilege) (granted, revoked []k8sv1beta1.Privilege) {
+	appliedSet := expandPrivileges(applied)
+	desiredSet := expandPrivileges(desired)
+
+	for _, key := range sortedKeys(desiredSet) {
+		if _, ok := appliedSet[key]; !ok {
+			granted = append(granted, desiredSet[key])
+		}
+	}
+	for _, key := range sortedKeys(appliedSet) {
+		if _, ok := desiredSet[key]; !ok {
+			revoked = append(revoked, appliedSet[key])
+		}
+	}
+
+	return granted, revoked
+}
+
+// sortedKeys returns the keys of the expanded privileges in ascending order
+func sortedKeys(privileges map[string]k8sv1beta1.Privilege) []string {
+	keys := make([]string, 0, len(privileges))
+	for key := range privileges {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// expandPrivileges splits the privileges into one entry per single privilege keyed by its target
+func expandPrivileges(privileges []k8sv1beta1.Privilege) map[string]k8sv1beta1.Privilege {
+	expanded := map[string]k8sv1beta1.Privilege{}
+	for _, privilege := range privileges {
+		for _, name := range privilege.Privileges {
+			name = strings.ToUpper(strings.TrimSpace(name))
+			key := strings.Join([]string{strings.ToLower(privilege.ObjectType), privilege.Database, privilege.ObjectName, name}, "/")
+			expanded[key] = k8sv1beta1.Privilege{
+				ObjectType: privilege.ObjectType,
+				ObjectName: privilege.ObjectName,
+				Database:   privilege.Database,
+				Privileges: []string{name},
+			}
+		}
+	}
+	return expanded
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *DatabaseUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&k8sv1alpha1.DatabaseUser{}).
-		Complete(r)
+	if err := indexHostRef(context.Background(), mgr, &k8sv1beta1.DatabaseUser{}); err != nil {
+		return err
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&k8sv1beta1.DatabaseUser{}).
+		Watches(&k8sv1.DatabaseHost{}, handler.EnqueueRequestsFromMapFunc(r.usersForHost), builder.WithPredicates(hostChanged)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.usersForPasswordSecret))
+
+	if r.Shards != nil {
+		b = b.WatchesRawSource(r.Shards.Source(&k8sv1beta1.DatabaseUserList{}, hostName), &handler.EnqueueRequestForObject{})
+	}
+
+	return b.WithOptions(r.Options).Complete(tracing.Reconciler("DatabaseUser", r))
+}
+
+// usersForHost returns the DatabaseUsers on the host, so they are reconciled once the host
+// is created or recovers instead of waiting for their next resync
+func (r *DatabaseUserReconciler) usersForHost(ctx context.Context, host client.Object) []reconcile.Request {
+	list := &k8sv1beta1.DatabaseUserList{}
+	if err := dependents(ctx, r, host, list); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list DatabaseUsers of DatabaseHost")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+	}
+	return requests
+}
+
+// usersForPasswordSecret returns the DatabaseUsers reading their password from the secret,
+// so a changed password is rotated right away instead of with the next resync
+func (r *DatabaseUserReconciler) usersForPasswordSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	users := &k8sv1beta1.DatabaseUserList{}
+	if err := r.List(ctx, users, client.InNamespace(secret.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list DatabaseUsers")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, user := range users.Items {
+		if ref := user.Spec.PasswordSecretRef; ref != nil && ref.Name == secret.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&user)})
+		}
+	}
+	return requests
 }
@@ -18,16 +18,27 @@ package controller
 
 import (
 	"context"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	k8sv1alpha1 "github.com/tuunit/external-database-operator/api/v1alpha1"
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/audit"
+	"github.com/tuunit/external-database-operator/internal/provider"
 )
 
 var _ = Describe("DatabaseUser Controller", func() {
@@ -40,13 +51,13 @@ var _ = Describe("DatabaseUser Controller", func() {
 			Name:      resourceName,
 			Namespace: "default", // TODO(user):Modify as needed
 		}
-		databaseuser := &k8sv1alpha1.DatabaseUser{}
+		databaseuser := &k8sv1beta1.DatabaseUser{}
 
 		BeforeEach(func() {
 			By("creating the custom resource for the Kind DatabaseUser")
 			err := k8sClient.Get(ctx, typeNamespacedName, databaseuser)
 			if err != nil && errors.IsNotFound(err) {
-				resource := &k8sv1alpha1.DatabaseUser{
+				resource := &k8sv1beta1.DatabaseUser{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      resourceName,
 						Namespace: "default",
@@ -59,7 +70,7 @@ var _ = Describe("DatabaseUser Controller", func() {
 
 		AfterEach(func() {
 			// TODO(user): Cleanup logic after each test, like removing the resource instance.
-			resource := &k8sv1alpha1.DatabaseUser{}
+			resource := &k8sv1beta1.DatabaseUser{}
 			err := k8sClient.Get(ctx, typeNamespacedName, resource)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -69,8 +80,9 @@ var _ = Describe("DatabaseUser Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &DatabaseUserReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -82,3 +94,281 @@ var _ = Describe("DatabaseUser Controller", func() {
 		})
 	})
 })
+
+var _ = Describe("DatabaseUser without a host", func() {
+	It("should report the missing hostRef without adding the finalizer", func() {
+		ctx := context.Background()
+		databaseUser := &k8sv1beta1.DatabaseUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "default"},
+			Spec:       k8sv1beta1.DatabaseUserSpec{Username: "legacy", Password: "hunter2"},
+		}
+		c := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(databaseUser).
+			WithObjects(databaseUser).
+			WithInterceptorFuncs(interceptor.Funcs{
+				// the API server rejects every update of the spec with an empty hostRef
+				Update: func(context.Context, client.WithWatch, client.Object, ...client.UpdateOption) error {
+					return errors.NewInvalid(k8sv1beta1.GroupVersion.WithKind("DatabaseUser").GroupKind(), "legacy", nil)
+				},
+			}).
+			Build()
+		controllerReconciler := &DatabaseUserReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(10)}
+
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: "legacy", Namespace: "default"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, types.NamespacedName{Name: "legacy", Namespace: "default"}, databaseUser)).To(Succeed())
+		Expect(databaseUser.Finalizers).To(BeEmpty())
+		condition := meta.FindStatusCondition(databaseUser.Status.Conditions, k8sv1beta1.ConditionTypeReady)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal(reasonHostRefNotSet))
+	})
+})
+
+var _ = Describe("DatabaseUser privileges", func() {
+	It("should grant added and revoke removed privileges", func() {
+		applied := []k8sv1beta1.Privilege{{
+			ObjectType: "database",
+			ObjectName: "app",
+			Privileges: []string{"CONNECT", "TEMPORARY"},
+		}}
+		desired := []k8sv1beta1.Privilege{{
+			ObjectType: "database",
+			ObjectName: "app",
+			Privileges: []string{"connect", "CREATE"},
+		}}
+
+		granted, revoked := diffPrivileges(applied, desired)
+		Expect(granted).To(ConsistOf(k8sv1beta1.Privilege{
+			ObjectType: "database",
+			ObjectName: "app",
+			Privileges: []string{"CREATE"},
+		}))
+		Expect(revoked).To(ConsistOf(k8sv1beta1.Privilege{
+			ObjectType: "database",
+			ObjectName: "app",
+			Privileges: []string{"TEMPORARY"},
+		}))
+	})
+
+	It("should plan the privileges in a stable order", func() {
+		desired := []k8sv1beta1.Privilege{
+			{ObjectType: "table", Database: "app", ObjectName: "orders", Privileges: []string{"UPDATE", "SELECT", "INSERT"}},
+			{ObjectType: "database", ObjectName: "app", Privileges: []string{"TEMPORARY", "CONNECT"}},
+			{ObjectType: "schema", Database: "app", ObjectName: "public", Privileges: []string{"USAGE"}},
+		}
+
+		granted, _ := diffPrivileges(nil, desired)
+		Expect(granted).To(Equal([]k8sv1beta1.Privilege{
+			{ObjectType: "database", ObjectName: "app", Privileges: []string{"CONNECT"}},
+			{ObjectType: "database", ObjectName: "app", Privileges: []string{"TEMPORARY"}},
+			{ObjectType: "schema", Database: "app", ObjectName: "public", Privileges: []string{"USAGE"}},
+			{ObjectType: "table", Database: "app", ObjectName: "orders", Privileges: []string{"INSERT"}},
+			{ObjectType: "table", Database: "app", ObjectName: "orders", Privileges: []string{"SELECT"}},
+			{ObjectType: "table", Database: "app", ObjectName: "orders", Privileges: []string{"UPDATE"}},
+		}))
+
+		for i := 0; i < 10; i++ {
+			again, revoked := diffPrivileges(desired, nil)
+			Expect(again).To(BeEmpty())
+			Expect(revoked).To(Equal(granted))
+		}
+	})
+})
+
+// existingUserProvider plans like PostgreSQL for a host on which every user already exists
+type existingUserProvider struct {
+	*provider.PostgreSQL
+}
+
+func (p existingUserProvider) PlanCreateUser(context.Context, *k8sv1beta1.DatabaseUserSpec, string) (provider.Plan, error) {
+	return nil, nil
+}
+
+var _ = Describe("DatabaseUser dry run", func() {
+	It("should plan the password rotation and the changed privileges", func() {
+		databaseUser := &k8sv1beta1.DatabaseUser{
+			Spec: k8sv1beta1.DatabaseUserSpec{
+				Username: "alice",
+				Privileges: []k8sv1beta1.Privilege{{
+					ObjectType: "database",
+					ObjectName: "app",
+					Privileges: []string{"CONNECT"},
+				}},
+			},
+			Status: k8sv1beta1.DatabaseUserStatus{PasswordDigest: "outdated"},
+		}
+
+		client := existingUserProvider{provider.NewPostgresClient(k8sv1.DatabaseHostSpec{Type: k8sv1.Postgres}, nil)}
+		plan, err := planUser(context.Background(), client, databaseUser, "hunter2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Strings()).To(Equal([]string{
+			`ALTER ROLE "alice" WITH PASSWORD ` + audit.Redacted,
+			`GRANT CONNECT ON DATABASE "app" TO "alice"`,
+		}))
+		Expect(planMessage(plan)).NotTo(ContainSubstring("hunter2"))
+	})
+})
+
+var _ = Describe("DatabaseUser password", func() {
+	ctx := context.Background()
+
+	It("should detect a changed password by its salted digest", func() {
+		digest, err := passwordDigest("hunter2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(digest).NotTo(ContainSubstring("hunter2"))
+		Expect(passwordApplied(digest, "hunter2")).To(BeTrue())
+		Expect(passwordApplied(digest, "correct horse")).To(BeFalse())
+		Expect(passwordApplied("", "hunter2")).To(BeFalse())
+
+		again, err := passwordDigest("hunter2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).NotTo(Equal(digest))
+	})
+
+	It("should read the password from the referenced secret", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "default"},
+			Data:       map[string][]byte{"password": []byte("hunter2")},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build()
+		controllerReconciler := &DatabaseUserReconciler{Client: c}
+
+		databaseUser := &k8sv1beta1.DatabaseUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "default"},
+			Spec: k8sv1beta1.DatabaseUserSpec{
+				PasswordSecretRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "alice"},
+					Key:                  "password",
+				},
+			},
+		}
+		password, err := controllerReconciler.password(ctx, databaseUser)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(password).To(Equal("hunter2"))
+	})
+
+	It("should reconcile the users reading their password from a changed secret", func() {
+		alice := &k8sv1beta1.DatabaseUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "default"},
+			Spec: k8sv1beta1.DatabaseUserSpec{
+				PasswordSecretRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "credentials"},
+					Key:                  "alice",
+				},
+			},
+		}
+		bob := &k8sv1beta1.DatabaseUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "bob", Namespace: "default"},
+			Spec:       k8sv1beta1.DatabaseUserSpec{Password: "hunter2"},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(alice, bob).Build()
+		controllerReconciler := &DatabaseUserReconciler{Client: c}
+
+		Expect(controllerReconciler.usersForPasswordSecret(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"}})).
+			To(ConsistOf(reconcile.Request{NamespacedName: types.NamespacedName{Name: "alice", Namespace: "default"}}))
+		Expect(controllerReconciler.usersForPasswordSecret(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "other"}})).
+			To(BeEmpty())
+	})
+})
+
+var _ = Describe("DatabaseUser on a MySQL host", func() {
+	It("should report the host type as unsupported", func() {
+		ctx := context.Background()
+		databaseUser := &k8sv1beta1.DatabaseUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "default"},
+			Spec: k8sv1beta1.DatabaseUserSpec{
+				Username: "alice",
+				Password: "hunter2",
+				HostRef:  k8sv1beta1.DatabaseHostReference{Name: "mysql"},
+			},
+		}
+		host := &k8sv1.DatabaseHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "mysql", Namespace: "default"},
+			Spec:       k8sv1.DatabaseHostSpec{Host: "mysql.example.com", Type: k8sv1.MySQL, Superuser: "root"},
+		}
+		c := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(databaseUser).
+			WithObjects(databaseUser, host).
+			Build()
+		recorder := record.NewFakeRecorder(10)
+		controllerReconciler := &DatabaseUserReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder}
+
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: "alice", Namespace: "default"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(ContainSubstring(reasonUnsupportedHostType)))
+
+		Expect(c.Get(ctx, types.NamespacedName{Name: "alice", Namespace: "default"}, databaseUser)).To(Succeed())
+		Expect(meta.IsStatusConditionFalse(databaseUser.Status.Conditions, k8sv1beta1.ConditionTypeReady)).To(BeTrue())
+		Expect(meta.FindStatusCondition(databaseUser.Status.Conditions, k8sv1beta1.ConditionTypeReady).Reason).To(Equal(reasonUnsupportedHostType))
+		Expect(databaseUser.Status.PasswordDigest).To(BeEmpty())
+	})
+})
+
+var _ = Describe("DatabaseUser deletion", func() {
+	ctx := context.Background()
+
+	deleted := func(policy k8sv1beta1.DeletionPolicy) (*k8sv1beta1.DatabaseUser, *k8sv1.DatabaseHost) {
+		databaseUser := &k8sv1beta1.DatabaseUser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "alice",
+				Namespace:  "default",
+				Finalizers: []string{"k8s.tuunit.com/finalizer"},
+			},
+			Spec: k8sv1beta1.DatabaseUserSpec{
+				Username:       "alice",
+				HostRef:        k8sv1beta1.DatabaseHostReference{Name: "postgres"},
+				DeletionPolicy: policy,
+			},
+			Status: k8sv1beta1.DatabaseUserStatus{PasswordDigest: "00:00"},
+		}
+		host := &k8sv1.DatabaseHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "postgres", Namespace: "default"},
+			Spec: k8sv1.DatabaseHostSpec{
+				Host:      "127.0.0.1",
+				Port:      1,
+				Type:      k8sv1.Postgres,
+				Superuser: "postgres",
+				MaintenanceWindows: []k8sv1.MaintenanceWindow{{
+					Schedule: "0 0 1 1 *",
+					Duration: metav1.Duration{Duration: time.Minute},
+				}},
+			},
+		}
+		return databaseUser, host
+	}
+
+	It("should keep the user on the host with the Retain policy", func() {
+		databaseUser, host := deleted(k8sv1beta1.DeletionPolicyRetain)
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(databaseUser, host).Build()
+		Expect(c.Delete(ctx, databaseUser)).To(Succeed())
+		controllerReconciler := &DatabaseUserReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(10)}
+
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: "alice", Namespace: "default"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(errors.IsNotFound(c.Get(ctx, types.NamespacedName{Name: "alice", Namespace: "default"}, databaseUser))).To(BeTrue())
+	})
+
+	It("should drop the user in the maintenance window with the Delete policy", func() {
+		databaseUser, host := deleted(k8sv1beta1.DeletionPolicyDelete)
+		c := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(databaseUser).
+			WithObjects(databaseUser, host).
+			Build()
+		Expect(c.Delete(ctx, databaseUser)).To(Succeed())
+		recorder := record.NewFakeRecorder(10)
+		controllerReconciler := &DatabaseUserReconciler{Client: c, Scheme: c.Scheme(), Recorder: recorder}
+
+		result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: "alice", Namespace: "default"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(recorder.Events).To(Receive(ContainSubstring(reasonDeferred)))
+
+		Expect(c.Get(ctx, types.NamespacedName{Name: "alice", Namespace: "default"}, databaseUser)).To(Succeed())
+		Expect(databaseUser.Finalizers).To(ContainElement("k8s.tuunit.com/finalizer"))
+		Expect(databaseUser.Status.PendingOperations).To(ConsistOf("drop user 'alice'"))
+	})
+})
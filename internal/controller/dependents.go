@@ -0,0 +1,109 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+// hostRefField is the field index of Databases and DatabaseUsers by the name of their DatabaseHost
+const hostRefField = ".spec.hostRef.name"
+
+// indexHostRef registers the hostRefField index for Databases and DatabaseUsers
+func indexHostRef(ctx context.Context, mgr ctrl.Manager, obj client.Object) error {
+	return mgr.GetFieldIndexer().IndexField(ctx, obj, hostRefField, hostRef)
+}
+
+// hostRef extracts the value of the hostRefField index
+func hostRef(obj client.Object) []string {
+	switch obj := obj.(type) {
+	case *k8sv1beta1.Database:
+		return []string{obj.Spec.HostRef.Name}
+	case *k8sv1beta1.DatabaseUser:
+		return []string{obj.Spec.HostRef.Name}
+	}
+	return nil
+}
+
+// hostName returns the name of the host of a Database or DatabaseUser
+func hostName(obj client.Object) string {
+	if names := hostRef(obj); len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+// hostOf returns the host of a Database or DatabaseUser
+func hostOf(_ context.Context, obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+	for _, name := range hostRef(obj) {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}})
+	}
+	return requests
+}
+
+// dependents lists the objects referencing the host through their hostRef
+func dependents(ctx context.Context, c client.Reader, host client.Object, list client.ObjectList) error {
+	return c.List(ctx, list, client.InNamespace(host.GetNamespace()), client.MatchingFields{hostRefField: host.GetName()})
+}
+
+// hostChanged lets through the events of hosts which may unblock their dependents: the creation
+// and deletion of a host, changes to its spec or annotations and changes of its connection status.
+// The periodic health checks of a host only update its last connection time and are filtered out.
+var hostChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldHost, ok := e.ObjectOld.(*k8sv1.DatabaseHost)
+		if !ok {
+			return false
+		}
+		newHost, ok := e.ObjectNew.(*k8sv1.DatabaseHost)
+		if !ok {
+			return false
+		}
+
+		return oldHost.Generation != newHost.Generation ||
+			!equality.Semantic.DeepEqual(oldHost.Annotations, newHost.Annotations) ||
+			oldHost.Status.ConnectionStatus != newHost.Status.ConnectionStatus
+	},
+	GenericFunc: func(event.GenericEvent) bool {
+		return false
+	},
+}
+
+// dependentDeleted only lets through the deletion of dependents, which may unblock the deletion of their host
+var dependentDeleted = predicate.Funcs{
+	CreateFunc: func(event.CreateEvent) bool {
+		return false
+	},
+	UpdateFunc: func(event.UpdateEvent) bool {
+		return false
+	},
+	GenericFunc: func(event.GenericEvent) bool {
+		return false
+	},
+}
@@ -0,0 +1,31 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+
+	"github.com/tuunit/external-database-operator/internal/provider"
+)
+
+// planMessage describes the statements a dry run would have executed
+func planMessage(plan provider.Plan) string {
+	if len(plan) == 0 {
+		return "Dry run, nothing to execute."
+	}
+	return "Dry run, would execute: " + strings.Join(plan.Strings(), "; ")
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+// Reasons used for the events and conditions reported by the reconcilers
+const (
+	reasonConnectionSucceeded = "ConnectionSucceeded"
+	reasonConnectionFailed    = "ConnectionFailed"
+	reasonUnsupportedType     = "UnsupportedType"
+	reasonHostRefNotSet       = "HostRefNotSet"
+	reasonHostNotFound        = "HostNotFound"
+	reasonCredentialsNotFound = "CredentialsNotFound"
+	reasonHostUnavailable     = "HostUnavailable"
+	reasonServerDiscovered    = "ServerDiscovered"
+	reasonDiscoveryFailed     = "DiscoveryFailed"
+	reasonUnsupportedHostType = "UnsupportedHostType"
+
+	reasonCreated          = "Created"
+	reasonCreateFailed     = "CreateFailed"
+	reasonAdopted          = "Adopted"
+	reasonRenamed          = "Renamed"
+	reasonRenameFailed     = "RenameFailed"
+	reasonRenameNotAllowed = "RenameNotAllowed"
+	reasonDropped          = "Dropped"
+	reasonDropFailed       = "DropFailed"
+
+	reasonUnsupportedLocale = "UnsupportedLocale"
+
+	reasonPasswordNotFound = "PasswordNotFound"
+	reasonPasswordRotated  = "PasswordRotated"
+	reasonPasswordFailed   = "PasswordFailed"
+	reasonGrantsChanged    = "GrantsChanged"
+	reasonGrantsFailed     = "GrantsFailed"
+
+	reasonDryRun     = "DryRun"
+	reasonPlanFailed = "PlanFailed"
+
+	reasonPaused                   = "Paused"
+	reasonDeferred                 = "Deferred"
+	reasonInvalidMaintenanceWindow = "InvalidMaintenanceWindow"
+
+	reasonDeletionBlocked = "DeletionBlocked"
+	reasonCascading       = "Cascading"
+
+	reasonDatabaseNotFound = "DatabaseNotFound"
+	reasonDatabaseNotReady = "DatabaseNotReady"
+	reasonDatabaseReady    = "DatabaseReady"
+	reasonBackupStarted    = "BackupStarted"
+	reasonBackupRunning    = "BackupRunning"
+	reasonBackupSucceeded  = "BackupSucceeded"
+	reasonBackupFailed     = "BackupFailed"
+	reasonDumpRemoved      = "DumpRemoved"
+	reasonCleanupFailed    = "CleanupFailed"
+	reasonScheduled        = "Scheduled"
+	reasonInvalidSchedule  = "InvalidSchedule"
+
+	reasonBackupNotFound   = "BackupNotFound"
+	reasonTargetNotEmpty   = "TargetNotEmpty"
+	reasonTypeMismatch     = "TypeMismatch"
+	reasonOwnerNotSet      = "OwnerNotSet"
+	reasonRestoreStarted   = "RestoreStarted"
+	reasonRestoreRunning   = "RestoreRunning"
+	reasonRestoreSucceeded = "RestoreSucceeded"
+	reasonRestoreFailed    = "RestoreFailed"
+
+	reasonCloning     = "Cloning"
+	reasonCloned      = "Cloned"
+	reasonCloneFailed = "CloneFailed"
+
+	reasonExpired       = "Expired"
+	reasonInvalidExpiry = "InvalidExpiry"
+
+	reasonInitScriptApplied = "InitScriptApplied"
+	reasonInitScriptFailed  = "InitScriptFailed"
+
+	reasonMigrationsNotFound = "MigrationsNotFound"
+	reasonInvalidMigrations  = "InvalidMigrations"
+	reasonMigrating          = "Migrating"
+	reasonMigrated           = "Migrated"
+	reasonMigrationFailed    = "MigrationFailed"
+	reasonMigrationLocked    = "MigrationLocked"
+)
@@ -0,0 +1,72 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+// expiry returns the time the Database is deleted at, the zero time if it does not expire.
+// In namespaces labeled as ephemeral the lifetime is capped to MaxEphemeralTTL,
+// which also applies to Databases without a TTL of their own.
+func (r *DatabaseReconciler) expiry(ctx context.Context, database *k8sv1beta1.Database) (time.Time, error) {
+	expiry, err := database.Expiry()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if r.MaxEphemeralTTL <= 0 {
+		return expiry, nil
+	}
+
+	// Namespaces are cluster-scoped, reading them through the cache would watch all of them
+	namespace := &corev1.Namespace{}
+	if err := r.APIReader.Get(ctx, client.ObjectKey{Name: database.Namespace}, namespace); err != nil {
+		return time.Time{}, fmt.Errorf("Failed to get namespace '%s': %w", database.Namespace, err)
+	}
+	if namespace.Labels[k8sv1beta1.LabelEphemeral] != "true" {
+		return expiry, nil
+	}
+
+	limit := database.CreationTimestamp.Add(r.MaxEphemeralTTL)
+	if expiry.IsZero() || expiry.After(limit) {
+		return limit, nil
+	}
+	return expiry, nil
+}
+
+// requeueBefore makes sure the object is reconciled again at the given time at the latest
+func requeueBefore(result ctrl.Result, err error, at time.Time) ctrl.Result {
+	if err != nil || (result.Requeue && result.RequeueAfter == 0) {
+		return result
+	}
+
+	wait := time.Until(at)
+	if result.RequeueAfter == 0 || result.RequeueAfter > wait {
+		// a requeue of zero would be ignored, the next reconcile deletes the expired object
+		result.RequeueAfter = max(wait, time.Second)
+	}
+	return result
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/provider"
+)
+
+// initScript is an init script of a database with its content and the checksum of the content
+type initScript struct {
+	provider.Script
+	checksum string
+}
+
+// runInitScripts executes the pending init scripts of the database in order as its owner
+// and records them in its status. It stops at the first failing script, so the following
+// ones never run before the scripts they may depend on.
+func (r *DatabaseReconciler) runInitScripts(ctx context.Context, database *k8sv1beta1.Database, client provider.DatabaseProvider) error {
+	scripts, err := r.pendingInitScripts(ctx, database)
+	if err != nil {
+		return err
+	}
+
+	for _, script := range scripts {
+		if err := client.RunScript(ctx, database.Status.Name, database.Spec.Owner, script.Script); err != nil {
+			return fmt.Errorf("Init script '%s' failed: %w", script.Name, err)
+		}
+
+		setInitScriptStatus(database, k8sv1beta1.InitScriptStatus{Name: script.Name, Checksum: script.checksum, AppliedAt: metav1.Now()})
+		r.Recorder.Event(database, corev1.EventTypeNormal, reasonInitScriptApplied, fmt.Sprintf("Init script '%s' executed", script.Name))
+	}
+
+	return nil
+}
+
+// planInitScripts plans the execution of the pending init scripts of the database
+func (r *DatabaseReconciler) planInitScripts(ctx context.Context, database *k8sv1beta1.Database, client provider.DatabaseProvider) (provider.Plan, error) {
+	scripts, err := r.pendingInitScripts(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan provider.Plan
+	for _, script := range scripts {
+		statements, err := client.PlanRunScript(ctx, database.Status.Name, database.Spec.Owner, script.Script)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, statements...)
+	}
+	return plan, nil
+}
+
+// pendingInitScripts returns the init scripts which have not been executed yet and, with the
+// runPolicy OnChange, the ones whose content changed since. The status of scripts which were
+// removed from the spec is dropped, so they run again when they are added back.
+func (r *DatabaseReconciler) pendingInitScripts(ctx context.Context, database *k8sv1beta1.Database) ([]initScript, error) {
+	applied := map[string]k8sv1beta1.InitScriptStatus{}
+	for _, status := range database.Status.InitScripts {
+		applied[status.Name] = status
+	}
+
+	var statuses []k8sv1beta1.InitScriptStatus
+	var pending []initScript
+	for _, script := range database.Spec.InitScripts {
+		status, ok := applied[script.Name]
+		if ok {
+			statuses = append(statuses, status)
+		}
+		// a script which only runs once is not even loaded again, its source may be gone by now
+		if ok && script.RunPolicy != k8sv1beta1.InitScriptRunOnChange {
+			continue
+		}
+
+		content, err := r.initScriptContent(ctx, database.Namespace, script)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256([]byte(content))
+		checksum := hex.EncodeToString(sum[:])
+		if ok && status.Checksum == checksum {
+			continue
+		}
+
+		pending = append(pending, initScript{
+			Script:   provider.Script{Name: script.Name, Content: content, Sensitive: script.SecretKeyRef != nil},
+			checksum: checksum,
+		})
+	}
+	database.Status.InitScripts = statuses
+
+	return pending, nil
+}
+
+// initScriptContent reads the content of the init script from its ConfigMap or secret
+func (r *DatabaseReconciler) initScriptContent(ctx context.Context, namespace string, script k8sv1beta1.InitScript) (string, error) {
+	if ref := script.ConfigMapKeyRef; ref != nil {
+		configMap := &corev1.ConfigMap{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, configMap); err != nil {
+			return "", fmt.Errorf("Failed to get ConfigMap '%s' of init script '%s': %w", ref.Name, script.Name, err)
+		}
+
+		content, ok := configMap.Data[ref.Key]
+		if !ok {
+			return "", fmt.Errorf("ConfigMap '%s' has no key '%s'", ref.Name, ref.Key)
+		}
+		return content, nil
+	}
+
+	if ref := script.SecretKeyRef; ref != nil {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+			return "", fmt.Errorf("Failed to get secret '%s' of init script '%s': %w", ref.Name, script.Name, err)
+		}
+
+		content, ok := secret.Data[ref.Key]
+		if !ok {
+			return "", fmt.Errorf("Secret '%s' has no key '%s'", ref.Name, ref.Key)
+		}
+		return string(content), nil
+	}
+
+	return "", fmt.Errorf("Init script '%s' references neither a ConfigMap nor a secret", script.Name)
+}
+
+// setInitScriptStatus records the execution of an init script in the status of the database
+func setInitScriptStatus(database *k8sv1beta1.Database, status k8sv1beta1.InitScriptStatus) {
+	for i := range database.Status.InitScripts {
+		if database.Status.InitScripts[i].Name == status.Name {
+			database.Status.InitScripts[i] = status
+			return
+		}
+	}
+	database.Status.InitScripts = append(database.Status.InitScripts, status)
+}
+
+// databasesForScriptSource returns the Databases with an init script in the ConfigMap or secret,
+// so scripts with the runPolicy OnChange run right after their source changed
+func (r *DatabaseReconciler) databasesForScriptSource(ctx context.Context, obj client.Object) []reconcile.Request {
+	databases := &k8sv1beta1.DatabaseList{}
+	if err := r.List(ctx, databases, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list Databases")
+		return nil
+	}
+
+	_, isConfigMap := obj.(*corev1.ConfigMap)
+
+	var requests []reconcile.Request
+	for _, database := range databases.Items {
+		for _, script := range database.Spec.InitScripts {
+			if isConfigMap && script.ConfigMapKeyRef != nil && script.ConfigMapKeyRef.Name == obj.GetName() ||
+				!isConfigMap && script.SecretKeyRef != nil && script.SecretKeyRef.Name == obj.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&database)})
+				break
+			}
+		}
+	}
+	return requests
+}
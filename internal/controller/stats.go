@@ -0,0 +1,97 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/metrics"
+	"github.com/tuunit/external-database-operator/internal/provider"
+)
+
+// collectStats publishes the size and the activity of the database in its status and as metrics.
+// The stats are collected at most once per databaseStatsInterval, so other reconciles of the
+// database do not update its status. Failures are only logged. It returns when the stats are due next.
+func (r *DatabaseReconciler) collectStats(ctx context.Context, database *k8sv1beta1.Database, databaseHost *k8sv1.DatabaseHost) time.Duration {
+	if stats := database.Status.Stats; stats != nil {
+		if wait := time.Until(stats.CollectedAt.Add(databaseStatsInterval)); wait > 0 {
+			return wait
+		}
+	}
+
+	var stats provider.Stats
+	var err error
+	switch databaseHost.Spec.Type {
+	case k8sv1.MySQL:
+		stats, err = r.Pools.MySQL(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit).DatabaseStats(ctx, database.Status.Name)
+	case k8sv1.Postgres:
+		stats, err = r.Pools.Postgres(client.ObjectKeyFromObject(databaseHost), databaseHost.Spec, r.Audit).DatabaseStats(ctx, database.Status.Name)
+	}
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to collect database stats")
+		return databaseStatsInterval
+	}
+
+	database.Status.Stats = &k8sv1beta1.DatabaseStats{
+		SizeBytes:   stats.SizeBytes,
+		Size:        formatBytes(stats.SizeBytes),
+		Connections: stats.Connections,
+		Commits:     stats.Commits,
+		Deadlocks:   stats.Deadlocks,
+		CollectedAt: metav1.Now(),
+	}
+
+	// drop the series of a previous name after a rename
+	metrics.ForgetDatabase(database.Namespace, database.Name)
+	labels := []string{database.Namespace, database.Name, database.Spec.HostRef.Name, database.Status.Name}
+	metrics.DatabaseSize.WithLabelValues(labels...).Set(float64(stats.SizeBytes))
+	metrics.DatabaseConnections.WithLabelValues(labels...).Set(float64(stats.Connections))
+	if stats.Commits != nil {
+		metrics.DatabaseCommits.WithLabelValues(labels...).Set(float64(*stats.Commits))
+	}
+	if stats.Deadlocks != nil {
+		metrics.DatabaseDeadlocks.WithLabelValues(labels...).Set(float64(*stats.Deadlocks))
+	}
+
+	return databaseStatsInterval
+}
+
+// formatBytes formats a size in bytes with binary units like "12.3Mi"
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d", bytes)
+	}
+
+	value := float64(bytes)
+	var suffix string
+	for _, suffix = range []string{"Ki", "Mi", "Gi", "Ti", "Pi"} {
+		value /= unit
+		if value < unit {
+			break
+		}
+	}
+	return fmt.Sprintf("%.1f%s", value, suffix)
+}
@@ -34,6 +34,7 @@ import (
 
 	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
 	k8sv1alpha1 "github.com/tuunit/external-database-operator/api/v1alpha1"
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -79,6 +80,9 @@ var _ = BeforeSuite(func() {
 	err = k8sv1alpha1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = k8sv1beta1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:scheme
 
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
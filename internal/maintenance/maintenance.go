@@ -0,0 +1,53 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package maintenance evaluates the maintenance windows of database hosts,
+// which restrict when destructive or heavy operations may be executed.
+package maintenance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+)
+
+// Open reports whether one of the windows is open at now. If none is open, it also returns
+// the start of the next window. Without any windows maintenance is always allowed.
+func Open(windows []k8sv1.MaintenanceWindow, now time.Time) (bool, time.Time, error) {
+	var next time.Time
+
+	for _, window := range windows {
+		schedule, err := cron.ParseStandard(window.Schedule)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("Invalid maintenance window schedule '%s': %w", window.Schedule, err)
+		}
+
+		// the earliest start of a window which has not ended yet
+		start := schedule.Next(now.Add(-window.Duration.Duration))
+		if !start.After(now) {
+			return true, time.Time{}, nil
+		}
+
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+
+	return len(windows) == 0, next, nil
+}
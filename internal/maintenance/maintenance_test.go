@@ -0,0 +1,76 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package maintenance
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+)
+
+var _ = Describe("Maintenance windows", func() {
+	// every day from 02:00 to 04:00 and on sundays from 12:00 to 13:00
+	windows := []k8sv1.MaintenanceWindow{
+		{Schedule: "0 2 * * *", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+		{Schedule: "0 12 * * SUN", Duration: metav1.Duration{Duration: time.Hour}},
+	}
+
+	at := func(value string) time.Time {
+		t, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+		Expect(err).NotTo(HaveOccurred())
+		return t
+	}
+
+	It("should always allow maintenance without windows", func() {
+		open, next, err := Open(nil, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(open).To(BeTrue())
+		Expect(next.IsZero()).To(BeTrue())
+	})
+
+	It("should be open within a window", func() {
+		open, _, err := Open(windows, at("2024-03-05 03:30"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(open).To(BeTrue())
+
+		open, _, err = Open(windows, at("2024-03-10 12:00"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(open).To(BeTrue())
+	})
+
+	It("should return the start of the next window outside of a window", func() {
+		open, next, err := Open(windows, at("2024-03-05 04:00"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(open).To(BeFalse())
+		Expect(next).To(Equal(at("2024-03-06 02:00")))
+
+		// 2024-03-10 is a sunday
+		open, next, err = Open(windows, at("2024-03-10 04:30"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(open).To(BeFalse())
+		Expect(next).To(Equal(at("2024-03-10 12:00")))
+	})
+
+	It("should reject invalid schedules", func() {
+		_, _, err := Open([]k8sv1.MaintenanceWindow{{Schedule: "every night"}}, time.Now())
+		Expect(err).To(MatchError(ContainSubstring("Invalid maintenance window schedule")))
+	})
+})
@@ -0,0 +1,101 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+var (
+	hostDatabasesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "host", "databases"),
+		"Number of Database objects managed on the database host.",
+		[]string{"namespace", "host"}, nil,
+	)
+	hostUsersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "host", "users"),
+		"Number of DatabaseUser objects managed on the database host.",
+		[]string{"namespace", "host"}, nil,
+	)
+)
+
+// hostKey identifies a DatabaseHost
+type hostKey struct {
+	namespace string
+	name      string
+}
+
+// ManagedCollector counts the databases and users managed per host at scrape time
+type ManagedCollector struct {
+	client.Reader
+	Timeout time.Duration
+}
+
+// NewManagedCollector returns a collector listing the managed objects through reader,
+// which should be backed by the cache of the manager
+func NewManagedCollector(reader client.Reader) *ManagedCollector {
+	return &ManagedCollector{Reader: reader, Timeout: 5 * time.Second}
+}
+
+var _ prometheus.Collector = &ManagedCollector{}
+
+// Describe implements prometheus.Collector
+func (c *ManagedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hostDatabasesDesc
+	ch <- hostUsersDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *ManagedCollector) Collect(ch chan<- prometheus.Metric) {
+	log := logf.Log.WithName("metrics")
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	databases := &k8sv1beta1.DatabaseList{}
+	if err := c.List(ctx, databases); err != nil {
+		log.Error(err, "unable to list Databases")
+	} else {
+		counts := map[hostKey]int{}
+		for _, database := range databases.Items {
+			counts[hostKey{database.Namespace, database.Spec.HostRef.Name}]++
+		}
+		for key, count := range counts {
+			ch <- prometheus.MustNewConstMetric(hostDatabasesDesc, prometheus.GaugeValue, float64(count), key.namespace, key.name)
+		}
+	}
+
+	databaseUsers := &k8sv1beta1.DatabaseUserList{}
+	if err := c.List(ctx, databaseUsers); err != nil {
+		log.Error(err, "unable to list DatabaseUsers")
+	} else {
+		counts := map[hostKey]int{}
+		for _, databaseUser := range databaseUsers.Items {
+			counts[hostKey{databaseUser.Namespace, databaseUser.Spec.HostRef.Name}]++
+		}
+		for key, count := range counts {
+			ch <- prometheus.MustNewConstMetric(hostUsersDesc, prometheus.GaugeValue, float64(count), key.namespace, key.name)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics contains the custom Prometheus collectors of the operator.
+// All collectors are registered with the controller-runtime registry and
+// served on the metrics endpoint of the manager.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "external_database"
+
+const (
+	// OutcomeSuccess labels provider operations which succeeded
+	OutcomeSuccess = "success"
+	// OutcomeError labels provider operations which failed
+	OutcomeError = "error"
+)
+
+var (
+	// HostUp reports whether the last connection check of a host succeeded
+	HostUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "host",
+		Name:      "up",
+		Help:      "Whether the last connection check of the database host succeeded (1) or failed (0).",
+	}, []string{"namespace", "host", "engine"})
+
+	// HostConnectionCheckDuration observes the latency of the connection checks of a host
+	HostConnectionCheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "host",
+		Name:      "connection_check_duration_seconds",
+		Help:      "Latency of the connection checks against the database host.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"namespace", "host", "engine"})
+
+	// ProviderOperations counts the operations executed against database hosts
+	ProviderOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "provider",
+		Name:      "operations_total",
+		Help:      "Number of operations executed against database hosts by operation and outcome.",
+	}, []string{"engine", "operation", "outcome"})
+
+	// ProviderOperationDuration observes the duration of the operations executed against database hosts
+	ProviderOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "provider",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of the operations executed against database hosts by operation and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"engine", "operation", "outcome"})
+
+	// DatabaseSize reports the size of a database on its host
+	DatabaseSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "database",
+		Name:      "size_bytes",
+		Help:      "Size of the database on its host in bytes.",
+	}, []string{"namespace", "name", "host", "database"})
+
+	// DatabaseConnections reports the number of sessions connected to a database
+	DatabaseConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "database",
+		Name:      "connections",
+		Help:      "Number of sessions connected to the database.",
+	}, []string{"namespace", "name", "host", "database"})
+
+	// DatabaseCommits reports the number of transactions committed in a database as counted by its host
+	DatabaseCommits = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "database",
+		Name:      "transactions_committed",
+		Help:      "Number of transactions committed in the database since the statistics of its host were reset.",
+	}, []string{"namespace", "name", "host", "database"})
+
+	// DatabaseDeadlocks reports the number of deadlocks in a database as counted by its host
+	DatabaseDeadlocks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "database",
+		Name:      "deadlocks",
+		Help:      "Number of deadlocks in the database since the statistics of its host were reset.",
+	}, []string{"namespace", "name", "host", "database"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		HostUp,
+		HostConnectionCheckDuration,
+		ProviderOperations,
+		ProviderOperationDuration,
+		DatabaseSize,
+		DatabaseConnections,
+		DatabaseCommits,
+		DatabaseDeadlocks,
+	)
+}
+
+// ForgetDatabase drops the series of all database collectors of the Database object
+func ForgetDatabase(namespace, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "name": name}
+	DatabaseSize.DeletePartialMatch(labels)
+	DatabaseConnections.DeletePartialMatch(labels)
+	DatabaseCommits.DeletePartialMatch(labels)
+	DatabaseDeadlocks.DeletePartialMatch(labels)
+}
+
+// ObserveOperation records the outcome and duration of a provider operation started at start.
+// It is meant to be deferred with a pointer to the named error result of the operation.
+func ObserveOperation(engine, operation string, start time.Time, err *error) {
+	outcome := OutcomeSuccess
+	if err != nil && *err != nil {
+		outcome = OutcomeError
+	}
+
+	ProviderOperations.WithLabelValues(engine, operation, outcome).Inc()
+	ProviderOperationDuration.WithLabelValues(engine, operation, outcome).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+var _ = Describe("Metrics", func() {
+	It("should count provider operations by outcome", func() {
+		observe := func(err error) {
+			defer ObserveOperation("postgres", "test_operation", time.Now(), &err)
+		}
+
+		observe(nil)
+		observe(errors.New("failed"))
+		observe(nil)
+
+		Expect(testutil.ToFloat64(ProviderOperations.WithLabelValues("postgres", "test_operation", OutcomeSuccess))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(ProviderOperations.WithLabelValues("postgres", "test_operation", OutcomeError))).To(Equal(1.0))
+	})
+
+	It("should count the databases and users managed per host", func() {
+		scheme := runtime.NewScheme()
+		Expect(k8sv1beta1.AddToScheme(scheme)).To(Succeed())
+
+		database := func(name, host string) *k8sv1beta1.Database {
+			return &k8sv1beta1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec: k8sv1beta1.DatabaseSpec{
+					Name:    name,
+					HostRef: k8sv1beta1.DatabaseHostReference{Name: host},
+				},
+			}
+		}
+		user := &k8sv1beta1.DatabaseUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec: k8sv1beta1.DatabaseUserSpec{
+				Username: "app",
+				HostRef:  k8sv1beta1.DatabaseHostReference{Name: "postgres"},
+			},
+		}
+
+		reader := fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(database("a", "postgres"), database("b", "postgres"), database("c", "mysql"), user).
+			Build()
+
+		expected := `
+# HELP external_database_host_databases Number of Database objects managed on the database host.
+# TYPE external_database_host_databases gauge
+external_database_host_databases{host="mysql",namespace="default"} 1
+external_database_host_databases{host="postgres",namespace="default"} 2
+# HELP external_database_host_users Number of DatabaseUser objects managed on the database host.
+# TYPE external_database_host_users gauge
+external_database_host_users{host="postgres",namespace="default"} 1
+`
+		Expect(testutil.CollectAndCompare(NewManagedCollector(reader), strings.NewReader(expected))).To(Succeed())
+	})
+})
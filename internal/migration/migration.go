@@ -0,0 +1,117 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package migration reads versioned schema migrations and determines which of them
+// still have to be applied to reach a target version.
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/provider"
+)
+
+// filePattern matches the names of up migrations like "0001_create_users.up.sql"
+var filePattern = regexp.MustCompile(`^(\d+)_(.+)\.up\.sql$`)
+
+// Parse returns the up migrations of the files ordered by their version. Files which are not
+// up migrations, like down migrations or a README, are ignored.
+func Parse(files map[string]string) ([]provider.Migration, error) {
+	versions := map[int64]string{}
+
+	var migrations []provider.Migration
+	for file, content := range files {
+		match := filePattern.FindStringSubmatch(file)
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid version of migration '%s': %w", file, err)
+		}
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("Migrations '%s' and '%s' have the same version %d", other, file, version)
+		}
+		versions[version] = file
+
+		migrations = append(migrations, provider.Migration{
+			Version:  version,
+			Name:     match[2],
+			Content:  content,
+			Checksum: Checksum(content),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Checksum returns the SHA-256 checksum of the content of a migration
+func Checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Unapplied returns the migrations up to the target version which have not been applied yet,
+// all of them without a target. Applied migrations have to match their source, migrations
+// older than the latest applied one cannot be applied anymore and targets below it would
+// require down migrations, which are not supported.
+func Unapplied(migrations []provider.Migration, applied []k8sv1beta1.AppliedMigration, target *int64) ([]provider.Migration, error) {
+	checksums := map[int64]string{}
+	var current int64
+	for _, migration := range applied {
+		checksums[migration.Version] = migration.Checksum
+		current = max(current, migration.Version)
+	}
+
+	if target != nil && *target < current {
+		return nil, fmt.Errorf("Database is at version %d beyond the target version %d, down migrations are not supported", current, *target)
+	}
+
+	var pending []provider.Migration
+	for _, migration := range migrations {
+		if target != nil && migration.Version > *target {
+			break
+		}
+
+		checksum, ok := checksums[migration.Version]
+		switch {
+		case ok && checksum != migration.Checksum:
+			return nil, fmt.Errorf("Migration %d '%s' was changed after it was applied", migration.Version, migration.Name)
+		case ok:
+			continue
+		case migration.Version < current:
+			return nil, fmt.Errorf("Migration %d '%s' is older than the applied version %d", migration.Version, migration.Name, current)
+		}
+
+		pending = append(pending, migration)
+	}
+
+	if target != nil && len(migrations) > 0 && migrations[len(migrations)-1].Version < *target {
+		return nil, fmt.Errorf("Target version %d does not exist, the latest migration is %d", *target, migrations[len(migrations)-1].Version)
+	}
+
+	return pending, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migration
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	k8sv1beta1 "github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/provider"
+)
+
+var _ = Describe("Migrations", func() {
+	files := map[string]string{
+		"0001_create_users.up.sql":   "CREATE TABLE users (id bigint);",
+		"0001_create_users.down.sql": "DROP TABLE users;",
+		"0002_add_email.up.sql":      "ALTER TABLE users ADD email text;",
+		"10_create_orders.up.sql":    "CREATE TABLE orders (id bigint);",
+		"README.md":                  "# migrations",
+	}
+
+	versions := func(migrations []provider.Migration) []int64 {
+		var versions []int64
+		for _, migration := range migrations {
+			versions = append(versions, migration.Version)
+		}
+		return versions
+	}
+
+	applied := func(migrations ...provider.Migration) []k8sv1beta1.AppliedMigration {
+		var applied []k8sv1beta1.AppliedMigration
+		for _, migration := range migrations {
+			applied = append(applied, k8sv1beta1.AppliedMigration{Version: migration.Version, Name: migration.Name, Checksum: migration.Checksum})
+		}
+		return applied
+	}
+
+	target := func(version int64) *int64 {
+		return &version
+	}
+
+	It("should parse the up migrations ordered by version", func() {
+		migrations, err := Parse(files)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions(migrations)).To(Equal([]int64{1, 2, 10}))
+		Expect(migrations[0].Name).To(Equal("create_users"))
+		Expect(migrations[0].Checksum).To(Equal(Checksum("CREATE TABLE users (id bigint);")))
+	})
+
+	It("should reject duplicate versions", func() {
+		_, err := Parse(map[string]string{
+			"1_create_users.up.sql": "CREATE TABLE users (id bigint);",
+			"01_create_team.up.sql": "CREATE TABLE team (id bigint);",
+		})
+		Expect(err).To(MatchError(ContainSubstring("same version 1")))
+	})
+
+	It("should return the migrations up to the target which have not been applied", func() {
+		migrations, err := Parse(files)
+		Expect(err).NotTo(HaveOccurred())
+
+		pending, err := Unapplied(migrations, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions(pending)).To(Equal([]int64{1, 2, 10}))
+
+		pending, err = Unapplied(migrations, applied(migrations[0]), target(2))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions(pending)).To(Equal([]int64{2}))
+
+		pending, err = Unapplied(migrations, applied(migrations...), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending).To(BeEmpty())
+	})
+
+	It("should refuse changed, skipped and down migrations", func() {
+		migrations, err := Parse(files)
+		Expect(err).NotTo(HaveOccurred())
+
+		changed := migrations[0]
+		changed.Checksum = Checksum("CREATE TABLE people (id bigint);")
+		_, err = Unapplied(migrations, applied(changed), nil)
+		Expect(err).To(MatchError(ContainSubstring("changed after it was applied")))
+
+		_, err = Unapplied(migrations, applied(migrations[0], migrations[2]), nil)
+		Expect(err).To(MatchError(ContainSubstring("older than the applied version 10")))
+
+		_, err = Unapplied(migrations, applied(migrations...), target(2))
+		Expect(err).To(MatchError(ContainSubstring("down migrations are not supported")))
+
+		_, err = Unapplied(migrations, nil, target(11))
+		Expect(err).To(MatchError(ContainSubstring("does not exist")))
+	})
+})
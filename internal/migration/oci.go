@@ -0,0 +1,389 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// dockerHub is the registry of references without a registry like "acme/app-migrations:v3"
+	dockerHub = "docker.io"
+	// dockerHubAPI is the host serving the registry API of Docker Hub
+	dockerHubAPI = "registry-1.docker.io"
+
+	// titleAnnotation names the file of a layer, oras push sets it to the name of the pushed file
+	titleAnnotation = "org.opencontainers.image.title"
+
+	// maxArtifactSize limits the size of the manifest and of all layers of an artifact
+	maxArtifactSize = 16 << 20
+)
+
+// manifestMediaTypes are the manifests accepted for artifacts, indexes of several platforms are not
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// digestPattern matches the SHA-256 digests of manifests and layers
+var digestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// challengePattern matches the parameters of a WWW-Authenticate header like realm="https://ghcr.io/token"
+var challengePattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Reference identifies an artifact in a registry by a tag or a digest
+type Reference struct {
+	// Registry is the host and optional port of the registry
+	Registry string
+	// Repository is the name of the repository in the registry
+	Repository string
+	// Tag is the tag of the artifact, it is empty for references by digest
+	Tag string
+	// Digest is the digest of the manifest of the artifact, it is empty for references by tag
+	Digest string
+}
+
+// ParseReference parses references like "ghcr.io/acme/app-migrations:v3" or
+// "ghcr.io/acme/app-migrations@sha256:...". References without a registry are
+// pulled from Docker Hub and references without a tag or a digest use the tag latest.
+func ParseReference(reference string) (Reference, error) {
+	var ref Reference
+
+	name := reference
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+		if !digestPattern.MatchString(ref.Digest) {
+			return Reference{}, fmt.Errorf("Invalid digest '%s' of artifact '%s'", ref.Digest, reference)
+		}
+	}
+	// a colon after the last slash separates the tag, other colons belong to the port of the registry
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+
+	ref.Registry, ref.Repository = dockerHub, name
+	if i := strings.Index(name, "/"); i >= 0 && strings.ContainsAny(name[:i], ".:") || strings.HasPrefix(name, "localhost/") {
+		ref.Registry, ref.Repository = name[:i], name[i+1:]
+	}
+	if ref.Registry == dockerHub && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+
+	if ref.Repository == "" || ref.Repository != strings.ToLower(ref.Repository) {
+		return Reference{}, fmt.Errorf("Invalid repository in artifact '%s'", reference)
+	}
+
+	return ref, nil
+}
+
+// String returns the reference in its canonical form
+func (r Reference) String() string {
+	if r.Digest != "" {
+		return r.Registry + "/" + r.Repository + "@" + r.Digest
+	}
+	return r.Registry + "/" + r.Repository + ":" + r.Tag
+}
+
+// Credentials authenticate the pulls from a registry, empty credentials pull anonymously
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// CredentialsFromDockerConfig returns the credentials of the registry in the content of a
+// kubernetes.io/dockerconfigjson secret, empty credentials if it has none for the registry
+func CredentialsFromDockerConfig(dockerConfig []byte, registry string) (Credentials, error) {
+	var config struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(dockerConfig, &config); err != nil {
+		return Credentials{}, fmt.Errorf("Invalid docker config: %w", err)
+	}
+
+	for server, auth := range config.Auths {
+		if registryHost(server) != registry {
+			continue
+		}
+		if auth.Auth == "" {
+			return Credentials{Username: auth.Username, Password: auth.Password}, nil
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("Invalid auth of registry '%s' in docker config: %w", server, err)
+		}
+		username, password, _ := strings.Cut(string(decoded), ":")
+		return Credentials{Username: username, Password: password}, nil
+	}
+
+	return Credentials{}, nil
+}
+
+// registryHost returns the registry of a server in a docker config, which may be given as a URL
+func registryHost(server string) string {
+	host := server
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	host, _, _ = strings.Cut(host, "/")
+
+	switch host {
+	case "index.docker.io", dockerHubAPI:
+		return dockerHub
+	}
+	return host
+}
+
+// Artifact is the content of an OCI artifact
+type Artifact struct {
+	// Digest is the digest of the manifest of the artifact
+	Digest string
+	// Files are the contents of the layers by their title
+	Files map[string]string
+}
+
+// Puller pulls artifacts from OCI registries through the registry API
+type Puller struct {
+	// Client sends the requests to the registries, the default client is used without it
+	Client *http.Client
+}
+
+// Pull reads the manifest of the artifact and the layers with a title annotation.
+// The digests of the manifest and of the layers are verified.
+func (p *Puller) Pull(ctx context.Context, ref Reference, credentials Credentials, plainHTTP bool) (Artifact, error) {
+	client := http.DefaultClient
+	if p != nil && p.Client != nil {
+		client = p.Client
+	}
+
+	host := ref.Registry
+	if host == dockerHub {
+		host = dockerHubAPI
+	}
+	scheme := "https"
+	if plainHTTP {
+		scheme = "http"
+	}
+
+	s := &registrySession{
+		client:      client,
+		base:        fmt.Sprintf("%s://%s/v2/%s", scheme, host, ref.Repository),
+		scope:       fmt.Sprintf("repository:%s:pull", ref.Repository),
+		credentials: credentials,
+	}
+
+	version := ref.Tag
+	if ref.Digest != "" {
+		version = ref.Digest
+	}
+	manifestContent, digest, err := s.get(ctx, "/manifests/"+version, strings.Join(manifestMediaTypes, ", "), maxArtifactSize)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("Failed to pull manifest of artifact '%s': %w", ref, err)
+	}
+	if ref.Digest != "" && digest != ref.Digest {
+		return Artifact{}, fmt.Errorf("Manifest of artifact '%s' has the digest '%s'", ref, digest)
+	}
+
+	var manifest struct {
+		MediaType string `json:"mediaType"`
+		Layers    []struct {
+			Digest      string            `json:"digest"`
+			Size        int64             `json:"size"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(manifestContent, &manifest); err != nil {
+		return Artifact{}, fmt.Errorf("Invalid manifest of artifact '%s': %w", ref, err)
+	}
+	if manifest.Layers == nil {
+		return Artifact{}, fmt.Errorf("Artifact '%s' has no layers, indexes of several platforms are not supported", ref)
+	}
+
+	artifact := Artifact{Digest: digest, Files: map[string]string{}}
+	remaining := int64(maxArtifactSize)
+	for _, layer := range manifest.Layers {
+		title := layer.Annotations[titleAnnotation]
+		if title == "" {
+			continue
+		}
+		if !digestPattern.MatchString(layer.Digest) {
+			return Artifact{}, fmt.Errorf("Layer '%s' of artifact '%s' has the unsupported digest '%s'", title, ref, layer.Digest)
+		}
+		if layer.Size > remaining {
+			return Artifact{}, fmt.Errorf("Artifact '%s' exceeds %d bytes", ref, maxArtifactSize)
+		}
+
+		content, digest, err := s.get(ctx, "/blobs/"+layer.Digest, "", remaining)
+		if err != nil {
+			return Artifact{}, fmt.Errorf("Failed to pull layer '%s' of artifact '%s': %w", title, ref, err)
+		}
+		if digest != layer.Digest {
+			return Artifact{}, fmt.Errorf("Layer '%s' of artifact '%s' does not match its digest '%s'", title, ref, layer.Digest)
+		}
+
+		remaining -= int64(len(content))
+		artifact.Files[title] = string(content)
+	}
+
+	return artifact, nil
+}
+
+// registrySession sends the requests for one artifact, authenticating them once the registry asks for it
+type registrySession struct {
+	client      *http.Client
+	base        string
+	scope       string
+	credentials Credentials
+
+	authorization string
+}
+
+// get returns the content at the path below the repository and its digest
+func (s *registrySession) get(ctx context.Context, path, accept string, limit int64) ([]byte, string, error) {
+	response, err := s.do(ctx, path, accept)
+	if err != nil {
+		return nil, "", err
+	}
+	if response.StatusCode == http.StatusUnauthorized && s.authorization == "" {
+		challenge := response.Header.Get("WWW-Authenticate")
+		response.Body.Close()
+
+		if s.authorization, err = s.authorize(ctx, challenge); err != nil {
+			return nil, "", err
+		}
+		if response, err = s.do(ctx, path, accept); err != nil {
+			return nil, "", err
+		}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("registry responded with %s", response.Status)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(response.Body, limit+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(content)) > limit {
+		return nil, "", fmt.Errorf("content exceeds %d bytes", limit)
+	}
+
+	sum := sha256.Sum256(content)
+	return content, "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func (s *registrySession) do(ctx context.Context, path, accept string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	if s.authorization != "" {
+		request.Header.Set("Authorization", s.authorization)
+	}
+	return s.client.Do(request)
+}
+
+// authorize answers the challenge of the registry with basic authentication or with a bearer
+// token of its token service, which hands out anonymous tokens for public repositories
+func (s *registrySession) authorize(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if s.credentials.Username == "" {
+			return "", errors.New("registry requires credentials")
+		}
+		return "Basic " + basicAuth(s.credentials), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("registry requires the unsupported authentication '%s'", scheme)
+	}
+
+	values := map[string]string{}
+	for _, match := range challengePattern.FindAllStringSubmatch(params, -1) {
+		values[match[1]] = match[2]
+	}
+	realm, err := url.Parse(values["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("registry sent the invalid token realm '%s'", values["realm"])
+	}
+
+	query := realm.Query()
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	query.Set("scope", s.scope)
+	realm.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if s.credentials.Username != "" {
+		request.Header.Set("Authorization", "Basic "+basicAuth(s.credentials))
+	}
+	response, err := s.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token service responded with %s", response.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid response of the token service: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", errors.New("token service sent no token")
+	}
+
+	return "Bearer " + token.Token, nil
+}
+
+func basicAuth(credentials Credentials) string {
+	return base64.StdEncoding.EncodeToString([]byte(credentials.Username + ":" + credentials.Password))
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// registry serves the artifact of the repository acme/migrations behind a token service
+type registry struct {
+	server   *httptest.Server
+	blobs    map[string]string
+	manifest string
+	digest   string
+	password string
+}
+
+func newRegistry(files map[string]string, password string) *registry {
+	r := &registry{blobs: map[string]string{}, password: password}
+
+	type layer struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Size        int               `json:"size"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}
+	var layers []layer
+	for name, content := range files {
+		digest := sha256Digest(content)
+		r.blobs[digest] = content
+		layers = append(layers, layer{
+			MediaType:   "application/vnd.oci.image.layer.v1.tar",
+			Digest:      digest,
+			Size:        len(content),
+			Annotations: map[string]string{titleAnnotation: name},
+		})
+	}
+	manifest, _ := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"layers":        layers,
+	})
+	r.manifest = string(manifest)
+	r.digest = sha256Digest(r.manifest)
+
+	r.server = httptest.NewTLSServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+func (r *registry) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		username, password, _ := req.BasicAuth()
+		if req.URL.Query().Get("scope") != "repository:acme/migrations:pull" || r.password != "" && (username != "ci" || password != r.password) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"token":"pull-token"}`)
+		return
+	}
+
+	if req.Header.Get("Authorization") != "Bearer pull-token" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch path := req.URL.Path; {
+	case path == "/v2/acme/migrations/manifests/v1" || path == "/v2/acme/migrations/manifests/"+r.digest:
+		fmt.Fprint(w, r.manifest)
+	case strings.HasPrefix(path, "/v2/acme/migrations/blobs/"):
+		content, ok := r.blobs[strings.TrimPrefix(path, "/v2/acme/migrations/blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, content)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (r *registry) reference(version string) Reference {
+	return Reference{Registry: strings.TrimPrefix(r.server.URL, "https://"), Repository: "acme/migrations", Tag: version}
+}
+
+func sha256Digest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+var _ = Describe("OCI artifacts", func() {
+	ctx := context.Background()
+
+	files := map[string]string{
+		"0001_create_users.up.sql": "CREATE TABLE users (id bigint);",
+		"0002_add_email.up.sql":    "ALTER TABLE users ADD email text;",
+	}
+
+	DescribeTable("should parse references",
+		func(reference string, expected Reference) {
+			Expect(ParseReference(reference)).To(Equal(expected))
+		},
+		Entry("with a registry and a tag", "ghcr.io/acme/migrations:v3",
+			Reference{Registry: "ghcr.io", Repository: "acme/migrations", Tag: "v3"}),
+		Entry("with a port and a digest", "registry.local:5000/migrations@sha256:"+strings.Repeat("a", 64),
+			Reference{Registry: "registry.local:5000", Repository: "migrations", Digest: "sha256:" + strings.Repeat("a", 64)}),
+		Entry("on Docker Hub without a tag", "acme/migrations",
+			Reference{Registry: "docker.io", Repository: "acme/migrations", Tag: "latest"}),
+		Entry("of an official image", "migrations:v1",
+			Reference{Registry: "docker.io", Repository: "library/migrations", Tag: "v1"}),
+	)
+
+	It("should refuse invalid references", func() {
+		_, err := ParseReference("ghcr.io/acme/migrations@sha256:abc")
+		Expect(err).To(MatchError(ContainSubstring("Invalid digest")))
+		_, err = ParseReference("ghcr.io/Acme/migrations:v1")
+		Expect(err).To(MatchError(ContainSubstring("Invalid repository")))
+	})
+
+	It("should read the credentials of the registry from a docker config", func() {
+		dockerConfig := []byte(`{"auths":{
+			"https://index.docker.io/v1/":{"auth":"aHViOnNlY3JldA=="},
+			"ghcr.io":{"username":"ci","password":"token"}
+		}}`)
+
+		Expect(CredentialsFromDockerConfig(dockerConfig, "docker.io")).To(Equal(Credentials{Username: "hub", Password: "secret"}))
+		Expect(CredentialsFromDockerConfig(dockerConfig, "ghcr.io")).To(Equal(Credentials{Username: "ci", Password: "token"}))
+		Expect(CredentialsFromDockerConfig(dockerConfig, "quay.io")).To(Equal(Credentials{}))
+	})
+
+	It("should pull the files of an artifact with a token", func() {
+		registry := newRegistry(files, "")
+		defer registry.server.Close()
+
+		artifact, err := (&Puller{Client: registry.server.Client()}).Pull(ctx, registry.reference("v1"), Credentials{}, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(artifact.Digest).To(Equal(registry.digest))
+		Expect(artifact.Files).To(Equal(files))
+	})
+
+	It("should pull an artifact by its digest with credentials", func() {
+		registry := newRegistry(files, "token")
+		defer registry.server.Close()
+		puller := &Puller{Client: registry.server.Client()}
+
+		ref := registry.reference("")
+		ref.Digest = registry.digest
+		artifact, err := puller.Pull(ctx, ref, Credentials{Username: "ci", Password: "token"}, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(artifact.Files).To(Equal(files))
+
+		_, err = puller.Pull(ctx, ref, Credentials{}, false)
+		Expect(err).To(MatchError(ContainSubstring("token service responded with 401")))
+	})
+
+	It("should refuse layers which do not match their digest", func() {
+		registry := newRegistry(files, "")
+		defer registry.server.Close()
+		for digest := range registry.blobs {
+			registry.blobs[digest] = "DROP TABLE users;"
+		}
+
+		_, err := (&Puller{Client: registry.server.Client()}).Pull(ctx, registry.reference("v1"), Credentials{}, false)
+		Expect(err).To(MatchError(ContainSubstring("does not match its digest")))
+	})
+})
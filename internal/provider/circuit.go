@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// circuit is the rate limiter and circuit breaker of a single host
+type circuit struct {
+	limiter *rate.Limiter
+	// failures is the number of consecutive connection failures
+	failures int
+	// lastFailure is the time of the latest connection failure
+	lastFailure time.Time
+}
+
+// circuit returns the circuit of the host, the caller has to hold the lock
+func (p *Pools) circuit(host types.NamespacedName) *circuit {
+	c, ok := p.circuits[host]
+	if !ok {
+		c = &circuit{limiter: rate.NewLimiter(rate.Limit(p.options.StatementsPerSecond), max(p.options.StatementBurst, 1))}
+		p.circuits[host] = c
+	}
+	return c
+}
+
+// CircuitOpen reports whether operations on the host are suspended after repeated connection
+// failures and when the latest one happened. The circuit closes again with the next successful
+// connection check of the host.
+func (p *Pools) CircuitOpen(host types.NamespacedName) (bool, time.Time) {
+	if p == nil || p.options.FailureThreshold <= 0 {
+		return false, time.Time{}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, ok := p.circuits[host]
+	if !ok {
+		return false, time.Time{}
+	}
+	return c.failures >= p.options.FailureThreshold, c.lastFailure
+}
+
+// observe records the outcome of talking to the host in its circuit breaker.
+// Errors reported by the server prove the host is reachable and count as success.
+func (p *Pools) observe(host types.NamespacedName, err error) {
+	if p == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c := p.circuit(host)
+	if err == nil || !connectionFailure(err) {
+		c.failures = 0
+		return
+	}
+	c.failures++
+	c.lastFailure = time.Now()
+}
+
+// wait blocks until the rate limit of the host allows the next statement
+func (p *Pools) wait(ctx context.Context, host types.NamespacedName) error {
+	if p == nil || p.options.StatementsPerSecond <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	limiter := p.circuit(host).limiter
+	p.mu.Unlock()
+
+	return limiter.Wait(ctx)
+}
+
+// connectionFailure reports whether the error means the host could not be reached,
+// as opposed to an error the server returned for a statement like a syntax or permission error
+func connectionFailure(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		// a host which stops answering lets the operation run into its deadline
+		errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tuunit/external-database-operator/api/v1"
+)
+
+var _ = Describe("Circuit", func() {
+	host := types.NamespacedName{Namespace: "default", Name: "postgres"}
+	// nothing listens on port 1, so every connection fails right away
+	spec := v1.DatabaseHostSpec{
+		Host:      "127.0.0.1",
+		Port:      1,
+		Type:      v1.Postgres,
+		Superuser: "postgres",
+		Password:  "s3cr3t",
+	}
+
+	var pools *Pools
+
+	BeforeEach(func() {
+		pools = NewPools(PoolOptions{MaxOpenConns: 1, StatementsPerSecond: 1, StatementBurst: 1, FailureThreshold: 2})
+		DeferCleanup(pools.Close)
+	})
+
+	It("opens after repeated connection failures", func() {
+		client := pools.Postgres(host, spec, nil)
+
+		Expect(client.CheckConnection(context.Background())).NotTo(Succeed())
+		open, _ := pools.CircuitOpen(host)
+		Expect(open).To(BeFalse())
+
+		Expect(client.CheckConnection(context.Background())).NotTo(Succeed())
+		open, lastFailure := pools.CircuitOpen(host)
+		Expect(open).To(BeTrue())
+		Expect(lastFailure).To(BeTemporally("~", time.Now(), time.Second))
+	})
+
+	It("closes once the host answers again", func() {
+		refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+		pools.observe(host, refused)
+		pools.observe(host, refused)
+
+		// an error reported by the server proves the host is reachable
+		pools.observe(host, &pq.Error{Code: "42P04"})
+		open, _ := pools.CircuitOpen(host)
+		Expect(open).To(BeFalse())
+	})
+
+	It("is never open without pools", func() {
+		var none *Pools
+		none.observe(host, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+		open, _ := none.CircuitOpen(host)
+		Expect(open).To(BeFalse())
+	})
+
+	DescribeTable("tells connection failures from errors of the server",
+		func(err error, failure bool) {
+			Expect(connectionFailure(err)).To(Equal(failure))
+		},
+		Entry("refused connection", fmt.Errorf("Failed to ping: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}), true),
+		Entry("unknown host", &net.DNSError{Err: "no such host", Name: "postgres.invalid", IsNotFound: true}, true),
+		Entry("broken connection", driver.ErrBadConn, true),
+		Entry("closed connection", io.ErrUnexpectedEOF, true),
+		Entry("invalid MySQL connection", mysql.ErrInvalidConn, true),
+		Entry("PostgreSQL error", &pq.Error{Code: "42501"}, false),
+		Entry("MySQL error", &mysql.MySQLError{Number: 1044, Message: "Access denied"}, false),
+		Entry("other error", errors.New("Unsupported object type"), false),
+	)
+
+	It("limits the rate of statements per host", func() {
+		Expect(pools.wait(context.Background(), host)).To(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		Expect(pools.wait(ctx, host)).NotTo(Succeed())
+
+		// other hosts have their own bucket
+		Expect(pools.wait(ctx, types.NamespacedName{Namespace: "default", Name: "other"})).To(Succeed())
+	})
+})
@@ -0,0 +1,208 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tuunit/external-database-operator/api/v1"
+	"github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+// ErrUnsupportedLocale is returned when the charset or the collation of a database is not available on its host
+var ErrUnsupportedLocale = errors.New("Unsupported locale")
+
+// maxSuggestions is the number of close matches suggested for an unsupported charset or collation
+const maxSuggestions = 3
+
+// validateLocale checks the charset and the collation against the catalog of the host before a
+// database is created with them, so a missing locale is reported with close matches instead of
+// the error of CREATE DATABASE. Empty values are inherited from the template and not checked.
+// libc collations are looked up in pg_collation, which holds the locales of the host imported
+// by initdb or pg_import_system_collations, and in the collations of the existing databases.
+func (p *PostgreSQL) validateLocale(ctx context.Context, server v1.ServerInfo, charset, collation string, provider v1beta1.LocaleProvider) error {
+	if provider == v1beta1.LocaleProviderICU && !server.SupportsICULocales() {
+		return fmt.Errorf("%w: host '%s' does not support ICU locales, they require PostgreSQL 15 or later built with ICU", ErrUnsupportedLocale, p.Host)
+	}
+
+	db, err := p.connect("postgres")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if charset != "" {
+		charsets, err := queryStrings(ctx, db, `SELECT pg_encoding_to_char(i) FROM generate_series(0, 63) AS i WHERE pg_encoding_to_char(i) <> ''`)
+		if err != nil {
+			return fmt.Errorf("Failed to get charsets of '%s': %w", p.Host, err)
+		}
+		if err := checkLocale(p.Host, "charset", charset, charsets, normalizeCharset); err != nil {
+			return err
+		}
+	}
+
+	if collation == "" {
+		return nil
+	}
+
+	query := `SELECT collcollate FROM pg_collation WHERE collprovider = 'c' UNION SELECT datcollate FROM pg_database`
+	normalize := normalizeLibcLocale
+	if provider == v1beta1.LocaleProviderICU {
+		// PostgreSQL 17 renamed the column holding the ICU locale of a collation
+		column := "colliculocale"
+		if server.AtLeast(17) {
+			column = "colllocale"
+		}
+		query = `SELECT ` + column + ` FROM pg_collation WHERE collprovider = 'i' UNION SELECT 'und'`
+		normalize = normalizeICULocale
+	}
+
+	collations, err := queryStrings(ctx, db, query)
+	if err != nil {
+		return fmt.Errorf("Failed to get collations of '%s': %w", p.Host, err)
+	}
+	return checkLocale(p.Host, "collation", collation, collations, normalize)
+}
+
+// ValidateLocale checks the charset and the collation against the catalog of the MySQL host,
+// the collation has to belong to the charset. Empty values are not checked.
+func (m *MySQL) ValidateLocale(ctx context.Context, charset, collation string) (err error) {
+	ctx, end := startOperation(ctx, m.DatabaseHostSpec, "ValidateLocale", "validate_locale")
+	defer end(&err)
+
+	db, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if charset != "" {
+		charsets, err := queryStrings(ctx, db, `SELECT CHARACTER_SET_NAME FROM information_schema.CHARACTER_SETS`)
+		if err != nil {
+			return fmt.Errorf("Failed to get charsets of '%s': %w", m.Host, err)
+		}
+		if err := checkLocale(m.Host, "charset", charset, charsets, strings.ToLower); err != nil {
+			return err
+		}
+	}
+
+	if collation == "" {
+		return nil
+	}
+
+	query := `SELECT COLLATION_NAME FROM information_schema.COLLATIONS`
+	var args []any
+	if charset != "" {
+		query += ` WHERE CHARACTER_SET_NAME = ?`
+		args = append(args, charset)
+	}
+	collations, err := queryStrings(ctx, db, query, args...)
+	if err != nil {
+		return fmt.Errorf("Failed to get collations of '%s': %w", m.Host, err)
+	}
+
+	return checkLocale(m.Host, "collation", collation, collations, strings.ToLower)
+}
+
+// checkLocale returns ErrUnsupportedLocale with the closest available values if the value is not available on the host
+func checkLocale(host, kind, value string, available []string, normalize func(string) string) error {
+	for _, candidate := range available {
+		if normalize(candidate) == normalize(value) {
+			return nil
+		}
+	}
+
+	err := fmt.Errorf("%w: %s '%s' is not available on host '%s'", ErrUnsupportedLocale, kind, value, host)
+	if suggestions := suggest(value, available, normalize); len(suggestions) > 0 {
+		err = fmt.Errorf("%w, did you mean '%s'?", err, strings.Join(suggestions, "', '"))
+	}
+	return err
+}
+
+// normalizeCharset folds the spellings PostgreSQL accepts for the same encoding like utf-8 and UTF8
+func normalizeCharset(charset string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(charset))
+}
+
+// normalizeLibcLocale folds the spellings of the codeset of a locale like en_US.UTF-8 and en_US.utf8
+func normalizeLibcLocale(locale string) string {
+	name, codeset, ok := strings.Cut(locale, ".")
+	if !ok {
+		return locale
+	}
+	codeset, modifier, _ := strings.Cut(codeset, "@")
+	locale = name + "." + normalizeCharset(codeset)
+	if modifier != "" {
+		locale += "@" + modifier
+	}
+	return locale
+}
+
+// normalizeICULocale folds the spellings of a language tag like en-US and en_US
+func normalizeICULocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+// suggest returns the available values closest to the value, at most maxSuggestions of them
+func suggest(value string, available []string, normalize func(string) string) []string {
+	type match struct {
+		value    string
+		distance int
+	}
+
+	target := strings.ToLower(normalize(value))
+	var matches []match
+	for _, candidate := range available {
+		distance := levenshtein(target, strings.ToLower(normalize(candidate)))
+		if distance <= max(2, len(target)/2) {
+			matches = append(matches, match{value: candidate, distance: distance})
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b match) int {
+		if a.distance != b.distance {
+			return a.distance - b.distance
+		}
+		return strings.Compare(a.value, b.value)
+	})
+
+	var suggestions []string
+	for _, match := range matches {
+		if !slices.Contains(suggestions, match.value) {
+			suggestions = append(suggestions, match.value)
+		}
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+	}
+	return suggestions
+}
+
+// levenshtein returns the number of single character edits turning a into b
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
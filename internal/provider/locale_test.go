@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"errors"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tuunit/external-database-operator/api/v1"
+	"github.com/tuunit/external-database-operator/api/v1beta1"
+)
+
+var _ = Describe("Locales", func() {
+	Context("When checking a collation against the catalog", func() {
+		It("should accept other spellings of the codeset", func() {
+			Expect(checkLocale("alpine", "collation", "en_US.UTF-8", []string{"C", "POSIX", "en_US.utf8"}, normalizeLibcLocale)).To(Succeed())
+			Expect(checkLocale("alpine", "charset", "utf-8", []string{"SQL_ASCII", "UTF8"}, normalizeCharset)).To(Succeed())
+			Expect(checkLocale("alpine", "collation", "de_DE", []string{"und", "de-DE"}, normalizeICULocale)).To(Succeed())
+		})
+
+		It("should suggest close matches for a missing collation", func() {
+			err := checkLocale("alpine", "collation", "en_US.UTF-8", []string{"C", "POSIX", "C.UTF-8", "ucs_basic"}, normalizeLibcLocale)
+			Expect(errors.Is(err, ErrUnsupportedLocale)).To(BeTrue())
+			Expect(err).To(MatchError("Unsupported locale: collation 'en_US.UTF-8' is not available on host 'alpine', did you mean 'C.UTF-8'?"))
+		})
+
+		It("should not suggest anything unrelated", func() {
+			err := checkLocale("alpine", "charset", "KOI8", []string{"UTF8"}, normalizeCharset)
+			Expect(err).To(MatchError("Unsupported locale: charset 'KOI8' is not available on host 'alpine'"))
+		})
+
+		It("should suggest close matches for a missing MySQL collation", func() {
+			err := checkLocale("mariadb", "collation", "utf8mb4_0900_ai_ci",
+				[]string{"utf8mb4_general_ci", "utf8mb4_unicode_ci", "utf8mb4_uca1400_ai_ci", "utf8mb4_bin"}, strings.ToLower)
+			Expect(err).To(MatchError("Unsupported locale: collation 'utf8mb4_0900_ai_ci' is not available on host 'mariadb', did you mean 'utf8mb4_uca1400_ai_ci', 'utf8mb4_general_ci', 'utf8mb4_unicode_ci'?"))
+			Expect(checkLocale("mariadb", "charset", "UTF8MB4", []string{"latin1", "utf8mb4"}, strings.ToLower)).To(Succeed())
+		})
+
+		It("should order the suggestions by their distance", func() {
+			Expect(suggest("de_DE.UTF-8", []string{"fr_FR.utf8", "de_CH.utf8", "en_US.utf8", "de_AT.utf8", "C"}, normalizeLibcLocale)).
+				To(Equal([]string{"de_AT.utf8", "de_CH.utf8", "en_US.utf8"}))
+		})
+	})
+
+	Context("When setting the locale of a new database", func() {
+		It("should use the dialect of the server", func() {
+			pg16 := v1.ServerInfo{VersionNumber: 160002}
+			pg13 := v1.ServerInfo{VersionNumber: 130014}
+
+			Expect(localeClause(pg16, "UTF8", "en_US.utf8", "")).
+				To(Equal(` ENCODING 'UTF8' LC_COLLATE 'en_US.utf8' LC_CTYPE 'en_US.utf8'`))
+			Expect(localeClause(pg16, "UTF8", "en_US.utf8", v1beta1.LocaleProviderLibc)).
+				To(Equal(` ENCODING 'UTF8' LOCALE_PROVIDER libc LC_COLLATE 'en_US.utf8' LC_CTYPE 'en_US.utf8'`))
+			Expect(localeClause(pg13, "UTF8", "en_US.utf8", v1beta1.LocaleProviderLibc)).
+				To(Equal(` ENCODING 'UTF8' LC_COLLATE 'en_US.utf8' LC_CTYPE 'en_US.utf8'`))
+			Expect(localeClause(pg16, "UTF8", "de-DE", v1beta1.LocaleProviderICU)).
+				To(Equal(` ENCODING 'UTF8' LOCALE_PROVIDER icu ICU_LOCALE 'de-DE'`))
+			Expect(localeClause(pg16, "", "", "")).To(BeEmpty())
+		})
+	})
+})
@@ -1,4 +1,195 @@
 package provider
 
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tuunit/external-database-operator/api/v1"
+	"github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/audit"
+)
+
+// mysqlVersionPattern matches the leading version of a MySQL or MariaDB version string like 8.0.36-28
+var mysqlVersionPattern = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)`)
+
+// MySQL only reads from its host so far, databases and users are not managed on MySQL hosts yet.
+// Charsets and collations are therefore not validated against the catalog of MySQL hosts either.
 type MySQL struct {
+	v1.DatabaseHostSpec
+	sink audit.Sink
+
+	pools *Pools
+	host  types.NamespacedName
+}
+
+// NewMySQLClient returns a client for the host which records the statements it executes in the sink.
+// The client opens new connections for every operation, use Pools.MySQL to share them.
+func NewMySQLClient(spec v1.DatabaseHostSpec, sink audit.Sink) *MySQL {
+	return &MySQL{DatabaseHostSpec: spec, sink: sink}
+}
+
+func (m *MySQL) connect() (*session, error) {
+	config := mysql.NewConfig()
+	config.User = m.Superuser
+	config.Passwd = m.Password
+	config.Net = "tcp"
+	config.Addr = net.JoinHostPort(m.Host, strconv.Itoa(int(m.EffectivePort())))
+	connectionString := config.FormatDSN()
+
+	if m.pools != nil {
+		pool, err := m.pools.get(m.host, m.DatabaseHostSpec, "", "mysql", connectionString)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to connect to '%s@%s': %w", m.Superuser, m.Host, err)
+		}
+
+		session := newSession(pool.DB, m.DatabaseHostSpec, "", m.sink)
+		session.release = sync.OnceFunc(func() { m.pools.release(pool) })
+		return session, nil
+	}
+
+	db, err := sql.Open("mysql", connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to '%s@%s': %w", m.Superuser, m.Host, err)
+	}
+
+	return newSession(db, m.DatabaseHostSpec, "", m.sink), nil
+}
+
+func (m *MySQL) CheckConnection(ctx context.Context) (err error) {
+	ctx, end := startOperation(ctx, m.DatabaseHostSpec, "CheckConnection", "check_connection")
+	defer end(&err)
+
+	db, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = db.PingContext(ctx)
+	m.pools.observe(m.host, err)
+	if err != nil {
+		return fmt.Errorf("Failed to ping '%s@%s': %w", m.Superuser, m.Host, err)
+	}
+
+	return nil
+}
+
+// DatabaseStats returns the size of the tables of the database from the information schema and
+// the number of sessions using it. MySQL does not count transactions and deadlocks per database.
+func (m *MySQL) DatabaseStats(ctx context.Context, name string) (stats Stats, err error) {
+	ctx, end := startOperation(ctx, m.DatabaseHostSpec, "DatabaseStats", "database_stats")
+	defer end(&err)
+
+	db, err := m.connect()
+	if err != nil {
+		return Stats{}, err
+	}
+	defer db.Close()
+
+	query := `SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables WHERE table_schema = ?`
+	if err := db.queryRow(ctx, "SELECT", query, name).Scan(&stats.SizeBytes); err != nil {
+		return Stats{}, fmt.Errorf("Failed to get size of database '%s': %w", name, err)
+	}
+
+	query = `SELECT COUNT(*) FROM information_schema.processlist WHERE db = ?`
+	if err := db.queryRow(ctx, "SELECT", query, name).Scan(&stats.Connections); err != nil {
+		return Stats{}, fmt.Errorf("Failed to get connections to database '%s': %w", name, err)
+	}
+
+	return stats, nil
+}
+
+// DatabaseEmpty checks whether the database contains no tables, views or routines
+func (m *MySQL) DatabaseEmpty(ctx context.Context, name string) (empty bool, err error) {
+	ctx, end := startOperation(ctx, m.DatabaseHostSpec, "DatabaseEmpty", "database_empty")
+	defer end(&err)
+
+	db, err := m.connect()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	query := `SELECT (SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ?) +
+		(SELECT COUNT(*) FROM information_schema.routines WHERE routine_schema = ?)`
+	var objects int64
+	if err := db.queryRow(ctx, "SELECT", query, name, name).Scan(&objects); err != nil {
+		return false, fmt.Errorf("Failed to check whether database '%s' is empty: %w", name, err)
+	}
+
+	return objects == 0, nil
+}
+
+// DiscoverServer inspects the version and the flavor of the server.
+// With pools the result is kept until the spec of the host changes.
+func (m *MySQL) DiscoverServer(ctx context.Context) (server v1.ServerInfo, err error) {
+	ctx, end := startOperation(ctx, m.DatabaseHostSpec, "DiscoverServer", "discover_server")
+	defer end(&err)
+
+	db, err := m.connect()
+	if err != nil {
+		return v1.ServerInfo{}, err
+	}
+	defer db.Close()
+
+	var comment string
+	if err := db.queryRow(ctx, "SELECT", `SELECT @@version, @@version_comment`).Scan(&server.Version, &comment); err != nil {
+		return v1.ServerInfo{}, fmt.Errorf("Failed to get version of '%s': %w", m.Host, err)
+	}
+
+	// Aurora is the only flavor defining the aurora_version variable
+	var name, auroraVersion string
+	err = db.queryRow(ctx, "SHOW", `SHOW VARIABLES LIKE 'aurora\_version'`).Scan(&name, &auroraVersion)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return v1.ServerInfo{}, fmt.Errorf("Failed to get version of '%s': %w", m.Host, err)
+	}
+
+	server.VersionNumber, server.Flavor = parseMySQLVersion(server.Version, comment, err == nil)
+	server.DiscoveredAt = metav1.Now()
+	m.pools.remember(m.host, server)
+	return server, nil
+}
+
+// parseMySQLVersion returns the number and the flavor of a MySQL version string and its comment
+func parseMySQLVersion(version, comment string, aurora bool) (int64, v1.ServerFlavor) {
+	var number int64
+	if match := mysqlVersionPattern.FindStringSubmatch(version); match != nil {
+		for _, part := range match[1:] {
+			n, _ := strconv.ParseInt(part, 10, 64)
+			number = number*100 + n
+		}
+	}
+
+	switch {
+	case aurora:
+		return number, v1.FlavorAurora
+	case strings.Contains(version, "MariaDB"):
+		return number, v1.FlavorMariaDB
+	case strings.Contains(comment, "Percona"):
+		return number, v1.FlavorPercona
+	case strings.HasSuffix(version, "-google"):
+		return number, v1.FlavorCloudSQL
+	}
+	return number, v1.FlavorMySQL
+}
+
+// AppliedMigrations returns ErrMigrationsUnsupported, migrations are only tracked on PostgreSQL hosts so far
+func (m *MySQL) AppliedMigrations(_ context.Context, _, _ string) ([]v1beta1.AppliedMigration, error) {
+	return nil, fmt.Errorf("%w on MySQL host '%s'", ErrMigrationsUnsupported, m.Host)
+}
+
+// Migrate returns ErrMigrationsUnsupported, migrations are only applied to PostgreSQL hosts so far
+func (m *MySQL) Migrate(_ context.Context, _, _, _ string, _ []Migration) error {
+	return fmt.Errorf("%w on MySQL host '%s'", ErrMigrationsUnsupported, m.Host)
 }
@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tuunit/external-database-operator/api/v1"
+)
+
+var _ = Describe("MySQL", func() {
+	Context("When discovering the server", func() {
+		DescribeTable("should parse the version and the flavor",
+			func(version, comment string, aurora bool, number int64, flavor v1.ServerFlavor) {
+				n, f := parseMySQLVersion(version, comment, aurora)
+				Expect(n).To(Equal(number))
+				Expect(f).To(Equal(flavor))
+			},
+			Entry("MySQL", "8.0.36", "MySQL Community Server - GPL", false, int64(80036), v1.FlavorMySQL),
+			Entry("MySQL 5.7", "5.7.44-log", "MySQL Community Server (GPL)", false, int64(50744), v1.FlavorMySQL),
+			Entry("MariaDB", "10.11.6-MariaDB-1:10.11.6+maria~ubu2204", "mariadb.org binary distribution", false, int64(101106), v1.FlavorMariaDB),
+			Entry("Percona", "8.0.35-27", "Percona Server (GPL), Release 27", false, int64(80035), v1.FlavorPercona),
+			Entry("Aurora", "8.0.32", "Source distribution", true, int64(80032), v1.FlavorAurora),
+			Entry("Cloud SQL", "8.0.31-google", "(Google)", false, int64(80031), v1.FlavorCloudSQL),
+		)
+	})
+
+	Context("When migrating a database", func() {
+		It("should report that migrations are not supported", func() {
+			client := NewMySQLClient(v1.DatabaseHostSpec{Type: v1.MySQL, Host: "mysql.example.com"}, nil)
+
+			err := client.Migrate(context.Background(), "app", "", "schema_migrations", []Migration{{Version: 1}})
+			Expect(errors.Is(err, ErrMigrationsUnsupported)).To(BeTrue())
+			Expect(err).To(MatchError("Migrations are not supported on MySQL host 'mysql.example.com'"))
+		})
+	})
+})
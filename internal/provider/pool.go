@@ -0,0 +1,275 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tuunit/external-database-operator/api/v1"
+	"github.com/tuunit/external-database-operator/internal/audit"
+)
+
+// PoolOptions configures the connection pools of the hosts
+type PoolOptions struct {
+	// MaxOpenConns is the maximum number of open connections per host and database
+	MaxOpenConns int
+	// MaxIdleConns is the maximum number of idle connections per host and database
+	MaxIdleConns int
+	// ConnMaxLifetime is the maximum time a connection is reused
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime is the maximum time a connection is kept open without being used
+	ConnMaxIdleTime time.Duration
+	// StatementsPerSecond is the rate at which statements are executed against a single host
+	StatementsPerSecond float64
+	// StatementBurst is the number of statements executed against a single host before the rate applies
+	StatementBurst int
+	// FailureThreshold is the number of consecutive connection failures which open the circuit breaker of a host
+	FailureThreshold int
+}
+
+// BindFlags binds the pool options to the flag set
+func (o *PoolOptions) BindFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.MaxOpenConns, "db-max-open-conns", 10,
+		"The maximum number of open connections per database host and database")
+	fs.IntVar(&o.MaxIdleConns, "db-max-idle-conns", 2,
+		"The maximum number of idle connections per database host and database")
+	fs.DurationVar(&o.ConnMaxLifetime, "db-conn-max-lifetime", 30*time.Minute,
+		"The maximum time a connection to a database host is reused")
+	fs.DurationVar(&o.ConnMaxIdleTime, "db-conn-max-idle-time", 5*time.Minute,
+		"The maximum time a connection to a database host is kept open without being used")
+	fs.Float64Var(&o.StatementsPerSecond, "db-statements-per-second", 5,
+		"The rate at which statements are executed against a single database host")
+	fs.IntVar(&o.StatementBurst, "db-statement-burst", 10,
+		"The number of statements executed against a single database host before the rate limit applies")
+	fs.IntVar(&o.FailureThreshold, "db-circuit-failure-threshold", 3,
+		"The number of consecutive connection failures after which operations on a database host are suspended")
+}
+
+// Pools keeps one connection pool per DatabaseHost and database, so the reconcilers share
+// connections instead of opening new ones for every operation. The pools of a host are
+// replaced as soon as its spec or credentials change. Pools also limit the rate of the
+// statements executed against each host and track whether a host is reachable at all.
+type Pools struct {
+	options PoolOptions
+
+	mu       sync.Mutex
+	hosts    map[types.NamespacedName]*hostPools
+	circuits map[types.NamespacedName]*circuit
+}
+
+// hostPools are the pools to the databases of a single host
+type hostPools struct {
+	fingerprint string
+	databases   map[string]*pool
+	// server is the server discovered through the pools, nil until it was discovered
+	server *v1.ServerInfo
+}
+
+// pool is the pool to a single database. A replaced pool is retired instead of closed
+// right away, so the sessions still borrowing it can finish their operations.
+type pool struct {
+	*sql.DB
+	borrowers int
+	retired   bool
+}
+
+// NewPools returns an empty pool cache
+func NewPools(options PoolOptions) *Pools {
+	return &Pools{
+		options:  options,
+		hosts:    map[types.NamespacedName]*hostPools{},
+		circuits: map[types.NamespacedName]*circuit{},
+	}
+}
+
+// Postgres returns a client for the host which connects through the pools.
+// The spec has to hold the resolved superuser password. Without pools every
+// operation of the client opens its own connections.
+func (p *Pools) Postgres(host types.NamespacedName, spec v1.DatabaseHostSpec, sink audit.Sink) *PostgreSQL {
+	client := NewPostgresClient(spec, sink)
+	if p != nil {
+		client.pools = p
+		client.host = host
+	}
+	return client
+}
+
+// MySQL returns a client for the host which connects through the pools.
+// The spec has to hold the resolved superuser password.
+func (p *Pools) MySQL(host types.NamespacedName, spec v1.DatabaseHostSpec, sink audit.Sink) *MySQL {
+	client := NewMySQLClient(spec, sink)
+	if p != nil {
+		client.pools = p
+		client.host = host
+	}
+	return client
+}
+
+// get borrows the pool to the database of the host, replacing all pools of the host if its spec
+// changed. The pool has to be given back with release once the session is done with it.
+func (p *Pools) get(host types.NamespacedName, spec v1.DatabaseHostSpec, database, driver, dataSource string) (*pool, error) {
+	fingerprint, err := fingerprint(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pools, ok := p.hosts[host]
+	if ok && pools.fingerprint != fingerprint {
+		pools.retire()
+		ok = false
+	}
+	if !ok {
+		pools = &hostPools{fingerprint: fingerprint, databases: map[string]*pool{}}
+		p.hosts[host] = pools
+	}
+
+	if db, ok := pools.databases[database]; ok {
+		db.borrowers++
+		return db, nil
+	}
+
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(p.options.MaxOpenConns)
+	db.SetMaxIdleConns(p.options.MaxIdleConns)
+	db.SetConnMaxLifetime(p.options.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.options.ConnMaxIdleTime)
+
+	pools.databases[database] = &pool{DB: db, borrowers: 1}
+	return pools.databases[database], nil
+}
+
+// release gives back a pool borrowed by get and closes it if it was retired in the meantime
+func (p *Pools) release(db *pool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	db.borrowers--
+	if db.retired && db.borrowers == 0 {
+		db.Close()
+	}
+}
+
+// Forget retires the pool to the database of the host, for example before it is dropped or renamed,
+// so its idle connections neither block the statement nor linger once the database is gone
+func (p *Pools) Forget(host types.NamespacedName, database string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pools, ok := p.hosts[host]; ok {
+		if db, ok := pools.databases[database]; ok {
+			db.retire()
+			delete(pools.databases, database)
+		}
+	}
+}
+
+// server returns the server last discovered on the host, nil if it was not discovered
+// since the pools of the host were opened
+func (p *Pools) server(host types.NamespacedName) *v1.ServerInfo {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pools, ok := p.hosts[host]; ok {
+		return pools.server
+	}
+	return nil
+}
+
+// remember keeps the server discovered on the host until the pools of the host are replaced
+func (p *Pools) remember(host types.NamespacedName, server v1.ServerInfo) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pools, ok := p.hosts[host]; ok {
+		pools.server = &server
+	}
+}
+
+// Invalidate retires all pools of the host and forgets its state, for example after it was deleted
+func (p *Pools) Invalidate(host types.NamespacedName) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pools, ok := p.hosts[host]; ok {
+		pools.retire()
+		delete(p.hosts, host)
+	}
+	delete(p.circuits, host)
+}
+
+// Close closes the pools of all hosts
+func (p *Pools) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for host, pools := range p.hosts {
+		errs = append(errs, pools.close())
+		delete(p.hosts, host)
+	}
+	return errors.Join(errs...)
+}
+
+func (h *hostPools) close() error {
+	var errs []error
+	for _, db := range h.databases {
+		errs = append(errs, db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// retire retires the pools of all databases of the host, the caller has to hold the lock
+func (h *hostPools) retire() {
+	for _, db := range h.databases {
+		db.retire()
+	}
+}
+
+// retire closes the pool once it is not borrowed anymore, the caller has to hold the lock
+func (db *pool) retire() {
+	db.retired = true
+	if db.borrowers == 0 {
+		db.Close()
+	}
+}
+
+// fingerprint identifies everything about the host a connection depends on, including its password
+func fingerprint(spec v1.DatabaseHostSpec) (string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("Failed to fingerprint host '%s': %w", spec.Host, err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tuunit/external-database-operator/api/v1"
+)
+
+var _ = Describe("Pools", func() {
+	host := types.NamespacedName{Namespace: "default", Name: "postgres"}
+	spec := v1.DatabaseHostSpec{
+		Host:      "127.0.0.1",
+		Port:      1,
+		Type:      v1.Postgres,
+		Superuser: "postgres",
+		Password:  "s3cr3t",
+	}
+
+	var pools *Pools
+
+	BeforeEach(func() {
+		pools = NewPools(PoolOptions{MaxOpenConns: 3, MaxIdleConns: 1, ConnMaxLifetime: time.Minute})
+		DeferCleanup(pools.Close)
+	})
+
+	get := func(spec v1.DatabaseHostSpec, database string) *session {
+		session, err := pools.Postgres(host, spec, nil).connect(database)
+		Expect(err).NotTo(HaveOccurred())
+		return session
+	}
+
+	closed := func(session *session) bool {
+		err := session.DB.PingContext(context.Background())
+		return err != nil && err.Error() == "sql: database is closed"
+	}
+
+	It("shares the pool of a database between clients", func() {
+		first := get(spec, "postgres")
+		Expect(first.Close()).To(Succeed())
+
+		second := get(spec, "postgres")
+		Expect(second.DB).To(BeIdenticalTo(first.DB))
+		Expect(closed(second)).To(BeFalse())
+
+		Expect(get(spec, "app").DB).NotTo(BeIdenticalTo(first.DB))
+	})
+
+	It("applies the pool options", func() {
+		Expect(get(spec, "postgres").DB.Stats().MaxOpenConnections).To(Equal(3))
+	})
+
+	It("replaces the pools when the spec of the host changes", func() {
+		old := get(spec, "postgres")
+
+		rotated := spec
+		rotated.Password = "n3w"
+		Expect(get(rotated, "postgres").DB).NotTo(BeIdenticalTo(old.DB))
+		Expect(closed(old)).To(BeFalse())
+
+		Expect(old.Close()).To(Succeed())
+		Expect(closed(old)).To(BeTrue())
+	})
+
+	It("closes a replaced pool only after all its sessions are done", func() {
+		first := get(spec, "postgres")
+		second := get(spec, "postgres")
+		pools.Invalidate(host)
+
+		Expect(first.Close()).To(Succeed())
+		Expect(closed(second)).To(BeFalse())
+		Expect(first.Close()).To(Succeed())
+		Expect(closed(second)).To(BeFalse())
+
+		Expect(second.Close()).To(Succeed())
+		Expect(closed(second)).To(BeTrue())
+	})
+
+	It("forgets the pool of a dropped or renamed database", func() {
+		app := get(spec, "app")
+		Expect(app.Close()).To(Succeed())
+		other := get(spec, "postgres")
+
+		pools.Forget(host, "app")
+		Expect(closed(app)).To(BeTrue())
+		Expect(closed(other)).To(BeFalse())
+		Expect(get(spec, "app").DB).NotTo(BeIdenticalTo(app.DB))
+	})
+
+	It("remembers the server until the spec of the host changes", func() {
+		get(spec, "postgres")
+		pools.remember(host, v1.ServerInfo{Version: "16.2", VersionNumber: 160002})
+		Expect(pools.server(host)).To(HaveField("VersionNumber", int64(160002)))
+
+		rotated := spec
+		rotated.Password = "n3w"
+		get(rotated, "postgres")
+		Expect(pools.server(host)).To(BeNil())
+	})
+
+	It("closes the pools of an invalidated host", func() {
+		old := get(spec, "postgres")
+		Expect(old.Close()).To(Succeed())
+
+		pools.Invalidate(host)
+		Expect(closed(old)).To(BeTrue())
+		Expect(get(spec, "postgres").DB).NotTo(BeIdenticalTo(old.DB))
+	})
+
+	It("opens a new connection for every client without pools", func() {
+		var none *Pools
+		session, err := none.Postgres(host, spec, nil).connect("postgres")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(session.Close()).To(Succeed())
+		Expect(closed(session)).To(BeTrue())
+	})
+})
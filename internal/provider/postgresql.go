@@ -1,80 +1,916 @@
 package provider
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	_ "github.com/lib/pq"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
 	"github.com/tuunit/external-database-operator/api/v1"
-	"github.com/tuunit/external-database-operator/api/v1alpha1"
+	"github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/audit"
 )
 
+// privilegePattern matches privilege keywords like SELECT or ALL PRIVILEGES
+var privilegePattern = regexp.MustCompile(`^[A-Za-z]+( [A-Za-z]+)*$`)
+
+// postgresObjectTypes maps the supported object types of a privilege to their SQL keyword
+var postgresObjectTypes = map[string]string{
+	"database": "DATABASE",
+	"schema":   "SCHEMA",
+	"table":    "TABLE",
+	"sequence": "SEQUENCE",
+}
+
 type PostgreSQL struct {
 	v1.DatabaseHostSpec
+	sink audit.Sink
+
+	pools *Pools
+	host  types.NamespacedName
 }
 
-func NewPostgresClient(spec v1.DatabaseHostSpec) *PostgreSQL {
-	return &PostgreSQL{spec}
+// NewPostgresClient returns a client for the host which records the statements it executes in the sink.
+// The client opens new connections for every operation, use Pools.Postgres to share them.
+func NewPostgresClient(spec v1.DatabaseHostSpec, sink audit.Sink) *PostgreSQL {
+	return &PostgreSQL{DatabaseHostSpec: spec, sink: sink}
 }
 
-func (p *PostgreSQL) CheckConnection() error {
-	connectionString := fmt.Sprintf("host=%s port=%d user=%s password=%s database=postgres sslmode=disable", p.Host, p.Port, p.Superuser, p.Password)
+func (p *PostgreSQL) connect(database string) (*session, error) {
+	connectionString := fmt.Sprintf("host=%s port=%d user=%s password=%s database=%s sslmode=disable", p.Host, p.EffectivePort(), p.Superuser, p.Password, database)
+
+	if p.pools != nil {
+		pool, err := p.pools.get(p.host, p.DatabaseHostSpec, database, "postgres", connectionString)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to connect to '%s@%s': %w", p.Superuser, p.Host, err)
+		}
+
+		session := newSession(pool.DB, p.DatabaseHostSpec, database, p.sink)
+		session.release = sync.OnceFunc(func() { p.pools.release(pool) })
+		return session, nil
+	}
 
 	db, err := sql.Open("postgres", connectionString)
 	if err != nil {
-		return fmt.Errorf("Failed to connect to '%s@%s': %w", p.Superuser, p.Host, err)
+		return nil, fmt.Errorf("Failed to connect to '%s@%s': %w", p.Superuser, p.Host, err)
+	}
+
+	return newSession(db, p.DatabaseHostSpec, database, p.sink), nil
+}
+
+func (p *PostgreSQL) CheckConnection(ctx context.Context) (err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "CheckConnection", "check_connection")
+	defer end(&err)
+
+	db, err := p.connect("postgres")
+	if err != nil {
+		return err
 	}
 	defer db.Close()
 
-	if err := db.Ping(); err != nil {
+	err = db.PingContext(ctx)
+	p.pools.observe(p.host, err)
+	if err != nil {
 		return fmt.Errorf("Failed to ping '%s@%s': %w", p.Superuser, p.Host, err)
 	}
 
 	return nil
 }
 
-func (p *PostgreSQL) CreateDB(spec *v1alpha1.DatabaseSpec) error {
-	connectionString := fmt.Sprintf("host=%s port=%d user=%s password=%s database=postgres sslmode=disable", p.Host, p.Port, p.Superuser, p.Password)
+// DiscoverServer inspects the version, the flavor, the available extensions and the collation
+// providers of the server. With pools the result is kept until the spec of the host changes.
+func (p *PostgreSQL) DiscoverServer(ctx context.Context) (server v1.ServerInfo, err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "DiscoverServer", "discover_server")
+	defer end(&err)
 
-	db, err := sql.Open("postgres", connectionString)
+	db, err := p.connect("postgres")
 	if err != nil {
-		return fmt.Errorf("Failed to connect to '%s@%s': %w", p.Superuser, p.Host, err)
+		return v1.ServerInfo{}, err
 	}
 	defer db.Close()
 
-	var datname string
-	err = db.QueryRow(`SELECT datname FROM pg_database WHERE datname = $1`, spec.Name).Scan(&datname)
+	// Aurora ships the aurora_version function and Cloud SQL its own superuser role
+	var aurora, cloudSQL bool
+	query := `SELECT current_setting('server_version'), current_setting('server_version_num')::bigint,
+		EXISTS (SELECT 1 FROM pg_proc WHERE proname = 'aurora_version'),
+		EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'cloudsqlsuperuser')`
+	if err := db.queryRow(ctx, "SELECT", query).Scan(&server.Version, &server.VersionNumber, &aurora, &cloudSQL); err != nil {
+		return v1.ServerInfo{}, fmt.Errorf("Failed to get version of '%s': %w", p.Host, err)
+	}
+	switch {
+	case aurora:
+		server.Flavor = v1.FlavorAurora
+	case cloudSQL:
+		server.Flavor = v1.FlavorCloudSQL
+	default:
+		server.Flavor = v1.FlavorPostgreSQL
+	}
+
+	if server.Extensions, err = queryStrings(ctx, db, `SELECT name FROM pg_available_extensions ORDER BY name`); err != nil {
+		return v1.ServerInfo{}, fmt.Errorf("Failed to get extensions of '%s': %w", p.Host, err)
+	}
 
-	owner := p.Superuser
-	charset := "UTF8"
-	collation := "en_US.UTF-8"
+	providers, err := queryStrings(ctx, db, `SELECT DISTINCT collprovider::text FROM pg_collation ORDER BY 1`)
+	if err != nil {
+		return v1.ServerInfo{}, fmt.Errorf("Failed to get collation providers of '%s': %w", p.Host, err)
+	}
+	server.CollationProviders = collationProviders(providers)
+
+	server.DiscoveredAt = metav1.Now()
+	p.pools.remember(p.host, server)
+	return server, nil
+}
+
+// server returns the server discovered through the pools or discovers it
+func (p *PostgreSQL) server(ctx context.Context) (v1.ServerInfo, error) {
+	if server := p.pools.server(p.host); server != nil {
+		return *server, nil
+	}
+	return p.DiscoverServer(ctx)
+}
+
+// queryStrings returns the values of the single column of the rows of the query
+func queryStrings(ctx context.Context, db *session, query string, args ...any) ([]string, error) {
+	rows, err := db.query(ctx, "SELECT", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// collationProviders maps the providers of pg_collation to their names, skipping the
+// default provider which only stands for the provider of the database
+func collationProviders(codes []string) []string {
+	names := map[string]string{
+		"c": v1.CollationProviderLibc,
+		"i": v1.CollationProviderICU,
+		"b": v1.CollationProviderBuiltin,
+	}
+
+	var providers []string
+	for _, code := range codes {
+		if name, ok := names[code]; ok {
+			providers = append(providers, name)
+		}
+	}
+	return providers
+}
+
+// Execute runs the statements of the plan in order and stops at the first failing one.
+// With pools the statements are subject to the rate limit of the host.
+func (p *PostgreSQL) Execute(ctx context.Context, plan Plan) error {
+	sessions := map[string]*session{}
+	defer func() {
+		for _, db := range sessions {
+			db.Close()
+		}
+	}()
+
+	for _, statement := range plan {
+		db, ok := sessions[statement.Database]
+		if !ok {
+			var err error
+			if db, err = p.connect(statement.Database); err != nil {
+				return err
+			}
+			sessions[statement.Database] = db
+		}
+
+		if err := p.pools.wait(ctx, p.host); err != nil {
+			return err
+		}
+
+		err := db.execute(ctx, statement)
+		p.pools.observe(p.host, err)
+		if err != nil {
+			return fmt.Errorf("Failed to %s: %w", statement.Description, err)
+		}
+	}
+
+	return nil
+}
+
+// CreateDB creates the database unless it already exists and reports whether it was created
+func (p *PostgreSQL) CreateDB(ctx context.Context, spec *v1beta1.DatabaseSpec) (created bool, err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "CreateDB", "create_database")
+	defer end(&err)
+
+	plan, err := p.PlanCreateDB(ctx, spec)
+	if err != nil {
+		return false, err
+	}
+
+	return len(plan) > 0, p.Execute(ctx, plan)
+}
+
+// PlanCreateDB plans the creation of the database unless it already exists
+func (p *PostgreSQL) PlanCreateDB(ctx context.Context, spec *v1beta1.DatabaseSpec) (Plan, error) {
+	return p.planCreateDB(ctx, spec, "")
+}
+
+// CreateDBFromTemplate creates the database as a copy of the template unless it already exists
+// and reports whether it was created
+func (p *PostgreSQL) CreateDBFromTemplate(ctx context.Context, spec *v1beta1.DatabaseSpec, template string) (created bool, err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "CreateDBFromTemplate", "create_database_from_template")
+	defer end(&err)
+
+	plan, err := p.PlanCreateDBFromTemplate(ctx, spec, template)
+	if err != nil {
+		return false, err
+	}
+
+	return len(plan) > 0, p.Execute(ctx, plan)
+}
+
+// PlanCreateDBFromTemplate plans the creation of the database as a copy of the template unless it already exists
+func (p *PostgreSQL) PlanCreateDBFromTemplate(ctx context.Context, spec *v1beta1.DatabaseSpec, template string) (Plan, error) {
+	return p.planCreateDB(ctx, spec, template)
+}
+
+func (p *PostgreSQL) planCreateDB(ctx context.Context, spec *v1beta1.DatabaseSpec, template string) (Plan, error) {
+	exists, err := p.databaseExists(ctx, spec.Name)
+	if err != nil || exists {
+		return nil, err
+	}
+
+	owner := p.Superuser
 	if spec.Owner != "" {
 		owner = spec.Owner
 	}
 
-	if spec.Charset != "" {
-		charset = spec.Charset
+	server, err := p.server(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	if spec.Collation != "" {
-		collation = spec.Collation
+	query := fmt.Sprintf("CREATE DATABASE %s WITH OWNER %s", pq.QuoteIdentifier(spec.Name), pq.QuoteIdentifier(owner))
+
+	if template == "" {
+		charset := p.EffectiveCharset()
+		collation := p.EffectiveCollation()
+
+		if spec.Charset != "" {
+			charset = spec.Charset
+		}
+
+		if spec.Collation != "" {
+			collation = spec.Collation
+		}
+
+		if err := p.validateLocale(ctx, server, charset, collation, spec.LocaleProvider); err != nil {
+			return nil, err
+		}
+
+		// only template0 can be copied with another locale provider than its own
+		if spec.LocaleProvider == v1beta1.LocaleProviderICU {
+			query += " TEMPLATE template0"
+		}
+
+		return Plan{{
+			Kind:        "CREATE DATABASE",
+			Database:    "postgres",
+			Query:       query + localeClause(server, charset, collation, spec.LocaleProvider),
+			Description: fmt.Sprintf("create database '%s'", spec.Name),
+		}}, nil
 	}
 
-	if err == sql.ErrNoRows {
-		_, err = db.Exec(`CREATE DATABASE "` + spec.Name + `"
-												  WITH OWNER "` + owner + `" 
-													ENCODING '` + charset + `'
-													LC_COLLATE '` + collation + `'
-													LC_CTYPE '` + collation + `'`)
+	// a copy inherits the locale of its template, PostgreSQL refuses to copy it with another one
+	if spec.Charset != "" || spec.Collation != "" || spec.LocaleProvider != "" {
+		return nil, fmt.Errorf("%w: database '%s' takes the charset, collation and locale provider of its template '%s', they cannot be set",
+			ErrUnsupportedLocale, spec.Name, template)
 	}
+	query += " TEMPLATE " + pq.QuoteIdentifier(template)
+
+	// a database cannot be copied while there are sessions connected to it
+	return Plan{
+		p.terminateSessions(template),
+		{
+			Kind:        "CREATE DATABASE",
+			Database:    "postgres",
+			Query:       query,
+			Description: fmt.Sprintf("create database '%s' from template '%s'", spec.Name, template),
+		},
+	}, nil
+}
 
-	if err != nil && err != sql.ErrNoRows {
-		return fmt.Errorf("Failed to create database '%s': %w", spec.Name, err)
+func (p *PostgreSQL) RenameDB(ctx context.Context, from, to string) (err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "RenameDB", "rename_database")
+	defer end(&err)
+
+	plan, err := p.PlanRenameDB(ctx, from, to)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	// the idle connections of the pool would keep the database from being renamed
+	p.pools.Forget(p.host, from)
+	return p.Execute(ctx, plan)
+}
+
+// PlanRenameDB plans renaming the database, which is empty if it was already renamed
+func (p *PostgreSQL) PlanRenameDB(ctx context.Context, from, to string) (Plan, error) {
+	exists, err := p.databaseExists(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// a previous rename may have succeeded without being recorded
+		if exists, err = p.databaseExists(ctx, to); err != nil || exists {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Failed to rename database '%s': database does not exist", from)
+	}
+
+	// a database cannot be renamed while there are sessions connected to it
+	return Plan{
+		p.terminateSessions(from),
+		{
+			Kind:        "ALTER DATABASE",
+			Database:    "postgres",
+			Query:       `ALTER DATABASE ` + pq.QuoteIdentifier(from) + ` RENAME TO ` + pq.QuoteIdentifier(to),
+			Description: fmt.Sprintf("rename database '%s' to '%s'", from, to),
+		},
+	}, nil
+}
+
+// localeClause sets the encoding and the collation of a new database in the dialect of the server,
+// empty values are inherited from the template
+func localeClause(server v1.ServerInfo, charset, collation string, provider v1beta1.LocaleProvider) string {
+	var clause string
+	if charset != "" {
+		clause += " ENCODING " + pq.QuoteLiteral(charset)
+	}
+
+	switch {
+	case provider == v1beta1.LocaleProviderICU:
+		clause += " LOCALE_PROVIDER icu ICU_LOCALE " + pq.QuoteLiteral(collation)
+	case collation != "":
+		// only PostgreSQL 15 and later know other providers than libc
+		if provider == v1beta1.LocaleProviderLibc && server.AtLeast(15) {
+			clause += " LOCALE_PROVIDER libc"
+		}
+		clause += " LC_COLLATE " + pq.QuoteLiteral(collation) + " LC_CTYPE " + pq.QuoteLiteral(collation)
+	}
+	return clause
+}
+
+// DropDB drops the database and reports whether it existed
+func (p *PostgreSQL) DropDB(ctx context.Context, name string) (dropped bool, err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "DropDB", "drop_database")
+	defer end(&err)
+
+	plan, err := p.PlanDropDB(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	// the idle connections of the pool would keep the database from being dropped
+	p.pools.Forget(p.host, name)
+	return len(plan) > 0, p.Execute(ctx, plan)
+}
+
+// PlanDropDB plans dropping the database, which is empty if it does not exist
+func (p *PostgreSQL) PlanDropDB(ctx context.Context, name string) (Plan, error) {
+	exists, err := p.databaseExists(ctx, name)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	server, err := p.server(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.dropStatements(server, name), nil
+}
+
+// dropStatements drops the database in the dialect of the server. A database cannot be
+// dropped while there are sessions connected to it, which PostgreSQL 13 and later terminate
+// on their own with the FORCE option.
+func (p *PostgreSQL) dropStatements(server v1.ServerInfo, name string) Plan {
+	drop := Statement{
+		Kind:        "DROP DATABASE",
+		Database:    "postgres",
+		Query:       `DROP DATABASE IF EXISTS ` + pq.QuoteIdentifier(name),
+		Description: fmt.Sprintf("drop database '%s'", name),
+	}
+	if server.AtLeast(13) {
+		drop.Query += ` WITH (FORCE)`
+		return Plan{drop}
+	}
+
+	return Plan{p.terminateSessions(name), drop}
+}
+
+// DatabaseStats returns the size of the database and its activity from pg_stat_database
+func (p *PostgreSQL) DatabaseStats(ctx context.Context, name string) (stats Stats, err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "DatabaseStats", "database_stats")
+	defer end(&err)
+
+	db, err := p.connect("postgres")
+	if err != nil {
+		return Stats{}, err
+	}
+	defer db.Close()
+
+	var commits, deadlocks int64
+	query := `SELECT pg_database_size(d.oid), s.numbackends, s.xact_commit, s.deadlocks
+		FROM pg_database d JOIN pg_stat_database s ON s.datid = d.oid WHERE d.datname = $1`
+	if err := db.queryRow(ctx, "SELECT", query, name).Scan(&stats.SizeBytes, &stats.Connections, &commits, &deadlocks); err != nil {
+		return Stats{}, fmt.Errorf("Failed to get stats of database '%s': %w", name, err)
+	}
+	stats.Commits = &commits
+	stats.Deadlocks = &deadlocks
+
+	return stats, nil
 }
 
-func (p *PostgreSQL) CreateUser(spec *v1alpha1.DatabaseUserSpec) error {
+// DatabaseEmpty reports whether the database contains no relations outside of the system schemas
+func (p *PostgreSQL) DatabaseEmpty(ctx context.Context, name string) (empty bool, err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "DatabaseEmpty", "database_empty")
+	defer end(&err)
+
+	db, err := p.connect(name)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	query := `SELECT NOT EXISTS (
+		SELECT 1 FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg\_toast%'
+	)`
+	if err := db.queryRow(ctx, "SELECT", query).Scan(&empty); err != nil {
+		return false, fmt.Errorf("Failed to check whether database '%s' is empty: %w", name, err)
+	}
+
+	return empty, nil
+}
+
+func (p *PostgreSQL) databaseExists(ctx context.Context, name string) (bool, error) {
+	db, err := p.connect("postgres")
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var exists bool
+	if err := db.queryRow(ctx, "SELECT", `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, name).Scan(&exists); err != nil {
+		return false, fmt.Errorf("Failed to look up database '%s': %w", name, err)
+	}
+
+	return exists, nil
+}
+
+func (p *PostgreSQL) terminateSessions(name string) Statement {
+	return Statement{
+		Kind:        "SELECT",
+		Database:    "postgres",
+		Query:       `SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = ` + pq.QuoteLiteral(name) + ` AND pid <> pg_backend_pid()`,
+		Description: fmt.Sprintf("terminate sessions on database '%s'", name),
+	}
+}
+
+// CreateUser creates a login role with the given password unless it already exists
+// and reports whether it was created
+func (p *PostgreSQL) CreateUser(ctx context.Context, spec *v1beta1.DatabaseUserSpec, password string) (created bool, err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "CreateUser", "create_user")
+	defer end(&err)
+
+	plan, err := p.PlanCreateUser(ctx, spec, password)
+	if err != nil {
+		return false, err
+	}
+
+	return len(plan) > 0, p.Execute(ctx, plan)
+}
+
+// PlanCreateUser plans the creation of the login role unless it already exists
+func (p *PostgreSQL) PlanCreateUser(ctx context.Context, spec *v1beta1.DatabaseUserSpec, password string) (Plan, error) {
+	db, err := p.connect("postgres")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var exists bool
+	if err := db.queryRow(ctx, "SELECT", `SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)`, spec.Username).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("Failed to look up user '%s': %w", spec.Username, err)
+	}
+	if exists {
+		return nil, nil
+	}
+
+	literal := pq.QuoteLiteral(password)
+	return Plan{{
+		Kind:        "CREATE ROLE",
+		Database:    "postgres",
+		Query:       `CREATE ROLE ` + pq.QuoteIdentifier(spec.Username) + ` WITH LOGIN PASSWORD ` + literal,
+		Secret:      literal,
+		Description: fmt.Sprintf("create user '%s'", spec.Username),
+	}}, nil
+}
+
+// SetPassword changes the password of an existing user
+func (p *PostgreSQL) SetPassword(ctx context.Context, username, password string) (err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "SetPassword", "set_password")
+	defer end(&err)
+
+	plan, err := p.PlanSetPassword(ctx, username, password)
+	if err != nil {
+		return err
+	}
+
+	return p.Execute(ctx, plan)
+}
+
+// PlanSetPassword plans changing the password of an existing user
+func (p *PostgreSQL) PlanSetPassword(_ context.Context, username, password string) (Plan, error) {
+	literal := pq.QuoteLiteral(password)
+	return Plan{{
+		Kind:        "ALTER ROLE",
+		Database:    "postgres",
+		Query:       `ALTER ROLE ` + pq.QuoteIdentifier(username) + ` WITH PASSWORD ` + literal,
+		Secret:      literal,
+		Description: fmt.Sprintf("set password of user '%s'", username),
+	}}, nil
+}
+
+// DropUser drops the user unless it does not exist and reports whether it was dropped
+func (p *PostgreSQL) DropUser(ctx context.Context, username string) (dropped bool, err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "DropUser", "drop_user")
+	defer end(&err)
+
+	plan, err := p.PlanDropUser(ctx, username)
+	if err != nil {
+		return false, err
+	}
+
+	return len(plan) > 0, p.Execute(ctx, plan)
+}
+
+// PlanDropUser plans dropping the user, which is empty if it does not exist
+func (p *PostgreSQL) PlanDropUser(ctx context.Context, username string) (Plan, error) {
+	db, err := p.connect("postgres")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var exists bool
+	if err := db.queryRow(ctx, "SELECT", `SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)`, username).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("Failed to look up user '%s': %w", username, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	databases, err := queryStrings(ctx, db, `SELECT datname FROM pg_database WHERE datallowconn ORDER BY datname`)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list databases of '%s': %w", p.Host, err)
+	}
+
+	return p.dropUserStatements(username, databases), nil
+}
+
+// dropUserStatements drops the user after handing the objects it owns in each database over to
+// the superuser and revoking its privileges there, as a role cannot be dropped while anything
+// in any database depends on it
+func (p *PostgreSQL) dropUserStatements(username string, databases []string) Plan {
+	role := pq.QuoteIdentifier(username)
+
+	plan := Plan{}
+	for _, database := range databases {
+		plan = append(plan, Statement{
+			Kind:        "REASSIGN OWNED",
+			Database:    database,
+			Query:       `REASSIGN OWNED BY ` + role + ` TO ` + pq.QuoteIdentifier(p.Superuser),
+			Description: fmt.Sprintf("reassign objects of user '%s' in database '%s'", username, database),
+		}, Statement{
+			Kind:        "DROP OWNED",
+			Database:    database,
+			Query:       `DROP OWNED BY ` + role,
+			Description: fmt.Sprintf("revoke privileges of user '%s' in database '%s'", username, database),
+		})
+	}
+
+	return append(plan, Statement{
+		Kind:        "DROP ROLE",
+		Database:    "postgres",
+		Query:       `DROP ROLE IF EXISTS ` + role,
+		Description: fmt.Sprintf("drop user '%s'", username),
+	})
+}
+
+// GrantPrivileges grants the privileges to the user
+func (p *PostgreSQL) GrantPrivileges(ctx context.Context, username string, privileges []v1beta1.Privilege) (err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "GrantPrivileges", "grant_privileges")
+	defer end(&err)
+
+	plan, err := p.PlanGrantPrivileges(ctx, username, privileges)
+	if err != nil {
+		return err
+	}
+
+	return p.Execute(ctx, plan)
+}
+
+// PlanGrantPrivileges plans granting the privileges to the user
+func (p *PostgreSQL) PlanGrantPrivileges(_ context.Context, username string, privileges []v1beta1.Privilege) (Plan, error) {
+	return p.planPrivileges("GRANT", "TO", username, privileges)
+}
+
+// RevokePrivileges revokes the privileges from the user
+func (p *PostgreSQL) RevokePrivileges(ctx context.Context, username string, privileges []v1beta1.Privilege) (err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "RevokePrivileges", "revoke_privileges")
+	defer end(&err)
+
+	plan, err := p.PlanRevokePrivileges(ctx, username, privileges)
+	if err != nil {
+		return err
+	}
+
+	return p.Execute(ctx, plan)
+}
+
+// PlanRevokePrivileges plans revoking the privileges from the user
+func (p *PostgreSQL) PlanRevokePrivileges(_ context.Context, username string, privileges []v1beta1.Privilege) (Plan, error) {
+	return p.planPrivileges("REVOKE", "FROM", username, privileges)
+}
+
+func (p *PostgreSQL) planPrivileges(command, preposition, username string, privileges []v1beta1.Privilege) (Plan, error) {
+	plan := Plan{}
+	for _, privilege := range privileges {
+		statement, err := p.privilegeStatement(command, preposition, username, privilege)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, statement)
+	}
+
+	return plan, nil
+}
+
+func (p *PostgreSQL) privilegeStatement(command, preposition, username string, privilege v1beta1.Privilege) (Statement, error) {
+	objectType, ok := postgresObjectTypes[strings.ToLower(privilege.ObjectType)]
+	if !ok {
+		return Statement{}, fmt.Errorf("Unsupported object type '%s'", privilege.ObjectType)
+	}
+
+	for _, name := range privilege.Privileges {
+		if !privilegePattern.MatchString(name) {
+			return Statement{}, fmt.Errorf("Invalid privilege '%s'", name)
+		}
+	}
+
+	// privileges on objects inside a database have to be granted from within that database
+	database := "postgres"
+	if objectType != "DATABASE" {
+		if privilege.Database == "" {
+			return Statement{}, fmt.Errorf("Privileges on %s '%s' require a database", privilege.ObjectType, privilege.ObjectName)
+		}
+		database = privilege.Database
+	}
+
+	return Statement{
+		Kind:     command,
+		Database: database,
+		Query: fmt.Sprintf("%s %s ON %s %s %s %s", command,
+			strings.ToUpper(strings.Join(privilege.Privileges, ", ")),
+			objectType, quoteQualifiedIdentifier(privilege.ObjectName),
+			preposition, pq.QuoteIdentifier(username)),
+		Description: fmt.Sprintf("%s privileges on %s '%s' for user '%s'",
+			strings.ToLower(command), privilege.ObjectType, privilege.ObjectName, username),
+	}, nil
+}
+
+// RunScript executes the script inside the database in a single transaction,
+// as the given role unless it is empty
+func (p *PostgreSQL) RunScript(ctx context.Context, database, role string, script Script) (err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "RunScript", "run_script")
+	defer end(&err)
+
+	plan, err := p.PlanRunScript(ctx, database, role, script)
+	if err != nil {
+		return err
+	}
+
+	return p.Execute(ctx, plan)
+}
+
+// PlanRunScript plans the execution of the script inside the database
+func (p *PostgreSQL) PlanRunScript(_ context.Context, database, role string, script Script) (Plan, error) {
+	query := script.Content
+	if role != "" {
+		// the statements of a single query run in one transaction, which resets the role
+		// at its end, so the pooled connection is not left with the role of the owner
+		query = "SET LOCAL ROLE " + pq.QuoteIdentifier(role) + ";\n" + query
+	}
+
+	statement := Statement{
+		Kind:        "SCRIPT",
+		Database:    database,
+		Query:       query,
+		Description: fmt.Sprintf("run script '%s' in database '%s'", script.Name, database),
+	}
+	if script.Sensitive {
+		statement.Secret = script.Content
+	}
+
+	return Plan{statement}, nil
+}
+
+// AppliedMigrations returns the migrations recorded in the tracking table of the database
+// ordered by their version, none if the table does not exist yet
+func (p *PostgreSQL) AppliedMigrations(ctx context.Context, database, table string) (applied []v1beta1.AppliedMigration, err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "AppliedMigrations", "applied_migrations")
+	defer end(&err)
+
+	db, err := p.connect(database)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var exists bool
+	if err := db.queryRow(ctx, "SELECT", `SELECT to_regclass($1) IS NOT NULL`, quoteQualifiedIdentifier(table)).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("Failed to look up migration table '%s': %w", table, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	rows, err := db.query(ctx, "SELECT", `SELECT version, name, checksum, applied_at FROM `+quoteQualifiedIdentifier(table)+` ORDER BY version`)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read migration table '%s': %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var migration v1beta1.AppliedMigration
+		var appliedAt time.Time
+		if err := rows.Scan(&migration.Version, &migration.Name, &migration.Checksum, &appliedAt); err != nil {
+			return nil, fmt.Errorf("Failed to read migration table '%s': %w", table, err)
+		}
+		migration.AppliedAt = &metav1.Time{Time: appliedAt}
+		applied = append(applied, migration)
+	}
+
+	return applied, rows.Err()
+}
+
+// Migrate applies the migrations to the database in order as the given role unless it is empty.
+// Each migration runs in its own transaction together with its record in the tracking table.
+// A session level advisory lock keeps concurrent runs against the same table apart,
+// ErrMigrationLocked is returned while another run holds it. Migrations recorded by a
+// run which finished before the lock was taken are skipped.
+func (p *PostgreSQL) Migrate(ctx context.Context, database, role, table string, migrations []Migration) (err error) {
+	ctx, end := startOperation(ctx, p.DatabaseHostSpec, "Migrate", "migrate")
+	defer end(&err)
+
+	db, err := p.connect(database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// the lock belongs to the session, so it is held by a dedicated connection for the whole run
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to connect to database '%s': %w", database, err)
+	}
+	defer conn.Close()
+
+	key := "migrations/" + table
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, key).Scan(&locked); err != nil {
+		return fmt.Errorf("Failed to lock migration table '%s': %w", table, err)
+	}
+	if !locked {
+		return ErrMigrationLocked
+	}
+	defer func() {
+		// a pooled connection keeps the lock until it is released, even when the run was cancelled
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, key); err != nil {
+			log.FromContext(ctx).Error(err, "unable to unlock migration table", "table", table)
+		}
+	}()
+
+	// another run may have applied some of the migrations between reading and locking the table
+	applied, err := appliedVersions(ctx, conn, table)
+	if err != nil {
+		return err
+	}
+	pending := make([]Migration, 0, len(migrations))
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+
+	plan, err := p.PlanMigrate(ctx, database, role, table, pending)
+	if err != nil {
+		return err
+	}
+
+	// the statements run on the locked connection, another one from the pool may not be available
+	for _, statement := range plan {
+		if err := p.pools.wait(ctx, p.host); err != nil {
+			return err
+		}
+
+		err := db.executeOn(ctx, conn, statement)
+		p.pools.observe(p.host, err)
+		if err != nil {
+			return fmt.Errorf("Failed to %s: %w", statement.Description, err)
+		}
+	}
+
 	return nil
 }
+
+// appliedVersions returns the versions recorded in the tracking table, none if the table does not exist yet
+func appliedVersions(ctx context.Context, conn *sql.Conn, table string) (map[int64]bool, error) {
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, quoteQualifiedIdentifier(table)).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("Failed to look up migration table '%s': %w", table, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM `+quoteQualifiedIdentifier(table))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read migration table '%s': %w", table, err)
+	}
+	defer rows.Close()
+
+	applied := map[int64]bool{}
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("Failed to read migration table '%s': %w", table, err)
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// PlanMigrate plans the creation of the tracking table and the application of the migrations
+func (p *PostgreSQL) PlanMigrate(_ context.Context, database, role, table string, migrations []Migration) (Plan, error) {
+	// the statements of a single query run in one transaction, which resets the role at its end
+	var prefix string
+	if role != "" {
+		prefix = "SET LOCAL ROLE " + pq.QuoteIdentifier(role) + ";\n"
+	}
+
+	plan := Plan{
+		{
+			Kind:        "CREATE TABLE",
+			Database:    database,
+			Query:       prefix + `CREATE TABLE IF NOT EXISTS ` + quoteQualifiedIdentifier(table) + ` (version bigint PRIMARY KEY, name text NOT NULL, checksum text NOT NULL, applied_at timestamptz NOT NULL DEFAULT now())`,
+			Description: fmt.Sprintf("create migration table '%s' in database '%s'", table, database),
+		},
+	}
+	for _, migration := range migrations {
+		record := fmt.Sprintf(`INSERT INTO %s (version, name, checksum) VALUES (%d, %s, %s)`,
+			quoteQualifiedIdentifier(table), migration.Version, pq.QuoteLiteral(migration.Name), pq.QuoteLiteral(migration.Checksum))
+		plan = append(plan, Statement{
+			Kind:        "MIGRATION",
+			Database:    database,
+			Query:       prefix + migration.Content + "\n;\n" + record,
+			Description: fmt.Sprintf("apply migration %d '%s' to database '%s'", migration.Version, migration.Name, database),
+		})
+	}
+
+	return plan, nil
+}
+
+// quoteQualifiedIdentifier quotes every part of a dot separated identifier like schema.table
+func quoteQualifiedIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = pq.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
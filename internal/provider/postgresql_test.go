@@ -0,0 +1,227 @@
+package provider
+
+import (
+	"context"
+	"database/sql"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+
+	"github.com/tuunit/external-database-operator/api/v1"
+	"github.com/tuunit/external-database-operator/api/v1beta1"
+	"github.com/tuunit/external-database-operator/internal/audit"
+)
+
+// recordingSink keeps the audit records in memory
+type recordingSink struct {
+	records []audit.Record
+}
+
+func (s *recordingSink) Write(_ context.Context, record audit.Record) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+var _ = Describe("PostgreSQL", func() {
+	// nothing listens on port 1, so every statement fails right away
+	spec := v1.DatabaseHostSpec{
+		Host:      "127.0.0.1",
+		Port:      1,
+		Type:      v1.Postgres,
+		Superuser: "postgres",
+		Password:  "s3cr3t",
+	}
+
+	var sink *recordingSink
+	var client *PostgreSQL
+
+	BeforeEach(func() {
+		sink = &recordingSink{}
+		client = NewPostgresClient(spec, sink)
+	})
+
+	spans := func() map[string]tracetest.SpanStub {
+		spans := map[string]tracetest.SpanStub{}
+		for _, span := range exporter.GetSpans() {
+			spans[span.Name] = span
+		}
+		return spans
+	}
+
+	Context("When tracing provider operations", func() {
+		It("should start a span per operation tagged with host and engine", func() {
+			Expect(client.CheckConnection(context.Background())).NotTo(Succeed())
+
+			span, ok := spans()["CheckConnection"]
+			Expect(ok).To(BeTrue())
+			Expect(span.Attributes).To(ContainElements(
+				semconv.DBSystemPostgreSQL,
+				semconv.ServerAddress("127.0.0.1"),
+				semconv.ServerPort(1),
+			))
+			Expect(span.Status.Code).To(Equal(codes.Error))
+		})
+
+		It("should start a child span per statement tagged with its kind", func() {
+			_, err := client.CreateDB(context.Background(), &v1beta1.DatabaseSpec{Name: "test"})
+			Expect(err).To(HaveOccurred())
+
+			spans := spans()
+			operation, ok := spans["CreateDB"]
+			Expect(ok).To(BeTrue())
+			statement, ok := spans["SELECT"]
+			Expect(ok).To(BeTrue())
+
+			Expect(statement.Parent.SpanID()).To(Equal(operation.SpanContext.SpanID()))
+			Expect(statement.Attributes).To(ContainElements(
+				semconv.DBSystemPostgreSQL,
+				semconv.DBName("postgres"),
+				semconv.DBOperation("SELECT"),
+			))
+			Expect(statement.Status.Code).To(Equal(codes.Error))
+		})
+
+		It("should never tag spans with statement values", func() {
+			_, err := client.CreateUser(context.Background(), &v1beta1.DatabaseUserSpec{Username: "alice"}, "hunter2")
+			Expect(err).To(HaveOccurred())
+
+			for _, span := range exporter.GetSpans() {
+				for _, attribute := range span.Attributes {
+					Expect(attribute.Value.Emit()).NotTo(ContainSubstring("alice"))
+					Expect(attribute.Value.Emit()).NotTo(ContainSubstring("hunter2"))
+					Expect(attribute.Value.Emit()).NotTo(ContainSubstring("s3cr3t"))
+				}
+			}
+		})
+	})
+
+	Context("When auditing statements", func() {
+		It("should record executed statements with their outcome", func() {
+			err := client.GrantPrivileges(context.Background(), "alice", []v1beta1.Privilege{{
+				ObjectType: "database",
+				ObjectName: "test",
+				Privileges: []string{"CONNECT"},
+			}})
+			Expect(err).To(HaveOccurred())
+
+			Expect(sink.records).To(HaveLen(1))
+			record := sink.records[0]
+			Expect(record.Kind).To(Equal("GRANT"))
+			Expect(record.Statement).To(Equal(`GRANT CONNECT ON DATABASE "test" TO "alice"`))
+			Expect(record.Address).To(Equal("127.0.0.1"))
+			Expect(record.Engine).To(Equal(string(v1.Postgres)))
+			Expect(record.Outcome).To(Equal(audit.OutcomeError))
+			Expect(record.Error).NotTo(BeEmpty())
+		})
+
+		It("should redact secrets", func() {
+			db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable")
+			Expect(err).NotTo(HaveOccurred())
+			defer db.Close()
+
+			s := newSession(db, spec, "postgres", sink)
+			Expect(s.execute(context.Background(), Statement{
+				Kind:   "ALTER ROLE",
+				Query:  `ALTER ROLE "alice" WITH PASSWORD 'hunter2'`,
+				Secret: `'hunter2'`,
+			})).NotTo(Succeed())
+
+			Expect(sink.records).To(HaveLen(1))
+			Expect(sink.records[0].Statement).To(Equal(`ALTER ROLE "alice" WITH PASSWORD ` + audit.Redacted))
+		})
+	})
+
+	Context("When planning statements", func() {
+		It("should plan without touching the host", func() {
+			plan, err := client.PlanGrantPrivileges(context.Background(), "alice", []v1beta1.Privilege{
+				{ObjectType: "database", ObjectName: "app", Privileges: []string{"connect"}},
+				{ObjectType: "table", ObjectName: "public.orders", Database: "app", Privileges: []string{"SELECT", "INSERT"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Strings()).To(Equal([]string{
+				`GRANT CONNECT ON DATABASE "app" TO "alice"`,
+				`GRANT SELECT, INSERT ON TABLE "public"."orders" TO "alice"`,
+			}))
+			Expect(plan[1].Database).To(Equal("app"))
+			Expect(sink.records).To(BeEmpty())
+		})
+
+		It("should reject invalid privileges", func() {
+			_, err := client.PlanRevokePrivileges(context.Background(), "alice", []v1beta1.Privilege{
+				{ObjectType: "table", ObjectName: "orders", Privileges: []string{"SELECT"}},
+			})
+			Expect(err).To(MatchError(ContainSubstring("require a database")))
+
+			_, err = client.PlanRevokePrivileges(context.Background(), "alice", []v1beta1.Privilege{
+				{ObjectType: "database", ObjectName: "app", Privileges: []string{"ALL; DROP"}},
+			})
+			Expect(err).To(MatchError(ContainSubstring("Invalid privilege")))
+		})
+
+		It("should redact secrets from planned statements", func() {
+			plan, err := client.PlanSetPassword(context.Background(), "alice", "hunter2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Strings()).To(Equal([]string{`ALTER ROLE "alice" WITH PASSWORD ` + audit.Redacted}))
+			Expect(plan[0].Query).To(ContainSubstring("hunter2"))
+		})
+
+		It("should run scripts as the given role", func() {
+			plan, err := client.PlanRunScript(context.Background(), "app", "alice", Script{Name: "seed", Content: "INSERT INTO colors VALUES ('red');"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Strings()).To(Equal([]string{"SET LOCAL ROLE \"alice\";\nINSERT INTO colors VALUES ('red');"}))
+			Expect(plan[0].Database).To(Equal("app"))
+
+			plan, err = client.PlanRunScript(context.Background(), "app", "", Script{Name: "seed", Content: "SELECT 'hunter2';", Sensitive: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Strings()).To(Equal([]string{audit.Redacted}))
+		})
+
+		It("should drop databases in the dialect of the server", func() {
+			plan := client.dropStatements(v1.ServerInfo{VersionNumber: 160002}, "app")
+			Expect(plan.Strings()).To(Equal([]string{`DROP DATABASE IF EXISTS "app" WITH (FORCE)`}))
+
+			plan = client.dropStatements(v1.ServerInfo{VersionNumber: 120018}, "app")
+			Expect(plan).To(HaveLen(2))
+			Expect(plan[0].Query).To(HavePrefix("SELECT pg_terminate_backend(pid)"))
+			Expect(plan[1].Query).To(Equal(`DROP DATABASE IF EXISTS "app"`))
+		})
+
+		It("should inherit the locale of the template without a collation", func() {
+			server := v1.ServerInfo{VersionNumber: 160002}
+			Expect(localeClause(server, "UTF8", v1.Postgres.DefaultCollation(), v1beta1.LocaleProviderLibc)).To(Equal(` ENCODING 'UTF8'`))
+			Expect(localeClause(server, "UTF8", "C.UTF-8", v1beta1.LocaleProviderLibc)).
+				To(Equal(` ENCODING 'UTF8' LOCALE_PROVIDER libc LC_COLLATE 'C.UTF-8' LC_CTYPE 'C.UTF-8'`))
+		})
+
+		It("should hand over the objects of a user before dropping it", func() {
+			plan := client.dropUserStatements("alice", []string{"app", "postgres"})
+			Expect(plan.Strings()).To(Equal([]string{
+				`REASSIGN OWNED BY "alice" TO "postgres"`,
+				`DROP OWNED BY "alice"`,
+				`REASSIGN OWNED BY "alice" TO "postgres"`,
+				`DROP OWNED BY "alice"`,
+				`DROP ROLE IF EXISTS "alice"`,
+			}))
+			Expect(plan[0].Database).To(Equal("app"))
+			Expect(plan[2].Database).To(Equal("postgres"))
+		})
+
+		It("should name the collation providers of the server", func() {
+			Expect(collationProviders([]string{"c", "d", "i"})).To(Equal([]string{v1.CollationProviderLibc, v1.CollationProviderICU}))
+		})
+
+		It("should record each migration in the transaction applying it", func() {
+			plan, err := client.PlanMigrate(context.Background(), "app", "", "app.schema_migrations", []Migration{
+				{Version: 1, Name: "create_users", Content: "CREATE TABLE users (id bigint);", Checksum: "abc"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan).To(HaveLen(2))
+			Expect(plan[0].Query).To(HavePrefix(`CREATE TABLE IF NOT EXISTS "app"."schema_migrations"`))
+			Expect(plan[1].Query).To(Equal("CREATE TABLE users (id bigint);\n;\n" +
+				`INSERT INTO "app"."schema_migrations" (version, name, checksum) VALUES (1, 'create_users', 'abc')`))
+		})
+	})
+})
@@ -1,12 +1,65 @@
 package provider
 
 import (
-	"github.com/tuunit/external-database-operator/api/v1alpha1"
+	"context"
+	"errors"
+
+	"github.com/tuunit/external-database-operator/api/v1"
+	"github.com/tuunit/external-database-operator/api/v1beta1"
 )
 
+// ErrMigrationLocked is returned by Migrate while another run holds the lock of the tracking table
+var ErrMigrationLocked = errors.New("Migrations are locked by another run")
+
+// ErrMigrationsUnsupported is returned by the migration methods of hosts which cannot track migrations yet
+var ErrMigrationsUnsupported = errors.New("Migrations are not supported")
+
+// Stats are the size and the activity of a database
+type Stats struct {
+	// SizeBytes is the size of the database on disk
+	SizeBytes int64
+	// Connections is the number of sessions connected to the database
+	Connections int64
+	// Commits is the number of committed transactions since the statistics of the host were reset,
+	// nil if the engine does not count them per database
+	Commits *int64
+	// Deadlocks is the number of deadlocks since the statistics of the host were reset,
+	// nil if the engine does not count them per database
+	Deadlocks *int64
+}
+
+// DatabaseProvider manages databases and users on a host. Every method changing the host
+// has a Plan counterpart, which only computes the statements the method would execute.
 type DatabaseProvider interface {
-	CheckConnection() error
-	CreateDB(spec *v1alpha1.DatabaseSpec) error
-	CreateUser(spec *v1alpha1.DatabaseUserSpec) error
-	CreateRole() error
+	CheckConnection(ctx context.Context) error
+	DiscoverServer(ctx context.Context) (v1.ServerInfo, error)
+	CreateDB(ctx context.Context, spec *v1beta1.DatabaseSpec) (bool, error)
+	CreateDBFromTemplate(ctx context.Context, spec *v1beta1.DatabaseSpec, template string) (bool, error)
+	RenameDB(ctx context.Context, from, to string) error
+	DropDB(ctx context.Context, name string) (bool, error)
+	DatabaseStats(ctx context.Context, name string) (Stats, error)
+	DatabaseEmpty(ctx context.Context, name string) (bool, error)
+	CreateUser(ctx context.Context, spec *v1beta1.DatabaseUserSpec, password string) (bool, error)
+	SetPassword(ctx context.Context, username, password string) error
+	DropUser(ctx context.Context, username string) (bool, error)
+	GrantPrivileges(ctx context.Context, username string, privileges []v1beta1.Privilege) error
+	RevokePrivileges(ctx context.Context, username string, privileges []v1beta1.Privilege) error
+	RunScript(ctx context.Context, database, role string, script Script) error
+	AppliedMigrations(ctx context.Context, database, table string) ([]v1beta1.AppliedMigration, error)
+	Migrate(ctx context.Context, database, role, table string, migrations []Migration) error
+
+	PlanCreateDB(ctx context.Context, spec *v1beta1.DatabaseSpec) (Plan, error)
+	PlanCreateDBFromTemplate(ctx context.Context, spec *v1beta1.DatabaseSpec, template string) (Plan, error)
+	PlanRenameDB(ctx context.Context, from, to string) (Plan, error)
+	PlanDropDB(ctx context.Context, name string) (Plan, error)
+	PlanCreateUser(ctx context.Context, spec *v1beta1.DatabaseUserSpec, password string) (Plan, error)
+	PlanSetPassword(ctx context.Context, username, password string) (Plan, error)
+	PlanDropUser(ctx context.Context, username string) (Plan, error)
+	PlanGrantPrivileges(ctx context.Context, username string, privileges []v1beta1.Privilege) (Plan, error)
+	PlanRevokePrivileges(ctx context.Context, username string, privileges []v1beta1.Privilege) (Plan, error)
+	PlanRunScript(ctx context.Context, database, role string, script Script) (Plan, error)
+	PlanMigrate(ctx context.Context, database, role, table string, migrations []Migration) (Plan, error)
+	Execute(ctx context.Context, plan Plan) error
 }
+
+var _ DatabaseProvider = &PostgreSQL{}
@@ -0,0 +1,161 @@
+package provider
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/tuunit/external-database-operator/api/v1"
+	"github.com/tuunit/external-database-operator/internal/audit"
+	"github.com/tuunit/external-database-operator/internal/metrics"
+	"github.com/tuunit/external-database-operator/internal/tracing"
+)
+
+// session is a connection to a single database of a host which traces the statements
+// it executes and records the ones changing the host in the audit log
+type session struct {
+	*sql.DB
+	spec       v1.DatabaseHostSpec
+	database   string
+	sink       audit.Sink
+	attributes []attribute.KeyValue
+	// release gives back the borrowed pool, it runs at most once however often the session is closed
+	release func()
+}
+
+func newSession(db *sql.DB, spec v1.DatabaseHostSpec, database string, sink audit.Sink) *session {
+	return &session{
+		DB:         db,
+		spec:       spec,
+		database:   database,
+		sink:       sink,
+		attributes: append(hostAttributes(spec), semconv.DBName(database)),
+	}
+}
+
+// Close closes the connection unless it belongs to a shared pool, which is given back for the next session
+func (s *session) Close() error {
+	if s.release != nil {
+		s.release()
+		return nil
+	}
+	return s.DB.Close()
+}
+
+// execer runs statements, it is either the pool of a session or a single connection taken from it
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// execute executes the statement in its own span, which is tagged with the kind of the
+// statement like CREATE DATABASE but never with the statement itself or its values
+func (s *session) execute(ctx context.Context, statement Statement) error {
+	return s.executeOn(ctx, s.DB, statement)
+}
+
+// executeOn executes the statement like execute on the given connection of the session
+func (s *session) executeOn(ctx context.Context, conn execer, statement Statement) error {
+	ctx, span := s.start(ctx, statement.Kind)
+	defer span.End()
+
+	start := time.Now()
+	_, err := conn.ExecContext(ctx, statement.Query)
+	tracing.RecordError(span, err)
+
+	s.audit(ctx, statement, start, err)
+
+	return err
+}
+
+// audit hands the executed statement to the sink, failing to record it does not fail the statement
+func (s *session) audit(ctx context.Context, statement Statement, start time.Time, err error) {
+	if s.sink == nil {
+		return
+	}
+
+	record := audit.Record{
+		Time:            start.UTC(),
+		Source:          audit.SourceFrom(ctx),
+		Address:         s.spec.Host,
+		Engine:          string(s.spec.Type),
+		Database:        s.database,
+		Kind:            statement.Kind,
+		Statement:       statement.String(),
+		Outcome:         audit.OutcomeSuccess,
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+	if err != nil {
+		record.Outcome = audit.OutcomeError
+		record.Error = err.Error()
+	}
+
+	if err := s.sink.Write(ctx, record); err != nil {
+		log.FromContext(ctx).Error(err, "unable to write audit record")
+	}
+}
+
+// queryRow runs the query in its own span, which is tagged like the spans of exec
+func (s *session) queryRow(ctx context.Context, kind, query string, args ...any) *sql.Row {
+	ctx, span := s.start(ctx, kind)
+	defer span.End()
+
+	row := s.QueryRowContext(ctx, query, args...)
+	tracing.RecordError(span, row.Err())
+
+	return row
+}
+
+// query runs the query in its own span, which is tagged like the spans of exec
+func (s *session) query(ctx context.Context, kind, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := s.start(ctx, kind)
+	defer span.End()
+
+	rows, err := s.QueryContext(ctx, query, args...)
+	tracing.RecordError(span, err)
+
+	return rows, err
+}
+
+func (s *session) start(ctx context.Context, kind string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, kind,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(s.attributes...),
+		trace.WithAttributes(semconv.DBOperation(kind)))
+}
+
+// startOperation starts the span of the provider operation name and returns a function ending it.
+// The function records the outcome in the span and the operation metrics under the metric label
+// and is meant to be deferred with a pointer to the named error result of the operation.
+func startOperation(ctx context.Context, spec v1.DatabaseHostSpec, name, metric string) (context.Context, func(*error)) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, name, trace.WithAttributes(hostAttributes(spec)...))
+
+	return ctx, func(err *error) {
+		metrics.ObserveOperation(string(spec.Type), metric, start, err)
+		tracing.RecordError(span, *err)
+		span.End()
+	}
+}
+
+// hostAttributes returns the span attributes identifying the host and its engine
+func hostAttributes(spec v1.DatabaseHostSpec) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		semconv.ServerAddress(spec.Host),
+		semconv.ServerPort(int(spec.EffectivePort())),
+	}
+
+	switch spec.Type {
+	case v1.MySQL:
+		attributes = append(attributes, semconv.DBSystemMySQL)
+	case v1.Postgres:
+		attributes = append(attributes, semconv.DBSystemPostgreSQL)
+	}
+
+	return attributes
+}
@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"strings"
+
+	"github.com/tuunit/external-database-operator/internal/audit"
+)
+
+// Statement is a single statement a provider executes against a host
+type Statement struct {
+	// Kind is the kind of the statement like CREATE DATABASE or GRANT
+	Kind string
+	// Database is the database the statement has to be executed in
+	Database string
+	// Query is the statement itself
+	Query string
+	// Secret is the literal of the query holding a secret like a password, it is redacted whenever the statement is shown
+	Secret string
+	// Description describes the effect of the statement like "create database 'app'"
+	Description string
+}
+
+// String returns the query with its secret redacted
+func (s Statement) String() string {
+	if s.Secret == "" {
+		return s.Query
+	}
+	return strings.ReplaceAll(s.Query, s.Secret, audit.Redacted)
+}
+
+// Script is a SQL script of the user which is executed inside a database
+type Script struct {
+	// Name identifies the script in the description of its statement
+	Name string
+	// Content are the statements of the script
+	Content string
+	// Sensitive redacts the content whenever the statement is shown
+	Sensitive bool
+}
+
+// Migration is a versioned schema migration which is applied once to a database
+type Migration struct {
+	// Version orders the migrations, it is recorded in the tracking table once the migration is applied
+	Version int64
+	// Name is the name of the migration without its version
+	Name string
+	// Content are the statements of the migration
+	Content string
+	// Checksum is the SHA-256 checksum of the content
+	Checksum string
+}
+
+// Plan is the ordered list of statements which brings a host to the desired state.
+// Planning only reads the state of the host, nothing is changed until the plan is executed.
+type Plan []Statement
+
+// Strings returns the statements of the plan with their secrets redacted
+func (p Plan) Strings() []string {
+	statements := make([]string, 0, len(p))
+	for _, statement := range p {
+		statements = append(statements, statement.String())
+	}
+	return statements
+}
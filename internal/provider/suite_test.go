@@ -0,0 +1,30 @@
+package provider
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// These tests use Ginkgo (BDD-style Go testing framework). Refer to
+// http://onsi.github.io/ginkgo/ to learn more about Ginkgo.
+
+var exporter = tracetest.NewInMemoryExporter()
+
+func TestProvider(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Provider Suite")
+}
+
+var _ = BeforeSuite(func() {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+})
+
+var _ = BeforeEach(func() {
+	exporter.Reset()
+})
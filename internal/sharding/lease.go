@@ -0,0 +1,184 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;create;update;delete
+
+const (
+	// leasePrefix is the prefix of the names of all Leases used for sharding
+	leasePrefix = "external-database-operator"
+	// LabelMember marks the Leases announcing the replicas
+	LabelMember = "k8s.tuunit.com/shard-member"
+)
+
+func (s *Sharder) memberLease() string {
+	return fmt.Sprintf("%s-member-%s", leasePrefix, s.options.Identity)
+}
+
+func (s *Sharder) shardLease(shard int) string {
+	return fmt.Sprintf("%s-shard-%d", leasePrefix, shard)
+}
+
+// renewMember creates or renews the Lease announcing the replica
+func (s *Sharder) renewMember(ctx context.Context) error {
+	lease := &coordinationv1.Lease{}
+	err := s.reader.Get(ctx, client.ObjectKey{Namespace: s.options.Namespace, Name: s.memberLease()}, lease)
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.memberLease(),
+				Namespace: s.options.Namespace,
+				Labels:    map[string]string{LabelMember: "true"},
+			},
+		}
+		s.hold(lease)
+		return s.writer.Create(ctx, lease)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.hold(lease)
+	return s.writer.Update(ctx, lease)
+}
+
+// members returns the sorted identities of the live replicas
+func (s *Sharder) members(ctx context.Context) ([]string, error) {
+	leases := &coordinationv1.LeaseList{}
+	if err := s.reader.List(ctx, leases, client.InNamespace(s.options.Namespace), client.MatchingLabels{LabelMember: "true"}); err != nil {
+		return nil, err
+	}
+
+	var members []string
+	for i := range leases.Items {
+		lease := &leases.Items[i]
+		if s.expired(lease) || lease.Spec.HolderIdentity == nil {
+			continue
+		}
+		members = append(members, *lease.Spec.HolderIdentity)
+	}
+
+	sort.Strings(members)
+	return members, nil
+}
+
+// syncShard renews or acquires the Lease of a wanted shard and releases the Lease of an unwanted one.
+// It reports whether the replica holds the Lease afterwards.
+func (s *Sharder) syncShard(ctx context.Context, shard int, wanted bool) (bool, error) {
+	lease := &coordinationv1.Lease{}
+	err := s.reader.Get(ctx, client.ObjectKey{Namespace: s.options.Namespace, Name: s.shardLease(shard)}, lease)
+	if apierrors.IsNotFound(err) {
+		if !wanted {
+			return false, nil
+		}
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.shardLease(shard),
+				Namespace: s.options.Namespace,
+			},
+		}
+		s.hold(lease)
+		// a conflict means another replica was faster
+		if err := s.writer.Create(ctx, lease); err != nil {
+			return false, client.IgnoreAlreadyExists(err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	holder := ptr.Deref(lease.Spec.HolderIdentity, "")
+	switch {
+	case holder == s.options.Identity && wanted:
+		s.hold(lease)
+	case holder == s.options.Identity:
+		lease.Spec.HolderIdentity = nil
+	case wanted && (holder == "" || s.expired(lease)):
+		// the shard is free or its previous owner is gone
+		s.hold(lease)
+		lease.Spec.AcquireTime = lease.Spec.RenewTime
+	default:
+		return false, nil
+	}
+
+	if err := s.writer.Update(ctx, lease); err != nil {
+		if apierrors.IsConflict(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return ptr.Deref(lease.Spec.HolderIdentity, "") == s.options.Identity, nil
+}
+
+// release gives up all shards and the membership of the replica
+func (s *Sharder) release(ctx context.Context) error {
+	s.mu.Lock()
+	owned := s.owned
+	s.owned = map[int]bool{}
+	s.mu.Unlock()
+
+	var errs []error
+	for shard, held := range owned {
+		if !held {
+			continue
+		}
+		if _, err := s.syncShard(ctx, shard, false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	member := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Name: s.memberLease(), Namespace: s.options.Namespace}}
+	errs = append(errs, client.IgnoreNotFound(s.writer.Delete(ctx, member)))
+
+	return errors.Join(errs...)
+}
+
+// hold makes the replica the holder of the Lease and renews it
+func (s *Sharder) hold(lease *coordinationv1.Lease) {
+	now := metav1.NewMicroTime(s.now())
+	lease.Spec.HolderIdentity = ptr.To(s.options.Identity)
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(s.options.LeaseDuration / time.Second))
+	lease.Spec.RenewTime = &now
+	if lease.Spec.AcquireTime == nil {
+		lease.Spec.AcquireTime = &now
+	}
+}
+
+// expired reports whether the holder of the Lease did not renew it in time
+func (s *Sharder) expired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	duration := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	return lease.Spec.RenewTime.Add(duration).Before(s.now())
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sharding spreads the reconciliation of DatabaseHosts and everything on them across
+// the replicas of the operator. Hosts are hashed into a fixed number of shards and every shard
+// is owned by at most one replica through a Lease. The replicas announce themselves with member
+// Leases and split the shards evenly between the live members, so shards move as replicas come
+// and go.
+package sharding
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// Options configures the sharding of the operator
+type Options struct {
+	// Shards is the number of shards the hosts are hashed into, sharding is disabled with zero
+	Shards int
+	// Namespace is the namespace of the Leases
+	Namespace string
+	// Identity identifies the replica, it has to be unique among the replicas
+	Identity string
+	// LeaseDuration is how long a replica keeps its Leases without renewing them
+	LeaseDuration time.Duration
+}
+
+// BindFlags binds the sharding options to the flag set
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	hostname, _ := os.Hostname()
+	fs.IntVar(&o.Shards, "shards", 0,
+		"The number of shards the database hosts are spread across. "+
+			"Every replica reconciles the hosts of the shards it owns, sharding is disabled with 0")
+	fs.StringVar(&o.Namespace, "shard-lease-namespace", os.Getenv("POD_NAMESPACE"),
+		"The namespace of the leases used for sharding")
+	fs.StringVar(&o.Identity, "shard-identity", hostname,
+		"The unique identity of the replica used for sharding")
+	fs.DurationVar(&o.LeaseDuration, "shard-lease-duration", 15*time.Second,
+		"How long a replica owns its shards without renewing their leases")
+}
+
+// Shard returns the shard of the host
+func Shard(namespace, host string, shards int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(namespace + "/" + host))
+	return int(hash.Sum32() % uint32(shards))
+}
+
+// Sharder keeps track of the shards owned by the replica.
+// A nil Sharder owns every host, so the reconcilers work the same without sharding.
+type Sharder struct {
+	options Options
+	reader  client.Reader
+	writer  client.Client
+	cache   client.Reader
+	now     func() time.Time
+
+	mu    sync.RWMutex
+	owned map[int]bool
+
+	// subscribers are notified about the objects in newly owned shards
+	subscribers []subscriber
+}
+
+type subscriber struct {
+	list   client.ObjectList
+	host   func(client.Object) string
+	events chan event.GenericEvent
+}
+
+// New returns a Sharder for the options, or nil if sharding is disabled.
+// The Leases are read through the reader and written through the writer,
+// the objects in newly owned shards are listed from the cache.
+func New(options Options, reader client.Reader, writer client.Client, cache client.Reader) (*Sharder, error) {
+	if options.Shards <= 0 {
+		return nil, nil
+	}
+	if options.Namespace == "" {
+		return nil, fmt.Errorf("Sharding requires a namespace for its leases")
+	}
+	if options.Identity == "" {
+		return nil, fmt.Errorf("Sharding requires an identity for the replica")
+	}
+
+	return &Sharder{
+		options: options,
+		reader:  reader,
+		writer:  writer,
+		cache:   cache,
+		now:     time.Now,
+		owned:   map[int]bool{},
+	}, nil
+}
+
+// Owns reports whether the replica reconciles the host and the databases and users on it
+func (s *Sharder) Owns(namespace, host string) bool {
+	if s == nil {
+		return true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.owned[Shard(namespace, host, s.options.Shards)]
+}
+
+// Source returns a source of the objects in the list which move into a shard owned by the replica,
+// so they are reconciled right away instead of at their next event. The host function returns the
+// name of the host of an object. Sources have to be created before the Sharder is started.
+func (s *Sharder) Source(list client.ObjectList, host func(client.Object) string) source.Source {
+	events := make(chan event.GenericEvent)
+	s.subscribers = append(s.subscribers, subscriber{list: list, host: host, events: events})
+	return &source.Channel{Source: events}
+}
+
+// NeedLeaderElection tells the manager to run the Sharder on every replica
+func (s *Sharder) NeedLeaderElection() bool {
+	return false
+}
+
+// Start keeps the Leases of the replica renewed and rebalances the shards until the context is done.
+// It then releases the Leases, so the remaining replicas take over right away.
+func (s *Sharder) Start(ctx context.Context) error {
+	log := logf.FromContext(ctx).WithName("sharding")
+
+	ticker := time.NewTicker(s.options.LeaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		acquired, err := s.sync(ctx)
+		if err != nil {
+			log.Error(err, "unable to sync shards")
+		}
+		if len(acquired) > 0 {
+			log.Info("Acquired shards", "shards", acquired)
+			s.notify(ctx, acquired)
+		}
+
+		select {
+		case <-ctx.Done():
+			// the manager context is done, but the leases still have to be released
+			if err := s.release(context.Background()); err != nil {
+				log.Error(err, "unable to release shards")
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync renews the membership of the replica, releases the shards it should no longer own and
+// acquires the free ones it should own. It returns the newly acquired shards.
+func (s *Sharder) sync(ctx context.Context) ([]int, error) {
+	if err := s.renewMember(ctx); err != nil {
+		return nil, err
+	}
+
+	members, err := s.members(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired []int
+	var errs []error
+	for shard := 0; shard < s.options.Shards; shard++ {
+		wanted := assigned(shard, members, s.options.Identity)
+
+		held, err := s.syncShard(ctx, shard, wanted)
+		if err != nil {
+			errs = append(errs, err)
+			// without a renewed lease the shard may already belong to another replica
+			held = false
+		}
+
+		s.mu.Lock()
+		if held && !s.owned[shard] {
+			acquired = append(acquired, shard)
+		}
+		s.owned[shard] = held
+		s.mu.Unlock()
+	}
+
+	return acquired, errors.Join(errs...)
+}
+
+// assigned reports whether the shard belongs to the member with the identity. The shards are
+// dealt out round-robin over the members sorted by identity.
+func assigned(shard int, members []string, identity string) bool {
+	index := sort.SearchStrings(members, identity)
+	if index == len(members) || members[index] != identity {
+		return false
+	}
+	return shard%len(members) == index
+}
+
+// notify sends the objects in the acquired shards to the subscribers
+func (s *Sharder) notify(ctx context.Context, shards []int) {
+	acquired := map[int]bool{}
+	for _, shard := range shards {
+		acquired[shard] = true
+	}
+
+	for _, subscriber := range s.subscribers {
+		list := subscriber.list.DeepCopyObject().(client.ObjectList)
+		if err := s.cache.List(ctx, list); err != nil {
+			logf.FromContext(ctx).Error(err, "unable to list objects of acquired shards")
+			continue
+		}
+
+		objects, err := meta.ExtractList(list)
+		if err != nil {
+			logf.FromContext(ctx).Error(err, "unable to list objects of acquired shards")
+			continue
+		}
+
+		for _, object := range objects {
+			obj, ok := object.(client.Object)
+			if !ok || !acquired[Shard(obj.GetNamespace(), subscriber.host(obj), s.options.Shards)] {
+				continue
+			}
+
+			select {
+			case subscriber.events <- event.GenericEvent{Object: obj}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
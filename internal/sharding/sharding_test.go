@@ -0,0 +1,139 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	k8sv1 "github.com/tuunit/external-database-operator/api/v1"
+)
+
+var _ = Describe("Sharder", func() {
+	const shards = 4
+
+	ctx := context.Background()
+
+	var c client.Client
+	var now time.Time
+
+	newSharder := func(identity string) *Sharder {
+		options := Options{Shards: shards, Namespace: "default", Identity: identity, LeaseDuration: 15 * time.Second}
+		sharder, err := New(options, c, c, c)
+		Expect(err).NotTo(HaveOccurred())
+		sharder.now = func() time.Time { return now }
+		return sharder
+	}
+
+	owned := func(sharder *Sharder) []int {
+		var owned []int
+		for shard, held := range sharder.owned {
+			if held {
+				owned = append(owned, shard)
+			}
+		}
+		return owned
+	}
+
+	BeforeEach(func() {
+		Expect(k8sv1.AddToScheme(scheme.Scheme)).To(Succeed())
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		now = time.Now()
+	})
+
+	It("is disabled without shards", func() {
+		sharder, err := New(Options{}, c, c, c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sharder).To(BeNil())
+		Expect(sharder.Owns("default", "postgres")).To(BeTrue())
+	})
+
+	It("hashes hosts into stable shards", func() {
+		Expect(Shard("default", "postgres", shards)).To(Equal(Shard("default", "postgres", shards)))
+		Expect(Shard("default", "postgres", shards)).To(BeNumerically("<", shards))
+	})
+
+	It("owns all shards as the only replica", func() {
+		a := newSharder("a")
+		acquired, err := a.sync(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(ConsistOf(0, 1, 2, 3))
+		Expect(a.Owns("default", "postgres")).To(BeTrue())
+	})
+
+	It("rebalances when replicas come and go", func() {
+		a := newSharder("a")
+		_, err := a.sync(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		// b joins, a hands over its shards before b can take them
+		b := newSharder("b")
+		_, err = b.sync(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owned(b)).To(BeEmpty())
+
+		_, err = a.sync(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owned(a)).To(ConsistOf(0, 2))
+
+		acquired, err := b.sync(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(ConsistOf(1, 3))
+
+		// b stops renewing its leases, a takes over once they expire
+		now = now.Add(time.Minute)
+		acquired, err = a.sync(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(ConsistOf(1, 3))
+		Expect(owned(a)).To(ConsistOf(0, 1, 2, 3))
+	})
+
+	It("releases its shards when stopped", func() {
+		a := newSharder("a")
+		_, err := a.sync(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(a.release(ctx)).To(Succeed())
+		Expect(a.Owns("default", "postgres")).To(BeFalse())
+
+		b := newSharder("b")
+		acquired, err := b.sync(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquired).To(ConsistOf(0, 1, 2, 3))
+	})
+
+	It("notifies about the objects in acquired shards", func() {
+		host := &k8sv1.DatabaseHost{ObjectMeta: metav1.ObjectMeta{Name: "postgres", Namespace: "default"}}
+		Expect(c.Create(ctx, host)).To(Succeed())
+
+		a := newSharder("a")
+		a.Source(&k8sv1.DatabaseHostList{}, client.Object.GetName)
+		events := a.subscribers[0].events
+
+		go a.notify(ctx, []int{Shard("default", "postgres", shards)})
+		var e event.GenericEvent
+		Eventually(events).Should(Receive(&e))
+		Expect(e.Object.GetName()).To(Equal("postgres"))
+	})
+})
@@ -0,0 +1,140 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// tracingClient starts a span for every request of the wrapped client
+type tracingClient struct {
+	client.Client
+}
+
+// Client wraps the client so requests to the API server, like Secret lookups
+// and status updates, show up as spans of the reconciliation they belong to
+func Client(c client.Client) client.Client {
+	return &tracingClient{c}
+}
+
+func (c *tracingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) (err error) {
+	ctx, span := c.start(ctx, "Get", obj, key.Namespace, key.Name)
+	defer end(span, &err)
+
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *tracingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) (err error) {
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+
+	ctx, span := c.start(ctx, "List", list, listOpts.Namespace, "")
+	defer end(span, &err)
+
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c *tracingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) (err error) {
+	ctx, span := c.start(ctx, "Create", obj, obj.GetNamespace(), obj.GetName())
+	defer end(span, &err)
+
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) (err error) {
+	ctx, span := c.start(ctx, "Update", obj, obj.GetNamespace(), obj.GetName())
+	defer end(span, &err)
+
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) (err error) {
+	ctx, span := c.start(ctx, "Patch", obj, obj.GetNamespace(), obj.GetName())
+	defer end(span, &err)
+
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *tracingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) (err error) {
+	ctx, span := c.start(ctx, "Delete", obj, obj.GetNamespace(), obj.GetName())
+	defer end(span, &err)
+
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Status() client.SubResourceWriter {
+	return &tracingStatusWriter{c.Client.Status(), c}
+}
+
+// tracingStatusWriter starts a span for every status request of the wrapped writer
+type tracingStatusWriter struct {
+	client.SubResourceWriter
+	client *tracingClient
+}
+
+func (w *tracingStatusWriter) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) (err error) {
+	ctx, span := w.client.start(ctx, "Status.Create", obj, obj.GetNamespace(), obj.GetName())
+	defer end(span, &err)
+
+	return w.SubResourceWriter.Create(ctx, obj, subResource, opts...)
+}
+
+func (w *tracingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) (err error) {
+	ctx, span := w.client.start(ctx, "Status.Update", obj, obj.GetNamespace(), obj.GetName())
+	defer end(span, &err)
+
+	return w.SubResourceWriter.Update(ctx, obj, opts...)
+}
+
+func (w *tracingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) (err error) {
+	ctx, span := w.client.start(ctx, "Status.Patch", obj, obj.GetNamespace(), obj.GetName())
+	defer end(span, &err)
+
+	return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+}
+
+// start starts the span of a request for the object, which is named after the verb and the kind of the object
+func (c *tracingClient) start(ctx context.Context, verb string, obj runtime.Object, namespace, name string) (context.Context, trace.Span) {
+	kind := ""
+	if gvk, err := c.GroupVersionKindFor(obj); err == nil {
+		kind = gvk.Kind
+	}
+
+	attributes := []attribute.KeyValue{KindKey.String(kind)}
+	if namespace != "" {
+		attributes = append(attributes, semconv.K8SNamespaceName(namespace))
+	}
+	if name != "" {
+		attributes = append(attributes, NameKey.String(name))
+	}
+
+	return Tracer().Start(ctx, "k8s."+verb+" "+kind,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...))
+}
+
+// end records the error of the request and ends its span
+func end(span trace.Span, err *error) {
+	RecordError(span, *err)
+	span.End()
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Reconciler wraps the reconciler of the given kind so every reconciliation runs in its own span.
+// The span is passed on in the context so calls to the API server and the database hosts become its children.
+func Reconciler(kind string, r reconcile.Reconciler) reconcile.Reconciler {
+	return reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+		ctx, span := Tracer().Start(ctx, kind+".Reconcile", trace.WithAttributes(
+			KindKey.String(kind),
+			semconv.K8SNamespaceName(req.Namespace),
+			NameKey.String(req.Name),
+		))
+		defer span.End()
+
+		result, err := r.Reconcile(ctx, req)
+		RecordError(span, err)
+
+		return result, err
+	})
+}
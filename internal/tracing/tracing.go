@@ -0,0 +1,118 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing configures the OpenTelemetry tracing of the operator.
+// Spans are only exported when an OTLP endpoint is configured, otherwise
+// the no-op tracer provider of the OpenTelemetry API stays in place.
+package tracing
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName  = "github.com/tuunit/external-database-operator"
+	serviceName = "external-database-operator"
+)
+
+var (
+	// KindKey is the attribute key of the kind of the reconciled or requested object
+	KindKey = attribute.Key("k8s.object.kind")
+	// NameKey is the attribute key of the name of the reconciled or requested object
+	NameKey = attribute.Key("k8s.object.name")
+)
+
+// Options configures the export of spans
+type Options struct {
+	// Endpoint is the host:port of the OTLP gRPC receiver, tracing is disabled if it is empty
+	Endpoint string
+	// Insecure disables TLS for the connection to the receiver
+	Insecure bool
+	// SampleRatio is the fraction of traces which are sampled
+	SampleRatio float64
+}
+
+// BindFlags binds the tracing options to the flag set
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Endpoint, "otlp-endpoint", "",
+		"The host:port of the OTLP gRPC receiver spans are exported to. Tracing is disabled if not set.")
+	fs.BoolVar(&o.Insecure, "otlp-insecure", false,
+		"If set, the connection to the OTLP receiver does not use TLS")
+	fs.Float64Var(&o.SampleRatio, "trace-sample-ratio", 1,
+		"The fraction of reconciliations which are traced, between 0 and 1")
+}
+
+// Setup installs the global tracer provider exporting to the configured endpoint.
+// The returned function flushes and stops the export and has to be called before exiting.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	clientOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create OTLP exporter for '%s': %w", opts.Endpoint, err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the operator from the global tracer provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// RecordError marks the span as failed if err is set
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
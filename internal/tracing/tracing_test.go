@@ -0,0 +1,139 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// spanNamed returns the ended span with the given name
+func spanNamed(name string) tracetest.SpanStub {
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name {
+			return span
+		}
+	}
+	Fail("no span named " + name)
+	return tracetest.SpanStub{}
+}
+
+var _ = Describe("Tracing", func() {
+	Context("When setting up tracing without an endpoint", func() {
+		It("should not fail and return a no-op shutdown", func() {
+			shutdown, err := Setup(context.Background(), Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shutdown(context.Background())).To(Succeed())
+		})
+	})
+
+	Context("When wrapping a reconciler", func() {
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "test-database"}}
+
+		It("should run every reconciliation in its own span", func() {
+			var parent bool
+			r := Reconciler("Database", reconcile.Func(func(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+				_, span := Tracer().Start(ctx, "child")
+				parent = span.SpanContext().IsValid()
+				span.End()
+				return reconcile.Result{}, nil
+			}))
+
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parent).To(BeTrue())
+
+			span := spanNamed("Database.Reconcile")
+			Expect(span.Attributes).To(ContainElements(
+				KindKey.String("Database"),
+				semconv.K8SNamespaceName("default"),
+				NameKey.String("test-database"),
+			))
+			Expect(span.Status.Code).To(Equal(codes.Unset))
+			Expect(spanNamed("child").Parent.SpanID()).To(Equal(span.SpanContext.SpanID()))
+		})
+
+		It("should mark the span as failed if the reconciliation fails", func() {
+			r := Reconciler("Database", reconcile.Func(func(context.Context, reconcile.Request) (reconcile.Result, error) {
+				return reconcile.Result{}, errors.New("boom")
+			}))
+
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).To(HaveOccurred())
+
+			span := spanNamed("Database.Reconcile")
+			Expect(span.Status.Code).To(Equal(codes.Error))
+			Expect(span.Status.Description).To(Equal("boom"))
+		})
+	})
+
+	Context("When wrapping a client", func() {
+		var c client.Client
+
+		BeforeEach(func() {
+			c = Client(fake.NewClientBuilder().
+				WithScheme(clientgoscheme.Scheme).
+				WithObjects(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "credentials"}}).
+				Build())
+		})
+
+		It("should trace requests with the kind and name of the object", func() {
+			secret := &corev1.Secret{}
+			Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "credentials"}, secret)).To(Succeed())
+
+			span := spanNamed("k8s.Get Secret")
+			Expect(span.Attributes).To(ContainElements(
+				KindKey.String("Secret"),
+				semconv.K8SNamespaceName("default"),
+				NameKey.String("credentials"),
+			))
+			Expect(span.Status.Code).To(Equal(codes.Unset))
+		})
+
+		It("should trace status updates", func() {
+			secret := &corev1.Secret{}
+			Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "credentials"}, secret)).To(Succeed())
+			Expect(c.Status().Update(context.Background(), secret)).NotTo(Succeed())
+
+			Expect(spanNamed("k8s.Status.Update Secret").Status.Code).To(Equal(codes.Error))
+		})
+
+		It("should record failed requests", func() {
+			err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "missing"}, &corev1.Secret{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+			span := spanNamed("k8s.Get Secret")
+			Expect(span.Status.Code).To(Equal(codes.Error))
+			Expect(span.Attributes).To(ContainElement(attribute.String("k8s.object.name", "missing")))
+		})
+	})
+})